@@ -9,7 +9,7 @@ import (
 
 	"github.com/Futaiii/Sudoku_ASCII/internal/app"
 	"github.com/Futaiii/Sudoku_ASCII/internal/config"
-	"github.com/Futaiii/Sudoku_ASCII/pkg/obfs/sudoku"
+	"github.com/Futaiii/Sudoku_ASCII/pkg/sudoku"
 )
 
 var (
@@ -18,6 +18,9 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "table" {
+		os.Exit(runTable(os.Args[2:]))
+	}
 	flag.Parse()
 
 	cfg, err := config.Load(*configPath)
@@ -25,6 +28,12 @@ func main() {
 		log.Fatalf("Failed to load config from %s: %v", *configPath, err)
 	}
 
+	// 按 key 与 layout (ascii) 生成混淆表
+	table, err := sudoku.NewTable(cfg)
+	if err != nil {
+		log.Fatalf("Invalid layout: %v", err)
+	}
+
 	if *testConfig {
 		fmt.Printf("Configuration %s is valid.\n", *configPath)
 		fmt.Printf("Mode: %s\n", cfg.Mode)
@@ -34,9 +43,6 @@ func main() {
 		os.Exit(0)
 	}
 
-	// Pass the ASCII mode preference
-	table := sudoku.NewTable(cfg.Key, cfg.ASCII)
-
 	if cfg.Mode == "client" {
 		app.RunClient(cfg, table)
 	} else {
@@ -0,0 +1,94 @@
+// cmd/sudoku-tunnel/table.go
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Futaiii/Sudoku_ASCII/internal/config"
+	obfs "github.com/Futaiii/Sudoku_ASCII/pkg/obfs/sudoku"
+	"github.com/Futaiii/Sudoku_ASCII/pkg/sudoku"
+)
+
+const tableUsage = `Usage:
+  sudoku-tunnel table export [-c config.json] [-o file]
+  sudoku-tunnel table verify [-c config.json] file`
+
+// runTable 处理 table 子命令，返回进程退出码
+//
+//	export: 按配置中的 key 与 grid 生成表并写入文件 (默认写入 table_cache 目录)
+//	verify: 检查表文件的格式、校验和、key 与 grid，并与重新生成的表逐字节比对
+func runTable(args []string) int {
+	if len(args) == 0 || (args[0] != "export" && args[0] != "verify") {
+		fmt.Fprintln(os.Stderr, tableUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("table "+args[0], flag.ContinueOnError)
+	cfgPath := fs.String("c", "config.json", "Path to configuration file")
+	out := fs.String("o", "", "Output file (export only)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	cfg, err := config.Load(*cfgPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config from %s: %v\n", *cfgPath, err)
+		return 1
+	}
+	layout, err := sudoku.NewLayout(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid layout: %v\n", err)
+		return 1
+	}
+	grid, err := obfs.VariantByName(cfg.Grid)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	switch args[0] {
+	case "export":
+		path := *out
+		if path == "" {
+			if cfg.TableCache != "" {
+				path = obfs.TableCachePath(cfg.TableCache, cfg.Key, grid)
+			} else {
+				path = "sudoku.table"
+			}
+		}
+		if err := obfs.NewTableVariant(cfg.Key, grid, layout).WriteFile(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Export failed: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Table written to %s\n", path)
+		return 0
+
+	default: // verify
+		if fs.NArg() != 1 {
+			fmt.Fprintln(os.Stderr, tableUsage)
+			return 2
+		}
+		path := fs.Arg(0)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		loaded, err := obfs.LoadTable(data, cfg.Key, grid, layout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			return 1
+		}
+		got, _ := loaded.MarshalBinary()
+		want, err := obfs.NewTableVariant(cfg.Key, grid, layout).MarshalBinary()
+		if err != nil || !bytes.Equal(got, want) {
+			fmt.Fprintf(os.Stderr, "%s: table does not match the one generated for this key and grid\n", path)
+			return 1
+		}
+		fmt.Printf("%s: OK\n", path)
+		return 0
+	}
+}
@@ -0,0 +1,99 @@
+// internal/accounting/conn.go
+package accounting
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sync/atomic"
+)
+
+// quotaCheckBytes 每经过这么多字节检查一次配额
+const quotaCheckBytes = 256 * 1024
+
+// CountingConn 统计经过连接的流量并计入账本
+// Read 计为上行 (客户端 -> 目标)，Write 计为下行 (目标 -> 客户端)
+// 流量先在连接内原子累加，每经过 quotaCheckBytes 字节与关闭时才并入账本并检查配额，
+// 读写热路径不争用账本的锁；超出配额后读写均返回错误，已建立的连接不会无限用下去
+type CountingConn struct {
+	net.Conn
+	ledger    *Ledger
+	user      string
+	dest      string
+	observe   func(up, down int64)
+	up, down  atomic.Int64 // 尚未并入账本的流量
+	unchecked atomic.Int64
+	exceeded  atomic.Bool
+	closed    atomic.Bool
+}
+
+// WrapConn 包装连接并计入账本，observe 非 nil 时同时以相同的字节数调用 (如管理接口的会话计数)
+func (l *Ledger) WrapConn(c net.Conn, user, dest string, observe func(up, down int64)) *CountingConn {
+	return &CountingConn{Conn: c, ledger: l, user: user, dest: dest, observe: observe}
+}
+
+func (c *CountingConn) Read(p []byte) (int, error) {
+	if err := c.check(0); err != nil {
+		return 0, err
+	}
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.up.Add(int64(n))
+		if c.observe != nil {
+			c.observe(int64(n), 0)
+		}
+		if qerr := c.check(n); qerr != nil && err == nil {
+			err = qerr
+		}
+	}
+	return n, err
+}
+
+func (c *CountingConn) Write(p []byte) (int, error) {
+	if err := c.check(0); err != nil {
+		return 0, err
+	}
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.down.Add(int64(n))
+		if c.observe != nil {
+			c.observe(0, int64(n))
+		}
+		if qerr := c.check(n); qerr != nil && err == nil {
+			err = qerr
+		}
+	}
+	return n, err
+}
+
+// Close 关闭连接并将剩余流量并入账本
+func (c *CountingConn) Close() error {
+	err := c.Conn.Close()
+	c.closed.Store(true)
+	c.flush()
+	return err
+}
+
+// flush 将累加的流量并入账本
+func (c *CountingConn) flush() {
+	c.ledger.Add(c.user, c.dest, c.up.Swap(0), c.down.Swap(0))
+}
+
+// check 累计 n 字节，达到 quotaCheckBytes 时并入账本并查询配额
+// 关闭后仍在进行的读写直接并入账本，不会遗漏
+func (c *CountingConn) check(n int) error {
+	if c.closed.Load() {
+		c.flush()
+	}
+	if !c.exceeded.Load() && c.unchecked.Add(int64(n)) >= quotaCheckBytes {
+		c.unchecked.Store(0)
+		c.flush()
+		if exceeded, period := c.ledger.Exceeded(c.user); exceeded && !c.exceeded.Swap(true) {
+			log.Printf("[Quota] User %s %s quota exceeded, closing %s", c.user, period, c.dest)
+		}
+	}
+	if c.exceeded.Load() {
+		return fmt.Errorf("%s: quota exceeded", c.user)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+// internal/accounting/conn_test.go
+package accounting
+
+import (
+	"io"
+	"net"
+	"testing"
+)
+
+// TestCountingConn 关闭时并入剩余流量，累计超过 quotaCheckBytes 后按配额断开
+func TestCountingConn(t *testing.T) {
+	l := NewLedger("", 0)
+	l.SetQuotas(map[string]Quota{"alice": {Daily: quotaCheckBytes}})
+
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	go func() {
+		c2.Write([]byte("hello"))
+		io.Copy(io.Discard, c2)
+	}()
+	var observed Stats
+	c := l.WrapConn(c1, "alice", "a.example", func(up, down int64) {
+		observed.Up += up
+		observed.Down += down
+	})
+
+	if _, err := io.ReadFull(c, make([]byte, 5)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Write(make([]byte, quotaCheckBytes)); err == nil {
+		t.Fatal("Write past the quota succeeded")
+	}
+	if _, err := c.Write([]byte("x")); err == nil {
+		t.Fatal("Write after the quota was exceeded succeeded")
+	}
+	c.Close()
+
+	want := Stats{5, quotaCheckBytes}
+	if got := l.Usage("alice").Total; got != want || observed != want {
+		t.Fatalf("ledger total = %+v, observed %+v, want %+v", got, observed, want)
+	}
+	if got := *l.destinations["alice"]["a.example"]; got != want {
+		t.Fatalf("a.example = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,258 @@
+// internal/accounting/ledger.go
+package accounting
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Futaiii/Sudoku_ASCII/internal/fsutil"
+)
+
+const (
+	dayLayout   = "2006-01-02"
+	monthLayout = "2006-01"
+
+	// OtherDestination 目标数量超过上限后，新目标统一计入此项
+	OtherDestination = "(other)"
+
+	bytesPerMB = 1024 * 1024
+)
+
+// Stats 上下行字节数
+type Stats struct {
+	Up   int64 `json:"up"`
+	Down int64 `json:"down"`
+}
+
+func (s Stats) Sum() int64 { return s.Up + s.Down }
+
+// UserUsage 单个用户的累计、当日与当月流量
+type UserUsage struct {
+	Total   Stats  `json:"total"`
+	Day     string `json:"day"`
+	Daily   Stats  `json:"daily"`
+	Month   string `json:"month"`
+	Monthly Stats  `json:"monthly"`
+}
+
+// Quota 用户流量配额 (字节)，0 表示不限制
+// 配额只能在 users 中按用户配置，单用户模式 (auth.DefaultUserName) 只统计不限额
+type Quota struct {
+	Daily   int64
+	Monthly int64
+}
+
+// QuotaMB 以 MB 为单位构造配额
+func QuotaMB(dailyMB, monthlyMB int64) Quota {
+	return Quota{Daily: dailyMB * bytesPerMB, Monthly: monthlyMB * bytesPerMB}
+}
+
+// snapshot 持久化文件格式，目标按用户分别统计 (用户 -> 目标 -> 流量)
+type snapshot struct {
+	Updated      time.Time                    `json:"updated"`
+	Users        map[string]*UserUsage        `json:"users"`
+	Destinations map[string]map[string]*Stats `json:"destinations"`
+}
+
+// Ledger 按用户与目标汇总流量，定期写入本地文件，并据此判断配额
+type Ledger struct {
+	mu              sync.Mutex
+	path            string
+	maxDestinations int
+	users           map[string]*UserUsage
+	destinations    map[string]map[string]*Stats // 用户 -> 目标
+	numDestinations int                          // 全部用户的目标条目数，受 maxDestinations 限制
+	quotas          map[string]Quota
+	dirty           bool
+
+	// 当前日期与月份，到 rollover 时重新计算，避免每次记账都格式化时间
+	day, month string
+	rollover   time.Time
+}
+
+// NewLedger 创建账本，path 非空时加载已有记录并在 Run 中定期写回
+func NewLedger(path string, maxDestinations int) *Ledger {
+	l := &Ledger{
+		path:            path,
+		maxDestinations: maxDestinations,
+		users:           make(map[string]*UserUsage),
+		destinations:    make(map[string]map[string]*Stats),
+		quotas:          make(map[string]Quota),
+	}
+	if path == "" {
+		return l
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("[Accounting] Failed to read %s: %v", path, err)
+		}
+		return l
+	}
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		log.Printf("[Accounting] Failed to parse %s: %v", path, err)
+		return l
+	}
+	if snap.Users != nil {
+		l.users = snap.Users
+	}
+	if snap.Destinations != nil {
+		l.destinations = snap.Destinations
+	}
+	for _, dests := range l.destinations {
+		l.numDestinations += len(dests)
+	}
+	log.Printf("[Accounting] Loaded %d users, %d destinations from %s", len(l.users), l.numDestinations, path)
+	return l
+}
+
+// SetQuotas 替换全部用户配额
+func (l *Ledger) SetQuotas(quotas map[string]Quota) {
+	l.mu.Lock()
+	l.quotas = quotas
+	l.mu.Unlock()
+}
+
+// Add 记录一次流量
+func (l *Ledger) Add(user, dest string, up, down int64) {
+	l.add(user, dest, up, down, time.Now())
+}
+
+func (l *Ledger) add(user, dest string, up, down int64, now time.Time) {
+	if up == 0 && down == 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	u := l.userLocked(user, now)
+	u.Total.Up += up
+	u.Total.Down += down
+	u.Daily.Up += up
+	u.Daily.Down += down
+	u.Monthly.Up += up
+	u.Monthly.Down += down
+
+	if dest != "" {
+		dests := l.destinations[user]
+		if dests == nil {
+			dests = make(map[string]*Stats)
+			l.destinations[user] = dests
+		}
+		d, ok := dests[dest]
+		if !ok {
+			if l.maxDestinations > 0 && l.numDestinations >= l.maxDestinations {
+				dest = OtherDestination
+				d = dests[dest]
+			}
+			if d == nil {
+				d = &Stats{}
+				dests[dest] = d
+				l.numDestinations++
+			}
+		}
+		d.Up += up
+		d.Down += down
+	}
+	l.dirty = true
+}
+
+// Exceeded 检查用户是否已超出配额，返回超出的周期 ("daily" / "monthly")
+func (l *Ledger) Exceeded(user string) (bool, string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	q, ok := l.quotas[user]
+	if !ok {
+		return false, ""
+	}
+	u := l.userLocked(user, time.Now())
+	if q.Daily > 0 && u.Daily.Sum() >= q.Daily {
+		return true, "daily"
+	}
+	if q.Monthly > 0 && u.Monthly.Sum() >= q.Monthly {
+		return true, "monthly"
+	}
+	return false, ""
+}
+
+// Usage 返回用户当前流量的副本
+func (l *Ledger) Usage(user string) UserUsage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return *l.userLocked(user, time.Now())
+}
+
+// userLocked 获取用户记录，跨日/跨月时清零对应周期
+func (l *Ledger) userLocked(user string, now time.Time) *UserUsage {
+	u, ok := l.users[user]
+	if !ok {
+		u = &UserUsage{}
+		l.users[user] = u
+	}
+	if !now.Before(l.rollover) {
+		l.day = now.Format(dayLayout)
+		l.month = now.Format(monthLayout)
+		y, m, d := now.Date()
+		l.rollover = time.Date(y, m, d+1, 0, 0, 0, 0, now.Location())
+	}
+	if u.Day != l.day {
+		u.Day = l.day
+		u.Daily = Stats{}
+	}
+	if u.Month != l.month {
+		u.Month = l.month
+		u.Monthly = Stats{}
+	}
+	return u
+}
+
+// Run 按间隔定期写入文件，阻塞运行
+func (l *Ledger) Run(interval time.Duration) {
+	if l.path == "" {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := l.Flush(); err != nil {
+			log.Printf("[Accounting] Flush failed: %v", err)
+		}
+	}
+}
+
+// Flush 将当前记录写入文件 (先写临时文件再替换，避免写一半)
+func (l *Ledger) Flush() error {
+	if l.path == "" {
+		return nil
+	}
+
+	l.mu.Lock()
+	if !l.dirty {
+		l.mu.Unlock()
+		return nil
+	}
+	data, err := json.MarshalIndent(snapshot{
+		Updated:      time.Now(),
+		Users:        l.users,
+		Destinations: l.destinations,
+	}, "", "  ")
+	l.dirty = false
+	l.mu.Unlock()
+	if err == nil {
+		err = fsutil.AtomicWriteFile(l.path, data, 0o600)
+	}
+	if err != nil {
+		// 写入失败时保留脏标记，下次 Flush 重试
+		l.mu.Lock()
+		l.dirty = true
+		l.mu.Unlock()
+	}
+	return err
+}
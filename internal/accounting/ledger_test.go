@@ -0,0 +1,96 @@
+// internal/accounting/ledger_test.go
+package accounting
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLedgerRollover(t *testing.T) {
+	l := NewLedger("", 0)
+	night := time.Date(2026, 1, 31, 23, 59, 59, 0, time.Local)
+
+	l.add("alice", "", 100, 20, night)
+	l.add("alice", "", 1, 2, night)
+	u := l.users["alice"]
+	if u.Daily != (Stats{101, 22}) || u.Monthly != (Stats{101, 22}) || u.Day != "2026-01-31" {
+		t.Fatalf("before midnight: %+v", u)
+	}
+
+	// 跨日同时跨月: 当日与当月清零，累计保留
+	l.add("alice", "", 5, 5, night.Add(time.Second))
+	if u.Daily != (Stats{5, 5}) || u.Monthly != (Stats{5, 5}) || u.Total != (Stats{106, 27}) {
+		t.Fatalf("after midnight: %+v", u)
+	}
+	if u.Day != "2026-02-01" || u.Month != "2026-02" {
+		t.Fatalf("period keys = %s, %s", u.Day, u.Month)
+	}
+
+	// 跨日不跨月: 只清零当日
+	l.add("alice", "", 1, 0, night.Add(24*time.Hour+time.Second))
+	if u.Daily != (Stats{1, 0}) || u.Monthly != (Stats{6, 5}) {
+		t.Fatalf("next day: %+v", u)
+	}
+}
+
+func TestLedgerDestinationsPerUser(t *testing.T) {
+	l := NewLedger("", 3)
+	now := time.Now()
+	l.add("alice", "a.example", 1, 1, now)
+	l.add("bob", "a.example", 2, 2, now)
+	l.add("alice", "b.example", 3, 3, now)
+	l.add("bob", "c.example", 4, 4, now) // 超出上限
+	l.add("alice", "a.example", 1, 1, now)
+
+	if got := *l.destinations["alice"]["a.example"]; got != (Stats{2, 2}) {
+		t.Fatalf("alice a.example = %+v", got)
+	}
+	if got := *l.destinations["bob"]["a.example"]; got != (Stats{2, 2}) {
+		t.Fatalf("bob a.example = %+v", got)
+	}
+	if _, ok := l.destinations["bob"]["c.example"]; ok {
+		t.Fatal("destination over the limit recorded by name")
+	}
+	if got := *l.destinations["bob"][OtherDestination]; got != (Stats{4, 4}) {
+		t.Fatalf("bob (other) = %+v", got)
+	}
+}
+
+func TestLedgerQuota(t *testing.T) {
+	l := NewLedger("", 0)
+	l.SetQuotas(map[string]Quota{"alice": {Daily: 100}})
+	l.Add("alice", "", 60, 30)
+	if exceeded, _ := l.Exceeded("alice"); exceeded {
+		t.Fatal("quota exceeded below the limit")
+	}
+	l.Add("alice", "", 0, 10)
+	if exceeded, period := l.Exceeded("alice"); !exceeded || period != "daily" {
+		t.Fatalf("Exceeded = %v, %s, want daily", exceeded, period)
+	}
+	if exceeded, _ := l.Exceeded("bob"); exceeded {
+		t.Fatal("user without quota exceeded")
+	}
+}
+
+// TestLedgerFlushRetry 写入失败的记录在下次 Flush 时重试
+func TestLedgerFlushRetry(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "missing")
+	path := filepath.Join(dir, "traffic.json")
+	l := NewLedger(path, 0)
+	l.Add("alice", "a.example", 1, 1)
+	if err := l.Flush(); err == nil {
+		t.Fatal("Flush into a missing directory succeeded")
+	}
+
+	if err := os.Mkdir(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := NewLedger(path, 0).Usage("alice"); got.Total != (Stats{1, 1}) {
+		t.Fatalf("reloaded total = %+v", got.Total)
+	}
+}
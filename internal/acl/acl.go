@@ -0,0 +1,221 @@
+// internal/acl/acl.go
+package acl
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Futaiii/Sudoku_ASCII/internal/config"
+	"github.com/Futaiii/Sudoku_ASCII/internal/metrics"
+	"github.com/Futaiii/Sudoku_ASCII/internal/protocol"
+)
+
+// 除 net.IP 自带判断 (回环、私有、链路本地、未指定) 之外默认拒绝的网段
+var extraPrivate = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "本网络"，Linux 上会连到本机
+	netip.MustParsePrefix("100.64.0.0/10"), // 运营商级 NAT
+	netip.MustParsePrefix("198.18.0.0/15"), // 基准测试
+	netip.MustParsePrefix("240.0.0.0/4"),   // 保留地址与广播
+}
+
+// nat64 众所周知的 NAT64 前缀，DNS64 环境下经此可访问内嵌的 IPv4 地址
+var nat64 = netip.MustParsePrefix("64:ff9b::/96")
+
+// ACL 服务端代理目标的访问控制
+type ACL struct {
+	allowPrivate bool
+	rules        []rule
+}
+
+type rule struct {
+	allow   bool
+	users   []string
+	nets    []netip.Prefix
+	domains []string
+	ports   [][2]int
+}
+
+// New 解析配置中的规则
+func New(cfg *config.ACLConfig) (*ACL, error) {
+	a := &ACL{allowPrivate: cfg.AllowPrivate}
+	for i, rc := range cfg.Rules {
+		r := rule{users: rc.Users}
+		switch rc.Action {
+		case "allow":
+			r.allow = true
+		case "deny":
+		default:
+			return nil, fmt.Errorf("acl rule %d: unknown action %q", i, rc.Action)
+		}
+
+		for _, c := range rc.CIDRs {
+			p, err := netip.ParsePrefix(c)
+			if err != nil {
+				// 允许直接写单个 IP
+				addr, aerr := netip.ParseAddr(c)
+				if aerr != nil {
+					return nil, fmt.Errorf("acl rule %d: %v", i, err)
+				}
+				p = netip.PrefixFrom(addr, addr.BitLen())
+			}
+			r.nets = append(r.nets, p.Masked())
+		}
+
+		for _, d := range rc.Domains {
+			r.domains = append(r.domains, strings.ToLower(strings.Trim(d, ".")))
+		}
+
+		for _, ps := range rc.Ports {
+			lo, hi, found := strings.Cut(ps, "-")
+			if !found {
+				hi = lo
+			}
+			from, err1 := strconv.Atoi(strings.TrimSpace(lo))
+			to, err2 := strconv.Atoi(strings.TrimSpace(hi))
+			if err1 != nil || err2 != nil || from < 0 || to > 65535 || from > to {
+				return nil, fmt.Errorf("acl rule %d: invalid port range %q", i, ps)
+			}
+			r.ports = append(r.ports, [2]int{from, to})
+		}
+
+		a.rules = append(a.rules, r)
+	}
+	return a, nil
+}
+
+// Allowed 判断用户 user 能否连接 ip:port
+// host 为请求中的主机名 (IP 字面量时与 ip 相同)，用于匹配 domains
+func (a *ACL) Allowed(user, host string, ip net.IP, port int) bool {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+	addr = addr.Unmap()
+	private := isPrivate(addr)
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	for _, r := range a.rules {
+		if !r.match(user, host, addr, port) {
+			continue
+		}
+		// 未显式列出网段的放行规则不覆盖内网地址的默认拒绝
+		if r.allow && private && !a.allowPrivate && len(r.nets) == 0 {
+			continue
+		}
+		return r.allow
+	}
+	return !private || a.allowPrivate
+}
+
+// Resolve 解析 addr (host:port) 并返回允许连接的地址 (ip:port)，保持解析顺序
+// 全部被拒绝时计数、记录日志并返回 protocol.ErrNotAllowed
+func (a *ACL) Resolve(ctx context.Context, user, addr string) ([]string, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port in %s", addr)
+	}
+
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		// 与 IP 无关的规则已能拒绝时不再解析
+		if a.deniedBeforeResolve(user, host, port) {
+			return nil, a.deny(user, addr, nil)
+		}
+		ipAddrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, ia := range ipAddrs {
+			ips = append(ips, ia.IP)
+		}
+	}
+
+	var allowed []string
+	for _, ip := range ips {
+		if a.Allowed(user, host, ip, port) {
+			allowed = append(allowed, net.JoinHostPort(ip.String(), portStr))
+		}
+	}
+	if len(allowed) == 0 {
+		return nil, a.deny(user, addr, ips)
+	}
+	return allowed, nil
+}
+
+// deniedBeforeResolve 按顺序检查规则，遇到可能命中的含网段放行规则即无法在解析前判断
+// 含网段的拒绝规则无论是否命中都不会使结果变为放行，可以跳过
+func (a *ACL) deniedBeforeResolve(user, host string, port int) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, r := range a.rules {
+		if !r.matchTarget(user, host, port) {
+			continue
+		}
+		if len(r.nets) > 0 {
+			if r.allow {
+				return false
+			}
+			continue
+		}
+		return !r.allow
+	}
+	return false
+}
+
+// deny 计数并记录被拒绝的目标
+func (a *ACL) deny(user, addr string, ips []net.IP) error {
+	metrics.ACLDenied.With(user).Inc()
+	if ips == nil {
+		log.Printf("[ACL] Denied %s for user %s", addr, user)
+	} else {
+		log.Printf("[ACL] Denied %s (%v) for user %s", addr, ips, user)
+	}
+	return fmt.Errorf("%w: %s", protocol.ErrNotAllowed, addr)
+}
+
+func (r *rule) match(user, host string, addr netip.Addr, port int) bool {
+	if len(r.nets) > 0 && !slices.ContainsFunc(r.nets, func(p netip.Prefix) bool { return p.Contains(addr) }) {
+		return false
+	}
+	return r.matchTarget(user, host, port)
+}
+
+// matchTarget 检查网段以外的条件
+func (r *rule) matchTarget(user, host string, port int) bool {
+	if len(r.users) > 0 && !slices.Contains(r.users, user) {
+		return false
+	}
+	if len(r.domains) > 0 && !slices.ContainsFunc(r.domains, func(d string) bool {
+		return host == d || strings.HasSuffix(host, "."+d)
+	}) {
+		return false
+	}
+	if len(r.ports) > 0 && !slices.ContainsFunc(r.ports, func(pr [2]int) bool { return port >= pr[0] && port <= pr[1] }) {
+		return false
+	}
+	return true
+}
+
+// isPrivate 内网、回环、链路本地等不应由代理访问的地址，NAT64 地址按内嵌的 IPv4 判断
+func isPrivate(addr netip.Addr) bool {
+	if nat64.Contains(addr) {
+		b := addr.As16()
+		addr = netip.AddrFrom4([4]byte(b[12:]))
+	}
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsUnspecified() {
+		return true
+	}
+	return slices.ContainsFunc(extraPrivate, func(p netip.Prefix) bool { return p.Contains(addr) })
+}
@@ -0,0 +1,139 @@
+// internal/acl/acl_test.go
+package acl
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/Futaiii/Sudoku_ASCII/internal/config"
+	"github.com/Futaiii/Sudoku_ASCII/internal/protocol"
+)
+
+func testACL(t *testing.T, allowPrivate bool) *ACL {
+	t.Helper()
+	a, err := New(&config.ACLConfig{
+		AllowPrivate: allowPrivate,
+		Rules: []config.ACLRule{
+			// 首条命中的规则生效: 对 alice 的放行在针对所有人的拒绝之前
+			{Action: "allow", Users: []string{"alice"}, CIDRs: []string{"192.168.1.0/24"}, Ports: []string{"22", "8000-9000"}},
+			{Action: "deny", Domains: []string{"example.com"}},
+			{Action: "deny", CIDRs: []string{"203.0.113.0/24", "2001:db8::/32"}},
+			{Action: "deny", Ports: []string{"25"}},
+			{Action: "allow", Users: []string{"bob"}, CIDRs: []string{"203.0.113.7"}},
+			{Action: "allow", Domains: []string{"intranet.test"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestAllowed(t *testing.T) {
+	tests := []struct {
+		name         string
+		allowPrivate bool
+		user, host   string
+		ip           string
+		port         int
+		want         bool
+	}{
+		{name: "public default", user: "bob", ip: "93.184.216.34", port: 443, want: true},
+		{name: "private default", user: "bob", ip: "192.168.1.10", port: 22},
+		{name: "loopback default", user: "bob", ip: "127.0.0.1", port: 80},
+		{name: "cgnat default", user: "bob", ip: "100.64.1.1", port: 80},
+		{name: "this network default", user: "bob", ip: "0.0.0.1", port: 80},
+		{name: "link local default", user: "bob", ip: "169.254.169.254", port: 80},
+		{name: "ipv6 loopback default", user: "bob", ip: "::1", port: 80},
+		{name: "ipv4-mapped private", user: "bob", ip: "::ffff:10.0.0.1", port: 80},
+		{name: "allow_private", allowPrivate: true, user: "bob", ip: "10.0.0.1", port: 80, want: true},
+
+		{name: "cidr allow for user and port", user: "alice", ip: "192.168.1.10", port: 22, want: true},
+		{name: "cidr allow port range", user: "alice", ip: "192.168.1.10", port: 8500, want: true},
+		{name: "cidr allow port outside range", user: "alice", ip: "192.168.1.10", port: 9001},
+		{name: "cidr allow other subnet", user: "alice", ip: "192.168.2.10", port: 22},
+		{name: "cidr allow other user", user: "bob", ip: "192.168.1.10", port: 22},
+
+		{name: "domain deny exact", user: "bob", host: "example.com", ip: "93.184.216.34", port: 443},
+		{name: "domain deny subdomain", user: "bob", host: "www.Example.COM.", ip: "93.184.216.34", port: 443},
+		{name: "domain deny not a suffix", user: "bob", host: "notexample.com", ip: "93.184.216.34", port: 443, want: true},
+		{name: "domain deny ip literal", user: "bob", host: "93.184.216.34", ip: "93.184.216.34", port: 443, want: true},
+
+		{name: "cidr deny v4", user: "bob", ip: "203.0.113.9", port: 443},
+		{name: "cidr deny v6", user: "bob", ip: "2001:db8::1", port: 443},
+		{name: "deny before later allow", user: "bob", ip: "203.0.113.7", port: 443},
+		{name: "port deny", user: "bob", ip: "93.184.216.34", port: 25},
+		{name: "port deny before user allow", user: "alice", ip: "198.51.100.1", port: 25},
+
+		// 未列出网段的放行规则不覆盖内网地址的默认拒绝
+		{name: "domain allow public", user: "bob", host: "www.intranet.test", ip: "93.184.216.34", port: 80, want: true},
+		{name: "domain allow private", user: "bob", host: "www.intranet.test", ip: "10.0.0.1", port: 80},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host := tt.host
+			if host == "" {
+				host = tt.ip
+			}
+			if got := testACL(t, tt.allowPrivate).Allowed(tt.user, host, net.ParseIP(tt.ip), tt.port); got != tt.want {
+				t.Fatalf("Allowed(%s, %s, %s, %d) = %v, want %v", tt.user, host, tt.ip, tt.port, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	a := testACL(t, false)
+	tests := []struct {
+		name, user, addr string
+		want             string // 空表示拒绝
+	}{
+		{name: "ip allowed", user: "bob", addr: "93.184.216.34:443", want: "93.184.216.34:443"},
+		{name: "ipv6 allowed", user: "bob", addr: "[2606:2800::1]:443", want: "[2606:2800::1]:443"},
+		{name: "ip denied", user: "bob", addr: "127.0.0.1:80"},
+		// NAT64 地址内嵌的 IPv4 同样受内网默认拒绝约束
+		{name: "nat64 metadata denied", user: "bob", addr: "[64:ff9b::a9fe:a9fe]:80"},
+		{name: "nat64 public allowed", user: "bob", addr: "[64:ff9b::5db8:d822]:443", want: "[64:ff9b::5db8:d822]:443"},
+		{name: "broadcast denied", user: "bob", addr: "255.255.255.255:80"},
+		// 域名规则在解析之前即可拒绝，不发出 DNS 查询
+		{name: "domain denied before resolve", user: "bob", addr: "api.example.com:443"},
+		{name: "port denied before resolve", user: "bob", addr: "mail.invalid:25"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := a.Resolve(context.Background(), tt.user, tt.addr)
+			if tt.want == "" {
+				if !errors.Is(err, protocol.ErrNotAllowed) {
+					t.Fatalf("Resolve(%s) = %v, %v, want ErrNotAllowed", tt.addr, got, err)
+				}
+				return
+			}
+			if err != nil || len(got) != 1 || got[0] != tt.want {
+				t.Fatalf("Resolve(%s) = %v, %v, want [%s]", tt.addr, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRejectsInvalidRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rule config.ACLRule
+	}{
+		{"unknown action", config.ACLRule{Action: "block"}},
+		{"bad cidr", config.ACLRule{Action: "deny", CIDRs: []string{"10.0.0.0/33"}}},
+		{"bad ip", config.ACLRule{Action: "deny", CIDRs: []string{"example.com"}}},
+		{"bad port", config.ACLRule{Action: "deny", Ports: []string{"http"}}},
+		{"port too large", config.ACLRule{Action: "deny", Ports: []string{"65536"}}},
+		{"reversed range", config.ACLRule{Action: "deny", Ports: []string{"9000-8000"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(&config.ACLConfig{Rules: []config.ACLRule{tt.rule}}); err == nil {
+				t.Fatal("New succeeded, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+// internal/admin/server.go
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/Futaiii/Sudoku_ASCII/pkg/geodata"
+)
+
+// Server 本地管理接口 (JSON)
+//
+//	GET    /sessions       列出活动会话
+//	DELETE /sessions/{id}  关闭指定会话
+//	GET    /geodata        已加载的规则数量 (客户端 PAC 模式)
+//	POST   /reload         重新加载配置文件
+//
+// 修改状态的请求 (DELETE / POST) 需携带 "Authorization: Bearer <Token>"；
+// Token 为空时需携带 X-Sudoku-Admin 头，浏览器跨站请求无法附带自定义头
+type Server struct {
+	Sessions *Registry
+	GeoData  func() *geodata.Manager
+	Reload   func() error
+	Token    string
+}
+
+// adminHeader Token 为空时修改状态的请求须携带的头
+const adminHeader = "X-Sudoku-Admin"
+
+// Start 在 addr 上启动管理接口，addr 必须是回环地址，为空时不启动
+func (s *Server) Start(addr string) error {
+	if addr == "" {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("admin address must be loopback, got %s", addr)
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /sessions", s.handleList)
+	mux.HandleFunc("DELETE /sessions/{id}", s.authorized(s.handleKill))
+	mux.HandleFunc("GET /geodata", s.handleGeoData)
+	mux.HandleFunc("POST /reload", s.authorized(s.handleReload))
+
+	log.Printf("[Admin] Listening on %s", l.Addr())
+	go func() {
+		if err := http.Serve(l, loopbackOnly(mux)); err != nil {
+			log.Printf("[Admin] Server stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// loopbackOnly 拒绝非本机来源的请求，以及 Host 不是回环地址或 localhost 的请求 (DNS 重绑定)
+func loopbackOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+			writeError(w, http.StatusForbidden, "forbidden")
+			return
+		}
+		if !loopbackHost(r.Host) {
+			writeError(w, http.StatusForbidden, "forbidden host")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// loopbackHost 判断 Host 头是否为 localhost 或回环 IP (可带端口)
+func loopbackHost(hostport string) bool {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+	}
+	if host == "localhost" {
+		return true
+	}
+	if len(host) > 2 && host[0] == '[' && host[len(host)-1] == ']' {
+		host = host[1 : len(host)-1]
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// authorized 检查修改状态的请求: 配置了 Token 时校验 Bearer Token，否则要求 X-Sudoku-Admin 头
+func (s *Server) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.Token != "" {
+			got := r.Header.Get("Authorization")
+			if subtle.ConstantTimeCompare([]byte(got), []byte("Bearer "+s.Token)) != 1 {
+				writeError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+		} else if r.Header.Get(adminHeader) == "" {
+			writeError(w, http.StatusForbidden, "missing "+adminHeader+" header")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Sessions.List())
+}
+
+func (s *Server) handleKill(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid session id")
+		return
+	}
+	if !s.Sessions.Kill(id) {
+		writeError(w, http.StatusNotFound, "session not found")
+		return
+	}
+	log.Printf("[Admin] Killed session %d", id)
+	writeJSON(w, http.StatusOK, map[string]uint64{"killed": id})
+}
+
+func (s *Server) handleGeoData(w http.ResponseWriter, r *http.Request) {
+	var geoMgr *geodata.Manager
+	if s.GeoData != nil {
+		geoMgr = s.GeoData()
+	}
+	if geoMgr == nil {
+		writeError(w, http.StatusNotFound, "geodata not loaded")
+		return
+	}
+	writeJSON(w, http.StatusOK, geoMgr.Stats())
+}
+
+func (s *Server) handleReload(w http.ResponseWriter, r *http.Request) {
+	if s.Reload == nil {
+		writeError(w, http.StatusNotImplemented, "reload not supported")
+		return
+	}
+	if err := s.Reload(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"reloaded": true})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
@@ -0,0 +1,161 @@
+// internal/admin/server_test.go
+package admin
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type closeFlag struct{ closed bool }
+
+func (c *closeFlag) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestRegistryKill(t *testing.T) {
+	r := NewRegistry()
+	s := r.Open("1.2.3.4:5678", "alice", false)
+	s.SetTarget("example.com:443")
+	c := &closeFlag{}
+	s.AddCloser(c)
+
+	if list := r.List(); len(list) != 1 || list[0].Target != "example.com:443" || list[0].User != "alice" {
+		t.Fatalf("List = %+v", list)
+	}
+	if r.Kill(s.ID() + 1) {
+		t.Fatal("Kill of unknown id returned true")
+	}
+	if !r.Kill(s.ID()) || !c.closed {
+		t.Fatal("Kill did not close the session")
+	}
+
+	// 被关闭后才登记的连接立即关闭
+	late := &closeFlag{}
+	s.AddCloser(late)
+	if !late.closed {
+		t.Fatal("closer added after Kill was not closed")
+	}
+
+	s.Done()
+	if r.Len() != 0 || r.Total() != 1 {
+		t.Fatalf("Len = %d, Total = %d", r.Len(), r.Total())
+	}
+}
+
+// TestSessionCounting 两侧包装与直接汇报的字节数按方向累计到同一会话
+func TestSessionCounting(t *testing.T) {
+	s := NewRegistry().Open("1.2.3.4:5678", "alice", false)
+	defer s.Done()
+
+	client, peer := net.Pipe()
+	defer peer.Close()
+	conn := s.WrapConn(client)
+	go func() {
+		peer.Write([]byte("hello"))
+		io.ReadFull(peer, make([]byte, 3))
+	}()
+	io.ReadFull(conn, make([]byte, 5))
+	conn.Write([]byte("abc"))
+	s.Count(10, 20)
+
+	if info := s.Info(); info.Up != 15 || info.Down != 23 {
+		t.Fatalf("Up, Down = %d, %d, want 15, 23", info.Up, info.Down)
+	}
+}
+
+func TestLoopbackHost(t *testing.T) {
+	for host, want := range map[string]bool{
+		"localhost":        true,
+		"localhost:9090":   true,
+		"127.0.0.1:9090":   true,
+		"[::1]:9090":       true,
+		"[::1]":            true,
+		"evil.example:80":  false,
+		"192.168.1.1:9090": false,
+		"":                 false,
+	} {
+		if got := loopbackHost(host); got != want {
+			t.Errorf("loopbackHost(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
+
+func TestStartRejectsNonLoopback(t *testing.T) {
+	s := &Server{Sessions: NewRegistry()}
+	if err := s.Start(""); err != nil {
+		t.Fatalf("Start(\"\") = %v", err)
+	}
+	for _, addr := range []string{"0.0.0.0:0", ":0", "example.com:0"} {
+		if err := s.Start(addr); err == nil {
+			t.Errorf("Start(%q) succeeded", addr)
+		}
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		header map[string]string
+		remote string
+		host   string
+		want   int
+	}{
+		{"no token, missing header", "", nil, "127.0.0.1:1", "127.0.0.1", http.StatusForbidden},
+		{"no token, admin header", "", map[string]string{adminHeader: "1"}, "127.0.0.1:1", "127.0.0.1", http.StatusNotFound},
+		{"wrong token", "secret", map[string]string{"Authorization": "Bearer nope"}, "127.0.0.1:1", "127.0.0.1", http.StatusUnauthorized},
+		{"admin header without token", "secret", map[string]string{adminHeader: "1"}, "127.0.0.1:1", "127.0.0.1", http.StatusUnauthorized},
+		{"valid token", "secret", map[string]string{"Authorization": "Bearer secret"}, "127.0.0.1:1", "localhost", http.StatusNotFound},
+		{"remote peer", "", map[string]string{adminHeader: "1"}, "203.0.113.1:1", "127.0.0.1", http.StatusForbidden},
+		{"rebound host", "", map[string]string{adminHeader: "1"}, "127.0.0.1:1", "evil.example", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{Sessions: NewRegistry(), Token: tt.token}
+			mux := http.NewServeMux()
+			mux.HandleFunc("DELETE /sessions/{id}", s.authorized(s.handleKill))
+			h := loopbackOnly(mux)
+
+			req := httptest.NewRequest(http.MethodDelete, "/sessions/42", nil)
+			req.RemoteAddr = tt.remote
+			req.Host = tt.host
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			// 通过校验的请求因会话不存在而返回 404
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tt.want, strings.TrimSpace(rec.Body.String()))
+			}
+		})
+	}
+}
+
+func TestStartServesSessions(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	s := &Server{Sessions: NewRegistry()}
+	s.Sessions.Open("1.2.3.4:5678", "", true)
+	if err := s.Start(addr); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get("http://" + addr + "/sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+}
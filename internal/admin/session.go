@@ -0,0 +1,213 @@
+// internal/admin/session.go
+package admin
+
+import (
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Futaiii/Sudoku_ASCII/internal/metrics"
+)
+
+// Registry 记录当前活动的会话 (每条代理的 TCP 连接或 UDP 关联)
+type Registry struct {
+	mu       sync.Mutex
+	nextID   uint64
+	sessions map[uint64]*Session
+}
+
+func NewRegistry() *Registry {
+	return &Registry{sessions: make(map[uint64]*Session)}
+}
+
+// Session 单个活动会话
+// 流量方向以代理为准: up 为客户端 -> 目标，down 为目标 -> 客户端
+type Session struct {
+	id     uint64
+	remote string
+	user   string
+	split  bool
+	start  time.Time
+	reg    *Registry
+
+	mu      sync.Mutex
+	target  string
+	closers []io.Closer
+	killed  bool
+
+	up, down atomic.Int64
+}
+
+// Info 会话的 JSON 视图
+type Info struct {
+	ID         uint64    `json:"id"`
+	Remote     string    `json:"remote"`
+	Target     string    `json:"target"`
+	User       string    `json:"user,omitempty"`
+	Split      bool      `json:"split"`
+	Up         int64     `json:"up"`
+	Down       int64     `json:"down"`
+	Start      time.Time `json:"start"`
+	AgeSeconds int64     `json:"age_seconds"`
+}
+
+// Open 登记一个新会话，结束时需调用 Done
+func (r *Registry) Open(remote, user string, split bool) *Session {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	s := &Session{
+		id:     r.nextID,
+		remote: remote,
+		user:   user,
+		split:  split,
+		start:  time.Now(),
+		reg:    r,
+	}
+	r.sessions[s.id] = s
+	return s
+}
+
+// List 按 ID 顺序返回全部会话
+func (r *Registry) List() []Info {
+	r.mu.Lock()
+	list := make([]*Session, 0, len(r.sessions))
+	for _, s := range r.sessions {
+		list = append(list, s)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].id < list[j].id })
+	infos := make([]Info, 0, len(list))
+	for _, s := range list {
+		infos = append(infos, s.Info())
+	}
+	return infos
+}
+
+// Len 当前会话数
+func (r *Registry) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.sessions)
+}
+
+// Total 累计登记过的会话数
+func (r *Registry) Total() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.nextID
+}
+
+// Drain 等待全部会话结束，超时后关闭剩余会话，返回被强制关闭的数量
+func (r *Registry) Drain(timeout time.Duration) int {
+	deadline := time.Now().Add(timeout)
+	for r.Len() > 0 && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	r.mu.Lock()
+	remaining := make([]*Session, 0, len(r.sessions))
+	for _, s := range r.sessions {
+		remaining = append(remaining, s)
+	}
+	r.mu.Unlock()
+
+	for _, s := range remaining {
+		s.Kill()
+	}
+	return len(remaining)
+}
+
+// Kill 关闭指定会话的全部连接，会话不存在时返回 false
+func (r *Registry) Kill(id uint64) bool {
+	r.mu.Lock()
+	s, ok := r.sessions[id]
+	r.mu.Unlock()
+	if !ok {
+		return false
+	}
+	s.Kill()
+	return true
+}
+
+func (s *Session) ID() uint64 { return s.id }
+
+// SetTarget 记录目标地址 (在读取地址之后才知道)
+func (s *Session) SetTarget(target string) {
+	s.mu.Lock()
+	s.target = target
+	s.mu.Unlock()
+}
+
+// AddCloser 登记 Kill 时需要关闭的连接，会话已被关闭时立即关闭
+func (s *Session) AddCloser(closers ...io.Closer) {
+	s.mu.Lock()
+	killed := s.killed
+	if !killed {
+		s.closers = append(s.closers, closers...)
+	}
+	s.mu.Unlock()
+
+	if killed {
+		for _, c := range closers {
+			c.Close()
+		}
+	}
+}
+
+// Kill 关闭会话登记的全部连接
+func (s *Session) Kill() {
+	s.mu.Lock()
+	s.killed = true
+	closers := s.closers
+	s.closers = nil
+	s.mu.Unlock()
+
+	for _, c := range closers {
+		c.Close()
+	}
+}
+
+// Done 会话结束，从登记表中移除
+func (s *Session) Done() {
+	s.reg.mu.Lock()
+	delete(s.reg.sessions, s.id)
+	s.reg.mu.Unlock()
+}
+
+func (s *Session) Info() Info {
+	s.mu.Lock()
+	target := s.target
+	s.mu.Unlock()
+	return Info{
+		ID:         s.id,
+		Remote:     s.remote,
+		Target:     target,
+		User:       s.user,
+		Split:      s.split,
+		Up:         s.up.Load(),
+		Down:       s.down.Load(),
+		Start:      s.start,
+		AgeSeconds: int64(time.Since(s.start) / time.Second),
+	}
+}
+
+// Count 累计一次转发的字节数，供已按连接统计流量的包装 (如账本) 直接汇报，无需再包一层
+func (s *Session) Count(up, down int64) {
+	s.up.Add(up)
+	s.down.Add(down)
+}
+
+// WrapConn 统计面向客户端一侧的连接: Read 计为上行，Write 计为下行
+func (s *Session) WrapConn(c net.Conn) net.Conn {
+	return metrics.WrapCounting(c, func(n int64) { s.up.Add(n) }, func(n int64) { s.down.Add(n) })
+}
+
+// WrapTunnel 统计面向目标一侧的连接: Read 计为下行，Write 计为上行
+func (s *Session) WrapTunnel(c net.Conn) net.Conn {
+	return metrics.WrapCounting(c, func(n int64) { s.down.Add(n) }, func(n int64) { s.up.Add(n) })
+}
@@ -4,22 +4,24 @@ package app
 import (
 	"bufio"
 	"context"
-	"crypto/rand"
-	"encoding/binary"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/Futaiii/Sudoku_ASCII/internal/admin"
 	"github.com/Futaiii/Sudoku_ASCII/internal/config"
 	"github.com/Futaiii/Sudoku_ASCII/internal/hybrid"
+	"github.com/Futaiii/Sudoku_ASCII/internal/metrics"
 	"github.com/Futaiii/Sudoku_ASCII/internal/protocol"
-	"github.com/Futaiii/Sudoku_ASCII/pkg/crypto"
+	"github.com/Futaiii/Sudoku_ASCII/internal/ratelimit"
 	"github.com/Futaiii/Sudoku_ASCII/pkg/geodata"
 	"github.com/Futaiii/Sudoku_ASCII/pkg/obfs/sudoku"
+	tunnel "github.com/Futaiii/Sudoku_ASCII/pkg/sudoku"
 )
 
 // PeekConn 允许查看第一个字节不消耗它
@@ -37,10 +39,63 @@ func (c *PeekConn) Read(p []byte) (n int, err error) {
 	return c.Conn.Read(p)
 }
 
+// unread 取出 br 中已缓冲的数据，返回先读出这些数据、再读取 conn 的连接
+// 取出后 br 为空，重复调用不会重复放回
+func unread(conn net.Conn, br *bufio.Reader) net.Conn {
+	n := br.Buffered()
+	if n == 0 {
+		return conn
+	}
+	peeked := make([]byte, n)
+	br.Read(peeked)
+	return &PeekConn{Conn: conn, peeked: peeked}
+}
+
+// watchClient 在连接目标期间监视本地客户端，客户端断开时取消返回的 ctx
+// stop 结束监视并返回后续应使用的连接 (期间收到的数据会放回)
+func watchClient(conn net.Conn) (ctx context.Context, stop func() net.Conn) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	var peeked []byte
+	go func() {
+		defer close(done)
+		buf := make([]byte, 1)
+		n, err := conn.Read(buf)
+		peeked = buf[:n]
+		if ne, ok := err.(net.Error); err != nil && !(ok && ne.Timeout()) {
+			cancel()
+		}
+	}()
+
+	return ctx, func() net.Conn {
+		conn.SetReadDeadline(time.Unix(1, 0))
+		<-done
+		conn.SetReadDeadline(time.Time{})
+		cancel()
+		if len(peeked) > 0 {
+			return &PeekConn{Conn: conn, peeked: peeked}
+		}
+		return conn
+	}
+}
+
+// clientLimit 客户端限速器，在 RunClient 中初始化
+var clientLimit *ratelimit.Limiter
+
+// clientSessions 客户端活动会话，供管理接口查询
+var clientSessions = admin.NewRegistry()
+
 func RunClient(cfg *config.Config, table *sudoku.Table) {
-	mgr := hybrid.GetInstance(cfg)
-	if err := mgr.StartMieruClient(); err != nil {
-		log.Fatalf("Failed to start Mieru Client: %v", err)
+	started := time.Now()
+	dialer, err := tunnel.NewDialer(cfg, table)
+	if err != nil {
+		log.Fatalf("Failed to create dialer: %v", err)
+	}
+
+	// 客户端不区分用户，仅使用全局与单连接限速
+	clientLimit = ratelimit.NewLimiter(cfg)
+	if err := metrics.Serve(cfg.MetricsAddr); err != nil {
+		log.Fatalf("Failed to start metrics endpoint: %v", err)
 	}
 
 	var geoMgr *geodata.Manager
@@ -48,6 +103,29 @@ func RunClient(cfg *config.Config, table *sudoku.Table) {
 		geoMgr = geodata.GetInstance(cfg.RuleURLs)
 	}
 
+	// 热更新: 新连接使用新配置，已建立的连接不受影响
+	var current atomic.Pointer[clientState]
+	current.Store(&clientState{cfg: cfg, table: table, geoMgr: geoMgr, dialer: dialer})
+	rl := &reloader{fn: func() error {
+		next, err := current.Load().reload()
+		if err != nil {
+			return err
+		}
+		current.Store(next)
+		return nil
+	}}
+	rl.watchSIGHUP()
+
+	adminSrv := &admin.Server{
+		Sessions: clientSessions,
+		GeoData:  func() *geodata.Manager { return current.Load().geoMgr },
+		Reload:   rl.Reload,
+		Token:    cfg.AdminToken,
+	}
+	if err := adminSrv.Start(cfg.AdminAddr); err != nil {
+		log.Fatalf("Failed to start admin API: %v", err)
+	}
+
 	l, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.LocalPort))
 	if err != nil {
 		log.Fatal(err)
@@ -55,16 +133,53 @@ func RunClient(cfg *config.Config, table *sudoku.Table) {
 	log.Printf("Client (Mixed) on :%d -> %s | Mode: %s | Rules: %d",
 		cfg.LocalPort, cfg.ServerAddress, cfg.ProxyMode, len(cfg.RuleURLs))
 
-	for {
-		c, err := l.Accept()
-		if err != nil {
-			continue
-		}
-		go handleMixedConn(c, cfg, table, geoMgr, mgr)
+	serveUntilSignal(l, func(c net.Conn) {
+		go handleMixedConn(c, current.Load())
+	})
+
+	timeout := time.Duration(current.Load().cfg.ShutdownTimeout) * time.Second
+	drain(clientSessions, timeout, hybrid.GetInstance(cfg), started)
+}
+
+// clientState 客户端可热更新的配置
+type clientState struct {
+	cfg    *config.Config
+	table  *sudoku.Table
+	geoMgr *geodata.Manager
+	dialer *tunnel.Dialer
+}
+
+// reload 读取配置文件，返回用于新连接的状态
+func (s *clientState) reload() (*clientState, error) {
+	cfg, table, err := reloadConfig(s.cfg, s.table)
+	if err != nil {
+		return nil, err
 	}
+
+	var geoMgr *geodata.Manager
+	if cfg.ProxyMode == "pac" {
+		// 重新下载规则，完成前继续使用旧规则
+		geoMgr = geodata.GetInstance(cfg.RuleURLs)
+		geoMgr.Reload(cfg.RuleURLs)
+	}
+
+	// 新的 Dialer 使用独立的多路复用会话池，
+	// 旧会话不再承载新流，待其上的流结束后立即关闭
+	dialer, err := tunnel.NewDialer(cfg, table)
+	if err != nil {
+		return nil, err
+	}
+	s.dialer.CloseWhenIdle()
+	clientLimit.Update(cfg)
+
+	log.Printf("[Reload] Client config reloaded (Server: %s, Mode: %s)", cfg.ServerAddress, cfg.ProxyMode)
+	return &clientState{cfg: cfg, table: table, geoMgr: geoMgr, dialer: dialer}, nil
 }
 
-func handleMixedConn(c net.Conn, cfg *config.Config, table *sudoku.Table, geoMgr *geodata.Manager, mgr *hybrid.Manager) {
+func handleMixedConn(c net.Conn, s *clientState) {
+	metrics.ActiveConns.Inc()
+	defer metrics.ActiveConns.Dec()
+
 	// peek第一个字节以确定协议
 	buf := make([]byte, 1)
 	if _, err := io.ReadFull(c, buf); err != nil {
@@ -77,16 +192,16 @@ func handleMixedConn(c net.Conn, cfg *config.Config, table *sudoku.Table, geoMgr
 
 	if buf[0] == 0x05 {
 		// SOCKS5
-		handleClientSocks5(pConn, cfg, table, geoMgr, mgr)
+		handleClientSocks5(pConn, s)
 	} else {
 		// 假设是 HTTP/HTTPS
-		handleHTTP(pConn, cfg, table, geoMgr, mgr)
+		handleHTTP(pConn, s)
 	}
 }
 
 // ==== SOCKS5 Handler ====
 
-func handleClientSocks5(conn net.Conn, cfg *config.Config, table *sudoku.Table, geoMgr *geodata.Manager, mgr *hybrid.Manager) {
+func handleClientSocks5(conn net.Conn, s *clientState) {
 	defer conn.Close()
 
 	// 1. SOCKS5 握手
@@ -106,9 +221,19 @@ func handleClientSocks5(conn net.Conn, cfg *config.Config, table *sudoku.Table,
 		return
 	}
 
-	// CMD: header[1] (0x01 Connect)
-	if header[1] != 0x01 {
-		// 不支持 Bind 或 UDP Associate
+	// CMD: header[1] (0x01 Connect, 0x03 UDP Associate)
+	switch header[1] {
+	case 0x01:
+	case 0x03:
+		// 客户端声明的 UDP 源地址通常为 0.0.0.0:0，这里只读取不使用
+		if _, _, _, err := protocol.ReadAddress(conn); err != nil {
+			return
+		}
+		handleUDPAssociate(conn, s)
+		return
+	default:
+		// 不支持 Bind
+		conn.Write([]byte{0x05, 0x07, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
 		return
 	}
 
@@ -117,11 +242,13 @@ func handleClientSocks5(conn net.Conn, cfg *config.Config, table *sudoku.Table,
 		return
 	}
 
-	// 3. 路由与连接
-	targetConn, success := dialTarget(destAddrStr, destIP, cfg, table, geoMgr, mgr)
-	if !success {
+	// 3. 路由与连接 (客户端中途断开则放弃)
+	ctx, stop := watchClient(conn)
+	targetConn, proxied, err := dialTarget(ctx, destAddrStr, destIP, s)
+	conn = stop()
+	if err != nil {
 		// SOCKS5 Error
-		conn.Write([]byte{0x05, 0x04, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		conn.Write([]byte{0x05, protocol.SocksReply(protocol.ReplyFor(err)), 0x00, 0x01, 0, 0, 0, 0, 0, 0})
 		return
 	}
 
@@ -129,15 +256,16 @@ func handleClientSocks5(conn net.Conn, cfg *config.Config, table *sudoku.Table,
 	conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
 
 	// 4. 转发
-	startPipe(conn, targetConn)
+	startPipe(conn, targetConn, openClientSession(conn, destAddrStr, proxied, s.cfg))
 }
 
 // ==== HTTP Handler ====
 
-func handleHTTP(conn net.Conn, cfg *config.Config, table *sudoku.Table, geoMgr *geodata.Manager, mgr *hybrid.Manager) {
+func handleHTTP(conn net.Conn, s *clientState) {
 	defer conn.Close()
 
-	req, err := http.ReadRequest(bufio.NewReader(conn))
+	br := bufio.NewReader(conn)
+	req, err := http.ReadRequest(br)
 	if err != nil {
 		return
 	}
@@ -156,17 +284,24 @@ func handleHTTP(conn net.Conn, cfg *config.Config, table *sudoku.Table, geoMgr *
 	hostName, _, _ := net.SplitHostPort(host)
 	destIP := net.ParseIP(hostName)
 
-	// 路由决策与连接
-	targetConn, success := dialTarget(host, destIP, cfg, table, geoMgr, mgr)
-	if !success {
-		conn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\n\r\n"))
+	// 路由决策与连接 (客户端中途断开则放弃)
+	// 有请求体时不监视: 请求体由 req.Body 经 br 读取，监视读走的字节无法放回
+	ctx, stop := context.Background(), func() net.Conn { return conn }
+	if req.Body == http.NoBody {
+		conn = unread(conn, br)
+		ctx, stop = watchClient(conn)
+	}
+	targetConn, proxied, err := dialTarget(ctx, host, destIP, s)
+	conn = stop()
+	if err != nil {
+		conn.Write([]byte(httpErrorStatus(err)))
 		return
 	}
 
 	if req.Method == http.MethodConnect {
 		// HTTPS Tunnel: 建立连接后回复 200 OK，然后纯透传
 		conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
-		startPipe(conn, targetConn)
+		startPipe(conn, targetConn, openClientSession(conn, host, proxied, s.cfg))
 	} else {
 		req.RequestURI = ""
 		// 如果是绝对路径转换为相对路径
@@ -179,146 +314,118 @@ func handleHTTP(conn net.Conn, cfg *config.Config, table *sudoku.Table, geoMgr *
 			targetConn.Close()
 			return
 		}
-		startPipe(conn, targetConn)
+		// 请求体已读完，br 中多读的数据 (如下一个请求) 随后转发
+		conn = unread(conn, br)
+		startPipe(conn, targetConn, openClientSession(conn, host, proxied, s.cfg))
 	}
 }
 
 // ==== Common Logic ====
 
-func dialTarget(destAddrStr string, destIP net.IP, cfg *config.Config, table *sudoku.Table, geoMgr *geodata.Manager, mgr *hybrid.Manager) (net.Conn, bool) {
-	shouldProxy := true
-
-	if cfg.ProxyMode == "global" {
-		shouldProxy = true
-	} else if cfg.ProxyMode == "direct" {
-		shouldProxy = false
-	} else if cfg.ProxyMode == "pac" {
-		// 1. 检查域名或已知 IP 是否在 CN 列表
-		if geoMgr.IsCN(destAddrStr, destIP) {
-			shouldProxy = false
-			log.Printf("[PAC] %s -> DIRECT (Rule Match)", destAddrStr)
-		} else {
-			// 2. 如果没有匹配且 destIP 未知 (是域名)，尝试解析 IP 再检查
-			if destIP == nil {
-				host, _, _ := net.SplitHostPort(destAddrStr)
-				ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-				ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", host)
-				cancel()
-
-				if err == nil && len(ips) > 0 {
-					if geoMgr.IsCN(destAddrStr, ips[0]) {
-						shouldProxy = false
-						log.Printf("[PAC] %s (%s) -> DIRECT (IP Rule Match)", destAddrStr, ips[0])
-					} else {
-						log.Printf("[PAC] %s (%s) -> PROXY", destAddrStr, ips[0])
-					}
-				} else {
-					// 解析失败或无 IP，默认代理
-					log.Printf("[PAC] %s -> PROXY (Default)", destAddrStr)
-				}
-			} else {
-				log.Printf("[PAC] %s -> PROXY", destAddrStr)
-			}
-		}
-	}
-
-	if shouldProxy {
-		// 1. Sudoku Dial (Uplink)
-		rawRemote, err := net.DialTimeout("tcp", cfg.ServerAddress, 5*time.Second)
+// dialTarget 按路由规则直连或经隧道连接目标，返回连接与是否经由代理
+// 失败原因可用 protocol.ReplyFor 归类
+func dialTarget(ctx context.Context, destAddrStr string, destIP net.IP, s *clientState) (net.Conn, bool, error) {
+	if !shouldProxy(ctx, destAddrStr, destIP, s.cfg, s.geoMgr) {
+		// 直连
+		nd := net.Dialer{Timeout: time.Duration(s.cfg.Timeouts.Connect) * time.Second}
+		dConn, err := nd.DialContext(ctx, "tcp", destAddrStr)
 		if err != nil {
-			log.Printf("[Proxy] Dial Server Failed: %v", err)
-			return nil, false
+			log.Printf("[Direct] Dial Failed: %v", err)
+			return nil, false, err
 		}
+		return dConn, false, nil
+	}
 
-		sConn := sudoku.NewConn(rawRemote, table, cfg.PaddingMin, cfg.PaddingMax, false)
-		cConn, err := crypto.NewAEADConn(sConn, cfg.Key, cfg.AEAD)
-		if err != nil {
-			rawRemote.Close()
-			return nil, false
-		}
+	tunnelConn, err := s.dialer.DialContext(ctx, "tcp", destAddrStr)
+	if err != nil {
+		log.Printf("[Proxy] Connect %s failed: %v", destAddrStr, err)
+		return nil, true, err
+	}
+	return tunnelConn, true, nil
+}
 
-		// 2. 握手逻辑
-		handshake := make([]byte, 16+1+32) // Expand buffer for potential UUID
-		binary.BigEndian.PutUint64(handshake[:8], uint64(time.Now().Unix()))
-		rand.Read(handshake[8:16])
+// httpErrorStatus 连接目标失败时返回给 HTTP 客户端的响应
+func httpErrorStatus(err error) string {
+	if protocol.ReplyFor(err) == protocol.ReplyTimeout {
+		return "HTTP/1.1 504 Gateway Timeout\r\n\r\n"
+	}
+	return "HTTP/1.1 502 Bad Gateway\r\n\r\n"
+}
 
-		var splitUUID string
+// openClientSession 登记一个本地代理会话
+func openClientSession(conn net.Conn, target string, proxied bool, cfg *config.Config) *admin.Session {
+	user := ""
+	if cfg.User != nil {
+		user = cfg.User.Name
+	}
+	sess := clientSessions.Open(conn.RemoteAddr().String(), user, proxied && cfg.EnableMieru)
+	sess.SetTarget(target)
+	return sess
+}
 
-		if _, err := cConn.Write(handshake[:16]); err != nil {
-			cConn.Close()
-			return nil, false
+// shouldProxy 根据代理模式与 PAC 规则决定目标是否走代理
+func shouldProxy(ctx context.Context, destAddrStr string, destIP net.IP, cfg *config.Config, geoMgr *geodata.Manager) bool {
+	switch cfg.ProxyMode {
+	case "direct":
+		return false
+	case "pac":
+		proxy := pacShouldProxy(ctx, destAddrStr, destIP, geoMgr)
+		if proxy {
+			metrics.PACDecisions.With("proxy").Inc()
+		} else {
+			metrics.PACDecisions.With("direct").Inc()
 		}
+		return proxy
+	default:
+		return true
+	}
+}
 
-		// *** Split Mode Logic ***
-		if cfg.EnableMieru {
-			splitUUID = hybrid.GenerateUUID()
-			// 发送 Split 标志 (0xFF) + UUID
-			// 标记位：0x01 = Standard, 0x02 = Split Tunnel
-			magic := []byte{0xFF}
-			uuidBytes := []byte(splitUUID) // hex string usually 32 bytes
-			lenByte := byte(len(uuidBytes))
-
-			// 发送 [Magic][Len][UUID]
-			cConn.Write(magic)
-			cConn.Write([]byte{lenByte})
-			cConn.Write(uuidBytes)
-
-			// 3. 建立 Mieru Downlink
-
-			mConn, err := mgr.DialMieruForDownlink(splitUUID)
-			if err != nil {
-				log.Printf("[Split] Failed to dial Mieru: %v", err)
-				cConn.Close()
-				return nil, false
-			}
-
-			// 4. 组合连接
-			// Sudoku (cConn) 用于写 (上行)
-			// Mieru (mConn) 用于读 (下行)
-
-			// 创建混合连接对象
-			hybridConn := &hybrid.SplitConn{
-				Conn:   cConn, // 基础接口用 Sudoku
-				Writer: cConn,
-				Reader: mConn,
-				CloseFn: func() error {
-					e1 := cConn.Close()
-					e2 := mConn.Close()
-					if e1 != nil {
-						return e1
-					}
-					return e2
-				},
-			}
-
-			// 5. 发送目标地址 (通过 Sudoku 上行发送)
-			if err := protocol.WriteAddress(hybridConn, destAddrStr); err != nil {
-				hybridConn.Close()
-				return nil, false
-			}
-
-			return hybridConn, true
-
-		} else {
-			// 标准模式
-			if err := protocol.WriteAddress(cConn, destAddrStr); err != nil {
-				cConn.Close()
-				return nil, false
-			}
-			return cConn, true
+// pacShouldProxy 按规则判断目标是否走代理，域名解析最多 2 秒并随 ctx 取消
+func pacShouldProxy(ctx context.Context, destAddrStr string, destIP net.IP, geoMgr *geodata.Manager) bool {
+	// 1. 检查域名或已知 IP 是否在 CN 列表
+	if geoMgr.IsCN(destAddrStr, destIP) {
+		log.Printf("[PAC] %s -> DIRECT (Rule Match)", destAddrStr)
+		return false
+	}
+	// 2. 如果没有匹配且 destIP 未知 (是域名)，尝试解析 IP 再检查
+	if destIP != nil {
+		log.Printf("[PAC] %s -> PROXY", destAddrStr)
+		return true
+	}
+	host, _, _ := net.SplitHostPort(destAddrStr)
+	lookupCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	ips, err := net.DefaultResolver.LookupIP(lookupCtx, "ip4", host)
+	cancel()
+
+	if err == nil && len(ips) > 0 {
+		if geoMgr.IsCN(destAddrStr, ips[0]) {
+			log.Printf("[PAC] %s (%s) -> DIRECT (IP Rule Match)", destAddrStr, ips[0])
+			return false
 		}
+		log.Printf("[PAC] %s (%s) -> PROXY", destAddrStr, ips[0])
 	} else {
-		// 直连
-		dConn, err := net.DialTimeout("tcp", destAddrStr, 5*time.Second)
-		if err != nil {
-			log.Printf("[Direct] Dial Failed: %v", err)
-			return nil, false
-		}
-		return dConn, true
+		// 解析失败或无 IP，默认代理
+		log.Printf("[PAC] %s -> PROXY (Default)", destAddrStr)
+	}
+	return true
+}
+
+// limitTunnel 对出站连接限速: 读取为下行，写入为上行
+func limitTunnel(c net.Conn) net.Conn {
+	if clientLimit == nil {
+		return c
 	}
+	up, down := clientLimit.Buckets("")
+	return ratelimit.NewConn(c, down, up)
 }
 
-func startPipe(c1, c2 net.Conn) {
+// startPipe 在本地连接 c1 与出站连接 c2 之间双向转发，结束时注销会话
+func startPipe(c1, c2 net.Conn, sess *admin.Session) {
+	defer sess.Done()
+	sess.AddCloser(c1, c2)
+	c1 = sess.WrapConn(c1)
+	c2 = limitTunnel(c2)
 	go func() {
 		io.Copy(c1, c2)
 		c1.Close()
@@ -0,0 +1,149 @@
+// internal/app/client_test.go
+package app
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Futaiii/Sudoku_ASCII/internal/config"
+	tunnel "github.com/Futaiii/Sudoku_ASCII/pkg/sudoku"
+)
+
+// directState 直连模式的客户端状态，不经过隧道
+func directState() *clientState {
+	return &clientState{cfg: &config.Config{ProxyMode: "direct", Timeouts: &config.TimeoutConfig{Connect: 5}}}
+}
+
+// proxyHTTP 在内存连接上运行 handleHTTP，返回客户端一侧
+func proxyHTTP(t *testing.T) net.Conn {
+	t.Helper()
+	client, local := net.Pipe()
+	go handleHTTP(local, directState())
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// upstream 启动只接受一个连接的目标服务器，handle 在其上运行
+func upstream(t *testing.T, handle func(net.Conn)) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		handle(c)
+	}()
+	return l.Addr().String()
+}
+
+// TestHandleHTTPPostBody 连接目标期间到达的请求体完整、按序转发到目标
+func TestHandleHTTPPostBody(t *testing.T) {
+	// 经由隧道连接，服务端应答前拨号一直进行中
+	srvCfg := &config.Config{Mode: "server", Key: "test-key", AEAD: "chacha20-poly1305"}
+	if err := srvCfg.Normalize(); err != nil {
+		t.Fatal(err)
+	}
+	table, err := tunnel.NewTable(srvCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := tunnel.NewListener(inner, srvCfg, table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	cliCfg := &config.Config{Mode: "client", Key: "test-key", AEAD: "chacha20-poly1305", ServerAddress: inner.Addr().String(), ProxyMode: "global", HandshakeVersion: 2}
+	d, err := tunnel.NewDialer(cliCfg, table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	client, local := net.Pipe()
+	defer client.Close()
+	go handleHTTP(local, &clientState{cfg: cliCfg, table: table, dialer: d})
+	go io.Copy(io.Discard, client)
+
+	client.Write([]byte("POST http://example.com/submit HTTP/1.1\r\nHost: example.com\r\nContent-Length: 5\r\n\r\n"))
+	s, err := l.AcceptStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	// 内存连接没有缓冲，请求体在读取前一直阻塞写入方
+	go client.Write([]byte("hello"))
+	time.Sleep(50 * time.Millisecond)
+	s.Reply(nil)
+
+	s.SetReadDeadline(time.Now().Add(5 * time.Second))
+	req, err := http.ReadRequest(bufio.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, err := io.ReadAll(req.Body); err != nil || string(body) != "hello" {
+		t.Fatalf("upstream body = %q, %v, want %q", body, err, "hello")
+	}
+}
+
+// TestHandleHTTPConnectEarlyData 与 CONNECT 请求一同到达的数据不被丢弃
+func TestHandleHTTPConnectEarlyData(t *testing.T) {
+	received := make(chan string, 1)
+	addr := upstream(t, func(c net.Conn) {
+		buf := make([]byte, len("early"))
+		io.ReadFull(c, buf)
+		received <- string(buf)
+	})
+
+	client := proxyHTTP(t)
+	go io.Copy(io.Discard, client)
+	client.Write([]byte("CONNECT " + addr + " HTTP/1.1\r\nHost: " + addr + "\r\n\r\nearly"))
+
+	select {
+	case got := <-received:
+		if got != "early" {
+			t.Fatalf("upstream received %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("early data was not forwarded")
+	}
+}
+
+// TestHandleHTTPPipelined 流水线中的后续请求只转发一次且顺序不变
+func TestHandleHTTPPipelined(t *testing.T) {
+	received := make(chan string, 1)
+	addr := upstream(t, func(c net.Conn) {
+		c.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+		data, _ := io.ReadAll(c)
+		received <- string(data)
+	})
+
+	client := proxyHTTP(t)
+	go io.Copy(io.Discard, client)
+	client.Write([]byte("GET http://" + addr + "/a HTTP/1.1\r\nHost: " + addr + "\r\n\r\n" +
+		"GET /b HTTP/1.1\r\nHost: " + addr + "\r\n\r\n"))
+
+	select {
+	case got := <-received:
+		a, b := strings.Index(got, "GET /a "), strings.Index(got, "GET /b ")
+		if a < 0 || b < a || strings.Count(got, "GET /b ") != 1 {
+			t.Fatalf("upstream received %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("upstream received nothing")
+	}
+}
@@ -0,0 +1,102 @@
+// internal/app/reload.go
+package app
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+
+	"github.com/Futaiii/Sudoku_ASCII/internal/config"
+	"github.com/Futaiii/Sudoku_ASCII/pkg/obfs/sudoku"
+	tunnel "github.com/Futaiii/Sudoku_ASCII/pkg/sudoku"
+)
+
+// reloadConfig 重新读取并校验配置文件
+// key / layout / custom_layout / permute_layout / grid 变化时重建数独表，否则沿用旧表；监听端口等需要重启的项保持旧值并给出提示
+func reloadConfig(old *config.Config, oldTable *sudoku.Table) (*config.Config, *sudoku.Table, error) {
+	cfg, err := config.Load(old.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg.Mode != old.Mode {
+		return nil, nil, fmt.Errorf("mode cannot change from %q to %q", old.Mode, cfg.Mode)
+	}
+
+	restartOnly := func(name string, changed bool) {
+		if changed {
+			log.Printf("[Reload] %s changed, restart required to apply", name)
+		}
+	}
+	restartOnly("local_port", cfg.LocalPort != old.LocalPort)
+	restartOnly("metrics_address", cfg.MetricsAddr != old.MetricsAddr)
+	restartOnly("admin_address / admin_token", cfg.AdminAddr != old.AdminAddr || cfg.AdminToken != old.AdminToken)
+	restartOnly("accounting.file", cfg.Accounting.File != old.Accounting.File)
+	restartOnly("ban.file", cfg.Ban.File != old.Ban.File)
+	// Mieru 服务端 / 客户端在启动时建立，新连接须继续使用与之一致的配置
+	restartOnly("enable_mieru / mieru_config", cfg.EnableMieru != old.EnableMieru ||
+		(cfg.MieruConfig != nil && old.MieruConfig != nil && *cfg.MieruConfig != *old.MieruConfig))
+	cfg.EnableMieru = old.EnableMieru
+	cfg.MieruConfig = old.MieruConfig
+	if cfg.EnableMieru {
+		// Mieru 下行固定连接启动时的服务端
+		restartOnly("server_address (split mode)", cfg.ServerAddress != old.ServerAddress)
+		cfg.ServerAddress = old.ServerAddress
+		// Mieru 服务端的账号在启动时按 users 注册，新增或改密的用户在重启前无法建立分离下行
+		if cfg.Mode == "server" && !sameAccounts(cfg.Users, old.Users) {
+			log.Printf("[Reload] users changed, Mieru downlink keeps the accounts from startup: restart required for new or re-keyed users to use split mode")
+		}
+	}
+	// 防重放缓存按旧窗口建立，中途修改会留下可重放的空档
+	restartOnly("replay_window / replay_cache_size", cfg.ReplayWindow != old.ReplayWindow || cfg.ReplayCacheSize != old.ReplayCacheSize)
+	cfg.ReplayWindow = old.ReplayWindow
+	cfg.ReplayCacheSize = old.ReplayCacheSize
+
+	table := oldTable
+	if cfg.Key != old.Key || cfg.Layout != old.Layout || cfg.PermuteLayout != old.PermuteLayout || cfg.Grid != old.Grid ||
+		(cfg.CustomLayout != nil && (old.CustomLayout == nil || *cfg.CustomLayout != *old.CustomLayout)) {
+		if table, err = tunnel.NewTable(cfg); err != nil {
+			return nil, nil, err
+		}
+		log.Printf("[Reload] Rebuilt Sudoku table (Grid: %s, Layout: %s)", cfg.Grid, cfg.Layout)
+	}
+	return cfg, table, nil
+}
+
+// sameAccounts 比较两组用户的名称与密钥，忽略配额等可热更新的字段
+func sameAccounts(a, b []config.UserConfig) bool {
+	return slices.EqualFunc(a, b, func(x, y config.UserConfig) bool {
+		return x.Name == y.Name && x.Key == y.Key
+	})
+}
+
+// reloader 串行执行热更新，由 SIGHUP 与管理接口共同触发
+type reloader struct {
+	mu sync.Mutex
+	fn func() error
+}
+
+func (r *reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.fn(); err != nil {
+		log.Printf("[Reload] Failed: %v", err)
+		return err
+	}
+	return nil
+}
+
+// watchSIGHUP 收到 SIGHUP 时执行热更新
+func (r *reloader) watchSIGHUP() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		for range ch {
+			log.Printf("[Reload] SIGHUP received")
+			r.Reload()
+		}
+	}()
+}
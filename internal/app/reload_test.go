@@ -0,0 +1,90 @@
+// internal/app/reload_test.go
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Futaiii/Sudoku_ASCII/internal/config"
+	tunnel "github.com/Futaiii/Sudoku_ASCII/pkg/sudoku"
+)
+
+func writeConfig(t *testing.T, path, body string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeConfig(t, path, `{"mode": "server", "local_port": 8080, "key": "k1", "fallback_address": "127.0.0.1:80", "replay_window": 60}`)
+	old, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldTable, err := tunnel.NewTable(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 只改回落地址: 沿用旧表；防重放窗口保持启动时的值
+	writeConfig(t, path, `{"mode": "server", "local_port": 8080, "key": "k1", "fallback_address": "127.0.0.1:81", "replay_window": 120}`)
+	cfg, table, err := reloadConfig(old, oldTable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if table != oldTable {
+		t.Fatal("table rebuilt although key and layout are unchanged")
+	}
+	if cfg.FallbackAddr != "127.0.0.1:81" {
+		t.Fatalf("FallbackAddr = %s", cfg.FallbackAddr)
+	}
+	if cfg.ReplayWindow != 60 {
+		t.Fatalf("ReplayWindow = %d, want the startup value 60", cfg.ReplayWindow)
+	}
+
+	// 改 key: 重建数独表
+	writeConfig(t, path, `{"mode": "server", "local_port": 8080, "key": "k2", "fallback_address": "127.0.0.1:81"}`)
+	if _, table, err = reloadConfig(old, oldTable); err != nil {
+		t.Fatal(err)
+	}
+	if table == oldTable {
+		t.Fatal("table not rebuilt after key change")
+	}
+
+	// 校验失败或切换模式时保留旧配置
+	for _, body := range []string{
+		`{"mode": "client", "local_port": 1080, "key": "k1", "server_address": "127.0.0.1:8080"}`,
+		`{"mode": "server", "local_port": 8080, "key": "k1", "grid": "5x5"}`,
+		`{not json`,
+	} {
+		writeConfig(t, path, body)
+		if _, _, err := reloadConfig(old, oldTable); err == nil {
+			t.Errorf("reloadConfig(%s) succeeded", body)
+		}
+	}
+}
+
+func TestReloaderSerializes(t *testing.T) {
+	running := 0
+	r := &reloader{fn: func() error {
+		running++
+		defer func() { running-- }()
+		if running != 1 {
+			t.Error("reloads overlapped")
+		}
+		return nil
+	}}
+	done := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		go func() {
+			r.Reload()
+			done <- struct{}{}
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		<-done
+	}
+}
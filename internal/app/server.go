@@ -2,175 +2,229 @@
 package app
 
 import (
-	"encoding/binary"
+	"context"
 	"fmt"
 	"io"
 	"log"
 	"net"
+	"sync/atomic"
 	"time"
 
+	"github.com/Futaiii/Sudoku_ASCII/internal/accounting"
+	"github.com/Futaiii/Sudoku_ASCII/internal/acl"
+	"github.com/Futaiii/Sudoku_ASCII/internal/admin"
 	"github.com/Futaiii/Sudoku_ASCII/internal/config"
-	"github.com/Futaiii/Sudoku_ASCII/internal/handler"
 	"github.com/Futaiii/Sudoku_ASCII/internal/hybrid"
-	"github.com/Futaiii/Sudoku_ASCII/internal/protocol"
-	"github.com/Futaiii/Sudoku_ASCII/pkg/crypto"
+	"github.com/Futaiii/Sudoku_ASCII/internal/metrics"
+	"github.com/Futaiii/Sudoku_ASCII/internal/ratelimit"
 	"github.com/Futaiii/Sudoku_ASCII/pkg/obfs/sudoku"
+	tunnel "github.com/Futaiii/Sudoku_ASCII/pkg/sudoku"
 )
 
-const HandshakeTimeout = 5 * time.Second
+// udpDestination UDP 关联在流量统计中的目标名
+const udpDestination = "(udp)"
 
 func RunServer(cfg *config.Config, table *sudoku.Table) {
-	mgr := hybrid.GetInstance(cfg)
-	if err := mgr.StartMieruServer(); err != nil {
-		log.Fatalf("Failed to start Mieru Server: %v", err)
-	}
+	started := time.Now()
 
 	l, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.LocalPort))
 	if err != nil {
 		log.Fatal(err)
 	}
-	log.Printf("Server on :%d (Fallback: %s)", cfg.LocalPort, cfg.FallbackAddr)
-
-	for {
-		c, err := l.Accept()
-		if err != nil {
-			continue
-		}
-		go handleServerConn(c, cfg, table, mgr)
+	tl, err := tunnel.NewListener(l, cfg, table)
+	if err != nil {
+		log.Fatalf("Failed to start server: %v", err)
 	}
-}
-
-func handleServerConn(rawConn net.Conn, cfg *config.Config, table *sudoku.Table, mgr *hybrid.Manager) {
-	// 1. Sudoku 层 (开启记录以支持回落)
-	sConn := sudoku.NewConn(rawConn, table, cfg.PaddingMin, cfg.PaddingMax, true)
-
-	// 2. 加密层
-	cConn, err := crypto.NewAEADConn(sConn, cfg.Key, cfg.AEAD)
+	rules, err := acl.New(cfg.ACL)
 	if err != nil {
-		rawConn.Close()
-		return
+		log.Fatalf("Invalid ACL: %v", err)
 	}
 
-	defer cConn.Close()
-
-	// 3. 验证握手
-	handshakeBuf := make([]byte, 16)
-	rawConn.SetReadDeadline(time.Now().Add(HandshakeTimeout))
-	_, err = io.ReadFull(cConn, handshakeBuf)
-	rawConn.SetReadDeadline(time.Time{})
-
-	if err != nil {
-		log.Printf("[Security] Handshake fail: %v", err)
-		handler.HandleSuspicious(sConn, rawConn, cfg)
-		return
+	st := &serverState{
+		cfg:      cfg,
+		table:    table,
+		listener: tl,
+		acl:      rules,
+		ledger:   accounting.NewLedger(cfg.Accounting.File, cfg.Accounting.MaxDestinations),
+		limit:    ratelimit.NewLimiter(cfg),
+		sessions: admin.NewRegistry(),
 	}
+	st.ledger.SetQuotas(userQuotas(cfg.Users))
+	go st.ledger.Run(time.Duration(cfg.Accounting.FlushInterval) * time.Second)
 
-	ts := int64(binary.BigEndian.Uint64(handshakeBuf[:8]))
-	if abs(time.Now().Unix()-ts) > 60 {
-		log.Printf("[Security] Time skew/Replay")
-		handler.HandleSuspicious(sConn, rawConn, cfg)
-		return
+	// 超出配额的用户拒绝新的握手
+	tl.Quota = func(user string) error {
+		if exceeded, period := st.ledger.Exceeded(user); exceeded {
+			return fmt.Errorf("%s quota exceeded", period)
+		}
+		return nil
 	}
 
-	// 握手成功，停止记录
-	sConn.StopRecording()
+	// 热更新: 新连接使用新状态，已建立的连接保留各自的旧状态
+	var current atomic.Pointer[serverState]
+	current.Store(st)
+	rl := &reloader{fn: func() error {
+		next, err := current.Load().reload()
+		if err != nil {
+			return err
+		}
+		current.Store(next)
+		return nil
+	}}
+	rl.watchSIGHUP()
 
-	// *** Detect Split Tunneling ***
-	// 预读一个字节查看是否是 Magic 0xFF
-	magicBuf := make([]byte, 1)
-	if _, err := io.ReadFull(cConn, magicBuf); err != nil {
-		return
+	if err := metrics.Serve(cfg.MetricsAddr); err != nil {
+		log.Fatalf("Failed to start metrics endpoint: %v", err)
+	}
+	if err := (&admin.Server{Sessions: st.sessions, Reload: rl.Reload, Token: cfg.AdminToken}).Start(cfg.AdminAddr); err != nil {
+		log.Fatalf("Failed to start admin API: %v", err)
 	}
 
-	var downstreamConn net.Conn = cConn // 默认为全双工 Sudoku
-	var upstreamConn net.Conn = cConn
+	log.Printf("Server on :%d (Fallback: %s, Users: %d)", cfg.LocalPort, cfg.FallbackAddr, len(cfg.Users))
 
-	if magicBuf[0] == 0xFF && cfg.EnableMieru {
-		// Split Mode!
-		// 读取 UUID
-		lenBuf := make([]byte, 1)
-		io.ReadFull(cConn, lenBuf)
-		uuidBuf := make([]byte, int(lenBuf[0]))
-		io.ReadFull(cConn, uuidBuf)
-		uuid := string(uuidBuf)
+	serveUntilSignal(tl, func(c net.Conn) {
+		go serveStream(c.(*tunnel.Stream), current.Load())
+	})
 
-		log.Printf("[Server] Split request UUID: %s, waiting for Mieru...", uuid)
+	timeout := time.Duration(current.Load().cfg.ShutdownTimeout) * time.Second
+	drain(st.sessions, timeout, hybrid.GetInstance(cfg), started)
+	if err := st.ledger.Flush(); err != nil {
+		log.Printf("[Accounting] Flush failed: %v", err)
+	}
+}
 
-		// 等待 Mieru 连接
-		mConn, err := mgr.RegisterSudokuConn(uuid)
-		if err != nil {
-			log.Printf("[Server] Pairing failed: %v", err)
-			return
-		}
+// serverState 服务端各连接共享的运行期状态
+// 热更新时整体复制出新的一份，listener / ledger / limit / sessions 在新旧状态间共享
+type serverState struct {
+	cfg      *config.Config
+	table    *sudoku.Table
+	listener *tunnel.Listener
+	acl      *acl.ACL
+	ledger   *accounting.Ledger
+	limit    *ratelimit.Limiter
+	sessions *admin.Registry
+}
 
-		// 成功配对
-		downstreamConn = mConn
+// reload 读取配置文件，返回用于新连接的状态
+func (st *serverState) reload() (*serverState, error) {
+	cfg, table, err := reloadConfig(st.cfg, st.table)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := acl.New(cfg.ACL)
+	if err != nil {
+		return nil, err
+	}
+	if err := st.listener.Update(cfg, table); err != nil {
+		return nil, err
+	}
 
-		// 完整读取 "BIND" 这
-		discardBuf := make([]byte, 4)
-		if _, err := io.ReadFull(mConn, discardBuf); err != nil {
-			log.Printf("[Server] Failed to read BIND magic from Mieru: %v", err)
-			mConn.Close()
-			return
-		}
+	next := *st
+	next.cfg = cfg
+	next.table = table
+	next.acl = rules
+	next.ledger.SetQuotas(userQuotas(cfg.Users))
+	next.limit.Update(cfg)
 
-	} else {
+	log.Printf("[Reload] Server config reloaded (Fallback: %s, Users: %d)", cfg.FallbackAddr, len(cfg.Users))
+	return &next, nil
+}
 
-		// 重新封装一下
-		upstreamConn = &PreBufferedConn{Conn: cConn, buf: magicBuf}
+func userQuotas(users []config.UserConfig) map[string]accounting.Quota {
+	quotas := make(map[string]accounting.Quota)
+	for _, u := range users {
+		if u.DailyQuotaMB > 0 || u.MonthlyQuotaMB > 0 {
+			quotas[u.Name] = accounting.QuotaMB(u.DailyQuotaMB, u.MonthlyQuotaMB)
+		}
 	}
+	return quotas
+}
 
-	// 4. 读取目标地址 (从上行连接读取)
-	destAddrStr, _, _, err := protocol.ReadAddress(upstreamConn)
-	if err != nil {
-		log.Printf("[Server] Failed to read target address: %v", err)
+// serveStream 处理一条已认证的逻辑流: UDP 关联或 TCP 代理
+func serveStream(s *tunnel.Stream, st *serverState) {
+	defer s.Close()
+
+	// 限速: 上行限制读取，下行限制写入 (分离模式下即 Mieru 下行)
+	up, down := st.limit.Buckets(s.User)
+	var conn net.Conn = ratelimit.NewConn(s, up, down)
+
+	// 登记到管理接口，Kill 时关闭连接
+	sess := st.sessions.Open(s.RemoteAddr().String(), s.User, s.Split)
+	defer sess.Done()
+	sess.AddCloser(conn)
+
+	// *** UDP Associate ***
+	if s.Network == "udp" {
+		sess.SetTarget(udpDestination)
+		log.Printf("[Server] UDP associate from %s (User: %s, Split: %v)", s.RemoteAddr(), s.User, s.Split)
+		udpConn := st.ledger.WrapConn(conn, s.User, udpDestination, sess.Count)
+		defer udpConn.Close()
+		relayUDP(udpConn, udpConn, func(addr string) (*net.UDPAddr, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(st.cfg.Timeouts.Connect)*time.Second)
+			defer cancel()
+			addrs, err := st.acl.Resolve(ctx, s.User, addr)
+			if err != nil {
+				return nil, err
+			}
+			return net.ResolveUDPAddr("udp", addrs[0])
+		})
 		return
 	}
 
-	log.Printf("[Server] Connecting to %s (Split: %v)", destAddrStr, downstreamConn != cConn)
+	destAddrStr := s.Destination
+	log.Printf("[Server] Connecting to %s (User: %s, Split: %v)", destAddrStr, s.User, s.Split)
+	sess.SetTarget(destAddrStr)
+
+	// 按用户与目标主机统计流量，会话计数一并由账本汇报
+	destHost, _, _ := net.SplitHostPort(destAddrStr)
+	conn = st.ledger.WrapConn(conn, s.User, destHost, sess.Count)
 
-	target, err := net.DialTimeout("tcp", destAddrStr, 10*time.Second)
+	target, err := dialDestination(st, s.User, destAddrStr)
+	s.Reply(err)
 	if err != nil {
+		log.Printf("[Server] Connect %s failed: %v", destAddrStr, err)
 		return
 	}
 	defer target.Close()
+	sess.AddCloser(target)
 
-	// 6. 转发数据
+	// 转发数据
 	// 上行: Client (Sudoku) -> Target
+	upDone := make(chan int64, 1)
 	go func() {
 		buf := make([]byte, 32*1024)
-		io.CopyBuffer(target, upstreamConn, buf)
+		n, _ := io.CopyBuffer(target, conn, buf)
 		target.Close()
+		upDone <- n
 	}()
 
 	// 下行: Target -> Client (Mieru if split, else Sudoku)
 	buf2 := make([]byte, 32*1024)
-	io.CopyBuffer(downstreamConn, target, buf2)
+	downBytes, _ := io.CopyBuffer(conn, target, buf2)
 
-	// 清理
-	if downstreamConn != cConn {
-		downstreamConn.Close()
-	}
-}
+	// 下行结束后关闭上行，等待上行统计完成
+	conn.Close()
+	upBytes := <-upDone
 
-// Helper for peeking
-type PreBufferedConn struct {
-	net.Conn
-	buf []byte
+	log.Printf("[Server] Closed %s (User: %s, Up: %d, Down: %d)", destAddrStr, s.User, upBytes, downBytes)
 }
 
-func (p *PreBufferedConn) Read(b []byte) (int, error) {
-	if len(p.buf) > 0 {
-		n := copy(b, p.buf)
-		p.buf = p.buf[n:]
-		return n, nil
-	}
-	return p.Conn.Read(b)
-}
+// dialDestination 解析目标并按 ACL 过滤，依次尝试允许的地址
+// 连接已校验过的 IP 而非再次解析域名，避免 DNS 重绑定绕过 ACL
+func dialDestination(st *serverState, user, dest string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(st.cfg.Timeouts.Connect)*time.Second)
+	defer cancel()
 
-func abs(x int64) int64 {
-	if x < 0 {
-		return -x
+	addrs, err := st.acl.Resolve(ctx, user, dest)
+	if err != nil {
+		return nil, err
+	}
+	var nd net.Dialer
+	for _, addr := range addrs {
+		var conn net.Conn
+		if conn, err = nd.DialContext(ctx, "tcp", addr); err == nil {
+			return conn, nil
+		}
 	}
-	return x
+	return nil, err
 }
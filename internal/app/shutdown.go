@@ -0,0 +1,65 @@
+// internal/app/shutdown.go
+package app
+
+import (
+	"errors"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Futaiii/Sudoku_ASCII/internal/admin"
+	"github.com/Futaiii/Sudoku_ASCII/internal/hybrid"
+	"github.com/Futaiii/Sudoku_ASCII/internal/netutil"
+)
+
+// serveUntilSignal 接受连接直到收到 SIGINT / SIGTERM，随后关闭监听并返回
+// 排空期间再次收到信号则立即退出
+func serveUntilSignal(l net.Listener, handle func(net.Conn)) {
+	sig := make(chan os.Signal, 2)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		var delay time.Duration
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				delay = netutil.AcceptBackoff(delay)
+				log.Printf("Accept error: %v; retrying in %v", err, delay)
+				time.Sleep(delay)
+				continue
+			}
+			delay = 0
+			handle(c)
+		}
+	}()
+
+	s := <-sig
+	log.Printf("[Shutdown] %v received, no longer accepting connections", s)
+	l.Close()
+
+	go func() {
+		s := <-sig
+		log.Printf("[Shutdown] %v received again, exiting immediately", s)
+		os.Exit(1)
+	}()
+}
+
+// drain 等待活动会话结束 (最多 timeout)，随后停止 Mieru 并输出汇总
+func drain(sessions *admin.Registry, timeout time.Duration, mgr *hybrid.Manager, started time.Time) {
+	active := sessions.Len()
+	if active > 0 {
+		log.Printf("[Shutdown] Waiting up to %v for %d active session(s)", timeout, active)
+	}
+	forced := sessions.Drain(timeout)
+
+	mgr.Stop()
+
+	log.Printf("[Shutdown] Done. Uptime: %v, Sessions served: %d, Drained: %d, Forced closed: %d",
+		time.Since(started).Round(time.Second), sessions.Total(), active-forced, forced)
+}
@@ -0,0 +1,43 @@
+// internal/app/shutdown_test.go
+package app
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Futaiii/Sudoku_ASCII/internal/admin"
+	"github.com/Futaiii/Sudoku_ASCII/internal/hybrid"
+)
+
+// TestDrain 先结束的会话计为排空，超时后仍活动的会话被强制关闭
+func TestDrain(t *testing.T) {
+	reg := admin.NewRegistry()
+
+	quick := reg.Open("192.0.2.1:1", "", false)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		quick.Done()
+	}()
+
+	stuck := reg.Open("192.0.2.2:1", "", false)
+	a, b := net.Pipe()
+	defer b.Close()
+	stuck.AddCloser(a)
+	closed := make(chan struct{})
+	go func() {
+		a.Read(make([]byte, 1))
+		stuck.Done()
+		close(closed)
+	}()
+
+	drain(reg, 300*time.Millisecond, &hybrid.Manager{}, time.Now())
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("stuck session was not closed after the drain timeout")
+	}
+	if reg.Len() != 0 {
+		t.Fatalf("%d session(s) left", reg.Len())
+	}
+}
@@ -0,0 +1,289 @@
+// internal/app/udp.go
+package app
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/netip"
+	"sync"
+
+	"github.com/Futaiii/Sudoku_ASCII/internal/protocol"
+)
+
+// udpResolveCacheSize 单个 UDP 关联内缓存的目标地址解析结果上限
+const udpResolveCacheSize = 256
+
+// udpPeerLimit 单个 UDP 关联内允许回包的目标地址上限，超出时淘汰最久未发送的目标
+const udpPeerLimit = 1024
+
+// ==== Client Side ====
+
+// handleUDPAssociate 处理 SOCKS5 UDP ASSOCIATE
+// 本地开启一个 UDP 端口接收应用的数据报，通过隧道以 Datagram 帧转发给服务端，
+// 生命周期与 SOCKS5 控制连接一致
+func handleUDPAssociate(conn net.Conn, s *clientState) {
+	var bindIP net.IP
+	if tcpAddr, ok := conn.LocalAddr().(*net.TCPAddr); ok {
+		bindIP = tcpAddr.IP
+	}
+	var clientIP net.IP
+	if tcpAddr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		clientIP = tcpAddr.IP
+	}
+
+	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: bindIP})
+	if err != nil {
+		log.Printf("[UDP] Listen failed: %v", err)
+		conn.Write([]byte{0x05, 0x01, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer udpConn.Close()
+
+	ctx, stop := watchClient(conn)
+	tunnelConn, err := dialUDPTunnel(ctx, s)
+	conn = stop()
+	if err != nil {
+		conn.Write([]byte{0x05, protocol.SocksReply(protocol.ReplyFor(err)), 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer tunnelConn.Close()
+
+	// SOCKS5 Success，BND.ADDR 为本地 UDP 中继地址
+	reply := bytes.NewBuffer([]byte{0x05, 0x00, 0x00})
+	if err := protocol.WriteAddress(reply, udpConn.LocalAddr().String()); err != nil {
+		return
+	}
+	if _, err := conn.Write(reply.Bytes()); err != nil {
+		return
+	}
+	log.Printf("[UDP] Associate %s via %s", conn.RemoteAddr(), udpConn.LocalAddr())
+
+	sess := openClientSession(conn, udpDestination, s.cfg.ProxyMode != "direct", s.cfg)
+	defer sess.Done()
+	sess.AddCloser(conn, udpConn, tunnelConn)
+	tunnelConn = sess.WrapTunnel(tunnelConn)
+
+	var (
+		peerMu   sync.Mutex
+		peerAddr *net.UDPAddr
+	)
+
+	// 上行: 应用 -> 隧道
+	go func() {
+		defer tunnelConn.Close()
+		buf := make([]byte, protocol.MaxDatagramSize)
+		for {
+			n, from, err := udpConn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			// 只接受来自 SOCKS5 客户端主机的数据报
+			if clientIP != nil && !clientIP.IsUnspecified() && !from.IP.Equal(clientIP) {
+				continue
+			}
+			addr, payload, err := parseSocksUDP(buf[:n])
+			if err != nil {
+				continue
+			}
+
+			peerMu.Lock()
+			peerAddr = from
+			peerMu.Unlock()
+
+			if err := protocol.WriteDatagram(tunnelConn, addr, payload); err != nil {
+				return
+			}
+		}
+	}()
+
+	// 下行: 隧道 -> 应用
+	go func() {
+		// 隧道断开时同时结束控制连接
+		defer conn.Close()
+		defer udpConn.Close()
+		var out bytes.Buffer
+		for {
+			addr, payload, err := protocol.ReadDatagram(tunnelConn)
+			if err != nil {
+				return
+			}
+			peerMu.Lock()
+			to := peerAddr
+			peerMu.Unlock()
+			if to == nil {
+				continue
+			}
+
+			out.Reset()
+			out.Write([]byte{0x00, 0x00, 0x00})
+			if err := protocol.WriteAddress(&out, addr); err != nil {
+				continue
+			}
+			out.Write(payload)
+			udpConn.WriteToUDP(out.Bytes(), to)
+		}
+	}()
+
+	// TCP 控制连接关闭即结束关联
+	io.Copy(io.Discard, conn)
+}
+
+// dialUDPTunnel 建立承载 UDP 关联的流
+// direct 模式下直接在本地中继，其余模式 (包括 pac) 全部经由服务端转发
+func dialUDPTunnel(ctx context.Context, s *clientState) (net.Conn, error) {
+	if s.cfg.ProxyMode == "direct" {
+		local, remote := net.Pipe()
+		go func() {
+			relayUDP(remote, remote, resolveUDP)
+			remote.Close()
+		}()
+		return limitTunnel(local), nil
+	}
+
+	tunnelConn, err := s.dialer.DialTunnel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tunnelConn.Write([]byte{protocol.UDPAssociateMagic}); err != nil {
+		tunnelConn.Close()
+		return nil, err
+	}
+	return limitTunnel(tunnelConn), nil
+}
+
+// parseSocksUDP 解析 SOCKS5 UDP 请求头
+// +----+------+------+----------+----------+----------+
+// |RSV | FRAG | ATYP | DST.ADDR | DST.PORT |   DATA   |
+// +----+------+------+----------+----------+----------+
+func parseSocksUDP(pkt []byte) (string, []byte, error) {
+	if len(pkt) < 4 {
+		return "", nil, errors.New("short socks5 udp packet")
+	}
+	if pkt[2] != 0x00 {
+		// 不支持分片
+		return "", nil, errors.New("socks5 udp fragmentation not supported")
+	}
+	r := bytes.NewReader(pkt[3:])
+	addr, _, _, err := protocol.ReadAddress(r)
+	if err != nil {
+		return "", nil, err
+	}
+	return addr, pkt[len(pkt)-r.Len():], nil
+}
+
+// ==== Server Side ====
+
+// resolveUDP 不做访问控制的目标解析 (客户端 direct 模式)
+func resolveUDP(addr string) (*net.UDPAddr, error) {
+	return net.ResolveUDPAddr("udp", addr)
+}
+
+// relayUDP 在隧道与真实 UDP 目标之间中继数据报
+// 每个关联独占一个 UDP Socket，目标的回包带上来源地址写回隧道，
+// 客户端据此还原 SOCKS5 UDP 头。只转发来自已发送过数据报的地址与端口的回包，
+// 其他主机即使猜到端口也无法向隧道注入数据
+// resolve 负责解析目标地址 (服务端在其中应用 ACL)，失败的目标在缓存中记为丢弃
+func relayUDP(upstream io.Reader, downstream io.Writer, resolve func(addr string) (*net.UDPAddr, error)) {
+	pc, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		log.Printf("[UDP] Relay listen failed: %v", err)
+		return
+	}
+	defer pc.Close()
+
+	peers := newPeerSet(udpPeerLimit)
+
+	// 下行: 目标 -> 隧道
+	go func() {
+		buf := make([]byte, protocol.MaxDatagramSize)
+		for {
+			n, from, err := pc.ReadFromUDPAddrPort(buf)
+			if err != nil {
+				return
+			}
+			from = netip.AddrPortFrom(from.Addr().Unmap(), from.Port())
+			if !peers.contains(from) {
+				continue
+			}
+			if err := protocol.WriteDatagram(downstream, from.String(), buf[:n]); err != nil {
+				pc.Close()
+				return
+			}
+		}
+	}()
+
+	// 上行: 隧道 -> 目标
+	resolved := make(map[string]*net.UDPAddr)
+	for {
+		addr, payload, err := protocol.ReadDatagram(upstream)
+		if err != nil {
+			return
+		}
+
+		udpAddr, ok := resolved[addr]
+		if !ok {
+			udpAddr, err = resolve(addr)
+			if err != nil && !errors.Is(err, protocol.ErrNotAllowed) {
+				log.Printf("[UDP] Resolve %s failed: %v", addr, err)
+				continue
+			}
+			if len(resolved) >= udpResolveCacheSize {
+				clear(resolved)
+			}
+			resolved[addr] = udpAddr
+		}
+		if udpAddr == nil {
+			// 被 ACL 拒绝的目标
+			continue
+		}
+
+		peer := udpAddr.AddrPort()
+		peer = netip.AddrPortFrom(peer.Addr().Unmap(), peer.Port())
+		peers.touch(peer)
+
+		if _, err := pc.WriteToUDP(payload, udpAddr); err != nil {
+			log.Printf("[UDP] Send to %s failed: %v", addr, err)
+		}
+	}
+}
+
+// peerSet 允许回包的目标地址集合，超出上限时淘汰最久未发送的目标，
+// 不会因一个目标过多的关联而丢掉仍在通信的目标
+type peerSet struct {
+	mu    sync.Mutex
+	limit int
+	order *list.List // 最近发送的在前
+	index map[netip.AddrPort]*list.Element
+}
+
+func newPeerSet(limit int) *peerSet {
+	return &peerSet{limit: limit, order: list.New(), index: make(map[netip.AddrPort]*list.Element)}
+}
+
+// touch 记录向 peer 发送了数据报
+func (p *peerSet) touch(peer netip.AddrPort) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if e, ok := p.index[peer]; ok {
+		p.order.MoveToFront(e)
+		return
+	}
+	if p.order.Len() >= p.limit {
+		oldest := p.order.Back()
+		p.order.Remove(oldest)
+		delete(p.index, oldest.Value.(netip.AddrPort))
+	}
+	p.index[peer] = p.order.PushFront(peer)
+}
+
+func (p *peerSet) contains(peer netip.AddrPort) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.index[peer]
+	return ok
+}
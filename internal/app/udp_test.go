@@ -0,0 +1,142 @@
+// internal/app/udp_test.go
+package app
+
+import (
+	"bytes"
+	"net"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Futaiii/Sudoku_ASCII/internal/protocol"
+)
+
+func TestParseSocksUDP(t *testing.T) {
+	tests := []struct {
+		name    string
+		pkt     []byte
+		addr    string // 空表示应当出错
+		payload string
+	}{
+		{"ipv4", []byte{0, 0, 0, 0x01, 192, 0, 2, 1, 0, 53, 'd', 'n', 's'}, "192.0.2.1:53", "dns"},
+		{"domain", append(append([]byte{0, 0, 0, 0x03, 4}, "a.io"...), 0x01, 0xBB, 'x'), "a.io:443", "x"},
+		{"ipv6", append(append([]byte{0, 0, 0, 0x04}, net.ParseIP("2001:db8::1")...), 0, 80), "[2001:db8::1]:80", ""},
+		{"fragment", []byte{0, 0, 1, 0x01, 192, 0, 2, 1, 0, 53, 'x'}, "", ""},
+		{"short", []byte{0, 0, 0}, "", ""},
+		{"bad address type", []byte{0, 0, 0, 0x02, 1, 2, 3, 4, 0, 53}, "", ""},
+		{"truncated address", []byte{0, 0, 0, 0x01, 192, 0, 2}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, payload, err := parseSocksUDP(tt.pkt)
+			if tt.addr == "" {
+				if err == nil {
+					t.Fatalf("parseSocksUDP = %s, want error", addr)
+				}
+				return
+			}
+			if err != nil || addr != tt.addr || string(payload) != tt.payload {
+				t.Fatalf("parseSocksUDP = %s, %q, %v, want %s, %q", addr, payload, err, tt.addr, tt.payload)
+			}
+		})
+	}
+}
+
+// TestRelayUDPDropsUnknownPeers 只有客户端发送过数据的目标能回包，其他来源的数据报被丢弃
+func TestRelayUDPDropsUnknownPeers(t *testing.T) {
+	target, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+	stranger, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stranger.Close()
+
+	local, remote := net.Pipe()
+	defer local.Close()
+	go relayUDP(remote, remote, resolveUDP)
+
+	if err := protocol.WriteDatagram(local, target.LocalAddr().String(), []byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 64)
+	target.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, relay, err := target.ReadFromUDP(buf)
+	if err != nil || string(buf[:n]) != "ping" {
+		t.Fatalf("target read = %q, %v", buf[:n], err)
+	}
+
+	// 陌生来源先到，随后目标回包；隧道上只应出现目标的回包
+	stranger.WriteToUDP([]byte("inject"), relay)
+	time.Sleep(50 * time.Millisecond)
+	target.WriteToUDP([]byte("pong"), relay)
+
+	local.SetReadDeadline(time.Now().Add(2 * time.Second))
+	from, payload, err := protocol.ReadDatagram(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from != target.LocalAddr().String() || !bytes.Equal(payload, []byte("pong")) {
+		t.Fatalf("tunnel got %q from %s, want pong from %s", payload, from, target.LocalAddr())
+	}
+}
+
+// TestPeerSetEvictsOldest 超出上限时只淘汰最久未发送的目标
+func TestPeerSetEvictsOldest(t *testing.T) {
+	a, b, c, d := netip.MustParseAddrPort("192.0.2.1:53"), netip.MustParseAddrPort("192.0.2.2:53"),
+		netip.MustParseAddrPort("192.0.2.3:53"), netip.MustParseAddrPort("192.0.2.4:53")
+	p := newPeerSet(2)
+	p.touch(a)
+	p.touch(b)
+	p.touch(c)
+	if p.contains(a) || !p.contains(b) || !p.contains(c) {
+		t.Fatal("adding c did not evict only a")
+	}
+	p.touch(b)
+	p.touch(d)
+	if p.contains(c) || !p.contains(b) || !p.contains(d) {
+		t.Fatal("adding d did not evict c, the least recently used")
+	}
+}
+
+// TestRelayUDPCachesDenied 被 ACL 拒绝的目标记入缓存，之后的数据报不再重新解析
+func TestRelayUDPCachesDenied(t *testing.T) {
+	target, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+
+	var denied atomic.Int32
+	resolve := func(addr string) (*net.UDPAddr, error) {
+		if addr == "denied.test:53" {
+			denied.Add(1)
+			return nil, protocol.ErrNotAllowed
+		}
+		return resolveUDP(addr)
+	}
+	local, remote := net.Pipe()
+	defer local.Close()
+	go relayUDP(remote, remote, resolve)
+
+	for range 3 {
+		if err := protocol.WriteDatagram(local, "denied.test:53", []byte("x")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 允许的目标收到数据时，之前的数据报均已处理
+	if err := protocol.WriteDatagram(local, target.LocalAddr().String(), []byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	target.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := target.ReadFromUDP(make([]byte, 64)); err != nil {
+		t.Fatal(err)
+	}
+	if n := denied.Load(); n != 1 {
+		t.Fatalf("denied destination resolved %d times, want 1", n)
+	}
+}
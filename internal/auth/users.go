@@ -0,0 +1,117 @@
+// internal/auth/users.go
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Futaiii/Sudoku_ASCII/internal/config"
+)
+
+const (
+	// HintSize 用户标识的长度
+	HintSize = 8
+	// HintPeriod 用户标识的轮换周期
+	HintPeriod = 30 * time.Second
+
+	// DefaultUserName 单用户模式 (未配置 users) 下的用户名
+	DefaultUserName = "default"
+)
+
+// Hint 用户标识，由用户密钥与时间片派生
+type Hint [HintSize]byte
+
+type User struct {
+	Name string
+	Key  string
+}
+
+// UserHint 计算指定时间片的用户标识
+// 标识只有持有该用户密钥才能生成，且每个周期变化一次，
+// 服务端可以预先计算所有用户的标识，以 O(1) 查表代替逐个试解密
+func UserHint(key string, period int64) Hint {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte("sudoku-user-hint"))
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(period))
+	mac.Write(buf[:])
+
+	var h Hint
+	copy(h[:], mac.Sum(nil))
+	return h
+}
+
+// CurrentHint 客户端使用的当前用户标识
+func CurrentHint(key string) Hint {
+	return UserHint(key, currentPeriod(time.Now()))
+}
+
+func currentPeriod(t time.Time) int64 {
+	return t.Unix() / int64(HintPeriod/time.Second)
+}
+
+// Users 服务端用户表
+// 维护覆盖时间偏差窗口的 "标识 -> 用户" 索引，周期变化时重建
+type Users struct {
+	users  []*User
+	window time.Duration
+
+	mu     sync.Mutex
+	period int64
+	index  map[Hint]*User
+}
+
+// NewUsers 根据配置创建用户表，未配置多用户时返回 nil
+// window 为握手允许的时间偏差，决定需要接受的前后时间片数量
+func NewUsers(list []config.UserConfig, window time.Duration) *Users {
+	if len(list) == 0 {
+		return nil
+	}
+	u := &Users{window: window, period: -1}
+	for _, uc := range list {
+		u.users = append(u.users, &User{Name: uc.Name, Key: uc.Key})
+	}
+	return u
+}
+
+// Lookup 根据握手中的标识查找用户
+func (u *Users) Lookup(h Hint) (*User, bool) {
+	return u.lookupAt(h, time.Now())
+}
+
+func (u *Users) lookupAt(h Hint, now time.Time) (*User, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if p := currentPeriod(now); p != u.period {
+		u.rebuild(p)
+	}
+	user, ok := u.index[h]
+	return user, ok
+}
+
+// All 返回全部用户
+func (u *Users) All() []*User {
+	return u.users
+}
+
+func (u *Users) rebuild(period int64) {
+	span := int64(u.window/HintPeriod) + 1
+	index := make(map[Hint]*User, len(u.users)*int(2*span+1))
+	for p := period - span; p <= period+span; p++ {
+		for _, user := range u.users {
+			h := UserHint(user.Key, p)
+			if other, dup := index[h]; dup && other != user {
+				log.Printf("[Auth] Hint collision between %s and %s", other.Name, user.Name)
+				continue
+			}
+			index[h] = user
+		}
+	}
+	u.index = index
+	u.period = period
+}
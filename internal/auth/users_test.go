@@ -0,0 +1,98 @@
+// internal/auth/users_test.go
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Futaiii/Sudoku_ASCII/internal/config"
+)
+
+func TestUserHint(t *testing.T) {
+	if UserHint("alice", 1) != UserHint("alice", 1) {
+		t.Fatal("hint is not deterministic")
+	}
+	if UserHint("alice", 1) == UserHint("alice", 2) {
+		t.Fatal("hint does not change between periods")
+	}
+	if UserHint("alice", 1) == UserHint("bob", 1) {
+		t.Fatal("different keys share a hint")
+	}
+	if currentPeriod(time.Unix(29, 0)) != 0 || currentPeriod(time.Unix(30, 0)) != 1 {
+		t.Fatal("period is not 30 seconds")
+	}
+}
+
+func TestNewUsersEmpty(t *testing.T) {
+	if NewUsers(nil, time.Minute) != nil {
+		t.Fatal("NewUsers without users should return nil")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	u := NewUsers([]config.UserConfig{{Name: "alice", Key: "ka"}, {Name: "bob", Key: "kb"}}, time.Minute)
+	now := time.Unix(1_700_000_010, 0)
+	p := currentPeriod(now)
+	span := int64(time.Minute/HintPeriod) + 1
+
+	tests := []struct {
+		name string
+		hint Hint
+		want string // 空表示查找失败
+	}{
+		{"current", UserHint("ka", p), "alice"},
+		{"other user", UserHint("kb", p), "bob"},
+		{"previous period", UserHint("ka", p-1), "alice"},
+		{"next period", UserHint("kb", p+1), "bob"},
+		{"oldest accepted", UserHint("ka", p-span), "alice"},
+		{"too old", UserHint("ka", p-span-1), ""},
+		{"too new", UserHint("ka", p+span+1), ""},
+		{"unknown key", UserHint("kc", p), ""},
+		{"zero hint", Hint{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, ok := u.lookupAt(tt.hint, now)
+			if tt.want == "" {
+				if ok {
+					t.Fatalf("lookup = %s, want miss", user.Name)
+				}
+				return
+			}
+			if !ok || user.Name != tt.want {
+				t.Fatalf("lookup = %v, %v, want %s", user, ok, tt.want)
+			}
+		})
+	}
+}
+
+// TestLookupPeriodBoundary 跨越周期时重建索引，可接受的时间片整体后移一个周期
+func TestLookupPeriodBoundary(t *testing.T) {
+	u := NewUsers([]config.UserConfig{{Name: "alice", Key: "ka"}}, time.Minute)
+	span := int64(time.Minute/HintPeriod) + 1
+	p := int64(56_666_667)
+	last := time.Unix((p+1)*int64(HintPeriod/time.Second)-1, 0) // 周期 p 的最后一秒
+
+	oldest := UserHint("ka", p-span)
+	newest := UserHint("ka", p+1+span)
+	if _, ok := u.lookupAt(oldest, last); !ok {
+		t.Fatal("oldest hint refused before the boundary")
+	}
+	if _, ok := u.lookupAt(newest, last); ok {
+		t.Fatal("hint beyond the window accepted before the boundary")
+	}
+	if u.period != p {
+		t.Fatalf("index built for period %d, want %d", u.period, p)
+	}
+
+	next := last.Add(time.Second)
+	if _, ok := u.lookupAt(newest, next); !ok {
+		t.Fatal("new hint refused after the boundary")
+	}
+	if _, ok := u.lookupAt(oldest, next); ok {
+		t.Fatal("expired hint accepted after the boundary")
+	}
+	if u.period != p+1 {
+		t.Fatalf("index not rebuilt: period %d, want %d", u.period, p+1)
+	}
+}
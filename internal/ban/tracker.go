@@ -0,0 +1,200 @@
+// internal/ban/tracker.go
+package ban
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Futaiii/Sudoku_ASCII/internal/config"
+	"github.com/Futaiii/Sudoku_ASCII/internal/fsutil"
+	"github.com/Futaiii/Sudoku_ASCII/internal/metrics"
+)
+
+const (
+	// maxTracked 记录失败次数的来源 IP 上限，超出时清空重新计数
+	maxTracked = 65536
+	// maxBans 同时生效的封禁上限，超出时移除最早到期的封禁
+	maxBans = 65536
+	// saveDelay 新的封禁合并写入文件的延迟
+	saveDelay = 5 * time.Second
+)
+
+// Tracker 按来源 IP 统计握手失败，窗口内达到阈值即临时封禁
+// 封禁列表写入文件，重启后继续生效
+type Tracker struct {
+	mu        sync.Mutex
+	threshold int
+	window    time.Duration
+	duration  time.Duration
+	failures  map[string]*failure
+	bans      map[string]time.Time // IP -> 解封时间
+
+	path    string
+	saveMu  sync.Mutex
+	dirty   bool // 有未写入文件的封禁
+	pending bool // 已安排延迟写入
+}
+
+type failure struct {
+	count int
+	since time.Time
+}
+
+// New 创建记录器，path 非空时加载未过期的封禁
+func New(cfg *config.BanConfig) *Tracker {
+	t := &Tracker{
+		failures: make(map[string]*failure),
+		bans:     make(map[string]time.Time),
+		path:     cfg.File,
+	}
+	t.Update(cfg)
+	if t.path == "" {
+		return t
+	}
+
+	data, err := os.ReadFile(t.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("[Ban] Failed to read %s: %v", t.path, err)
+		}
+		return t
+	}
+	var bans map[string]time.Time
+	if err := json.Unmarshal(data, &bans); err != nil {
+		log.Printf("[Ban] Failed to parse %s: %v", t.path, err)
+		return t
+	}
+	now := time.Now()
+	for ip, until := range bans {
+		if until.After(now) {
+			t.bans[ip] = until
+		}
+	}
+	log.Printf("[Ban] Loaded %d active bans from %s", len(t.bans), t.path)
+	return t
+}
+
+// Update 更新阈值与时长 (热更新)，已有的封禁保持原解封时间
+func (t *Tracker) Update(cfg *config.BanConfig) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.threshold = cfg.Threshold
+	t.window = time.Duration(cfg.Window) * time.Second
+	t.duration = time.Duration(cfg.Duration) * time.Second
+}
+
+// Banned 判断 IP 当前是否被封禁
+func (t *Tracker) Banned(ip string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	until, ok := t.bans[ip]
+	if !ok {
+		return false
+	}
+	if time.Now().Before(until) {
+		return true
+	}
+	delete(t.bans, ip)
+	return false
+}
+
+// Fail 记录一次握手失败，达到阈值时封禁该 IP，并在 saveDelay 后与其他新封禁一起写入文件
+func (t *Tracker) Fail(ip string) {
+	t.mu.Lock()
+	if t.threshold <= 0 {
+		t.mu.Unlock()
+		return
+	}
+
+	now := time.Now()
+	f, ok := t.failures[ip]
+	if !ok || now.Sub(f.since) > t.window {
+		if !ok && len(t.failures) >= maxTracked {
+			clear(t.failures)
+		}
+		f = &failure{since: now}
+		t.failures[ip] = f
+	}
+	f.count++
+	if f.count < t.threshold {
+		t.mu.Unlock()
+		return
+	}
+
+	delete(t.failures, ip)
+	if _, ok := t.bans[ip]; !ok && len(t.bans) >= maxBans {
+		t.evictLocked(now)
+	}
+	until := now.Add(t.duration)
+	t.bans[ip] = until
+	count := f.count
+	t.dirty = true
+	if t.path != "" && !t.pending {
+		t.pending = true
+		time.AfterFunc(saveDelay, func() {
+			if err := t.Flush(); err != nil {
+				log.Printf("[Ban] Save failed: %v", err)
+			}
+		})
+	}
+	t.mu.Unlock()
+
+	metrics.Bans.Inc()
+	log.Printf("[Ban] %s banned until %s after %d handshake failures", ip, until.Format(time.RFC3339), count)
+}
+
+// evictLocked 清除已过期的封禁，仍然已满时移除最早到期的一个
+func (t *Tracker) evictLocked(now time.Time) {
+	var soonest string
+	var earliest time.Time
+	for ip, until := range t.bans {
+		if !until.After(now) {
+			delete(t.bans, ip)
+			continue
+		}
+		if soonest == "" || until.Before(earliest) {
+			soonest, earliest = ip, until
+		}
+	}
+	if len(t.bans) >= maxBans {
+		delete(t.bans, soonest)
+	}
+}
+
+// Flush 将未过期的封禁写入文件 (先写临时文件再替换)，没有新封禁时不写入
+// 退出前调用，避免丢失尚未写入的封禁；写入失败时保留标记，下次 Flush 重试
+func (t *Tracker) Flush() error {
+	if t.path == "" {
+		return nil
+	}
+	t.saveMu.Lock()
+	defer t.saveMu.Unlock()
+
+	t.mu.Lock()
+	t.pending = false
+	if !t.dirty {
+		t.mu.Unlock()
+		return nil
+	}
+	t.dirty = false
+	now := time.Now()
+	for ip, until := range t.bans {
+		if !until.After(now) {
+			delete(t.bans, ip)
+		}
+	}
+	data, err := json.MarshalIndent(t.bans, "", "  ")
+	t.mu.Unlock()
+	if err == nil {
+		err = fsutil.AtomicWriteFile(t.path, data, 0o600)
+	}
+	if err != nil {
+		t.mu.Lock()
+		t.dirty = true
+		t.mu.Unlock()
+	}
+	return err
+}
@@ -0,0 +1,91 @@
+// internal/ban/tracker_test.go
+package ban
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Futaiii/Sudoku_ASCII/internal/config"
+)
+
+func TestThreshold(t *testing.T) {
+	tr := New(&config.BanConfig{Threshold: 3, Window: 600, Duration: 3600})
+	tr.Fail("192.0.2.1")
+	tr.Fail("192.0.2.1")
+	tr.Fail("192.0.2.2")
+	if tr.Banned("192.0.2.1") {
+		t.Fatal("banned before reaching the threshold")
+	}
+	tr.Fail("192.0.2.1")
+	if !tr.Banned("192.0.2.1") {
+		t.Fatal("not banned after reaching the threshold")
+	}
+	if tr.Banned("192.0.2.2") {
+		t.Fatal("unrelated IP banned")
+	}
+}
+
+func TestWindowAndExpiry(t *testing.T) {
+	tr := New(&config.BanConfig{Threshold: 2, Window: 600, Duration: 3600})
+	tr.Fail("192.0.2.1")
+	// 窗口之外的失败重新计数
+	tr.failures["192.0.2.1"].since = time.Now().Add(-time.Hour)
+	tr.Fail("192.0.2.1")
+	if tr.Banned("192.0.2.1") {
+		t.Fatal("failures outside the window counted together")
+	}
+	tr.Fail("192.0.2.1")
+	if !tr.Banned("192.0.2.1") {
+		t.Fatal("not banned")
+	}
+	tr.bans["192.0.2.1"] = time.Now().Add(-time.Second)
+	if tr.Banned("192.0.2.1") {
+		t.Fatal("expired ban still active")
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	tr := New(&config.BanConfig{Threshold: 1, Window: 600, Duration: 3600})
+	tr.Update(&config.BanConfig{Threshold: 0, Window: 600, Duration: 3600})
+	tr.Fail("192.0.2.1")
+	if tr.Banned("192.0.2.1") {
+		t.Fatal("banned with threshold 0")
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bans.json")
+	cfg := &config.BanConfig{Threshold: 1, Window: 600, Duration: 3600, File: path}
+	tr := New(cfg)
+	tr.Fail("192.0.2.1")
+	if err := tr.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !New(cfg).Banned("192.0.2.1") {
+		t.Fatal("ban not restored from file")
+	}
+}
+
+// TestFlushRetry 写入失败的封禁在下次 Flush 时重试
+func TestFlushRetry(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "missing")
+	path := filepath.Join(dir, "bans.json")
+	tr := New(&config.BanConfig{Threshold: 1, Window: 600, Duration: 3600, File: path})
+	tr.Fail("192.0.2.1")
+	if err := tr.Flush(); err == nil {
+		t.Fatal("Flush into a missing directory succeeded")
+	}
+
+	if err := os.Mkdir(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("bans not written on retry: %v", err)
+	}
+}
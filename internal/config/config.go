@@ -3,25 +3,127 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 )
 
 type Config struct {
-	Mode             string       `json:"mode"`      // "client" or "server"
-	Transport        string       `json:"transport"` // "tcp" or "udp"
-	LocalPort        int          `json:"local_port"`
-	ServerAddress    string       `json:"server_address"`
-	FallbackAddr     string       `json:"fallback_address"`
-	Key              string       `json:"key"`
-	AEAD             string       `json:"aead"`              // "aes-128-gcm", "chacha20-poly1305", "none"
-	SuspiciousAction string       `json:"suspicious_action"` // "fallback" or "silent"
-	PaddingMin       int          `json:"padding_min"`
-	PaddingMax       int          `json:"padding_max"`
-	RuleURLs         []string     `json:"rule_urls"`    // 留空则使用默认，支持 "global", "direct" 关键字
-	ProxyMode        string       `json:"proxy_mode"`   // 运行时状态，非JSON字段，由Load解析逻辑填充
-	ASCII            string       `json:"ascii"`        // "prefer_entropy" (默认): 旧模式, 低熵, 二进制混淆"，prefer_ascii": 新模式, 纯ASCII字符，高熵
-	EnableMieru      bool         `json:"enable_mieru"` // 开启上下行分离
-	MieruConfig      *MieruConfig `json:"mieru_config"` // Mieru 特定配置
+	Mode             string            `json:"mode"`      // "client" or "server"
+	Transport        string            `json:"transport"` // "tcp" or "udp"
+	LocalPort        int               `json:"local_port"`
+	ServerAddress    string            `json:"server_address"`
+	FallbackAddr     string            `json:"fallback_address"`
+	FallbackProxy    int               `json:"fallback_proxy_protocol"` // 服务端: 回落时向诱饵服务器发送 PROXY protocol 头 (1 或 2) 以传递真实来源地址，0 不发送
+	ProxyProtocol    bool              `json:"proxy_protocol"`          // 服务端: 监听端口要求每个连接以 PROXY protocol 头开始 (位于负载均衡之后时使用)
+	ProxyFrom        []string          `json:"proxy_protocol_from"`     // 服务端: 允许发送 PROXY 头的来源 (负载均衡的 CIDR 或 IP)，开启 proxy_protocol 时必填；其他来源的连接按 suspicious_action 处理
+	Key              string            `json:"key"`
+	AEAD             string            `json:"aead"`                  // "aes-128-gcm", "chacha20-poly1305", "none"
+	HandshakeVersion int               `json:"handshake_version"`     // 客户端握手版本: 1 (默认) 为静态密钥，兼容旧版服务端; 2 为 X25519 前向安全，须服务端已升级
+	MinHandshake     int               `json:"min_handshake_version"` // 服务端: 接受的最低握手版本，1 (默认) 两者均接受，2 拒绝旧版静态密钥握手
+	SuspiciousAction string            `json:"suspicious_action"`     // "fallback" or "silent"
+	ReplayWindow     int               `json:"replay_window"`         // 服务端: 握手时间戳允许的偏差 (秒)，同时决定防重放缓存的保留时间
+	ReplayCacheSize  int               `json:"replay_cache_size"`     // 服务端: 防重放缓存单个时间桶的最大条目数
+	PaddingMin       int               `json:"padding_min"`
+	PaddingMax       int               `json:"padding_max"`
+	Shaping          *ShapingConfig    `json:"shaping"`          // 写入整形: 合并写入、随机分段与空闲填充，两端各自配置
+	PaddingProfile   string            `json:"padding_profile"`  // 填充策略: "uniform" (默认), "bursty", "constant", "http"，两端可各自选择
+	RuleURLs         []string          `json:"rule_urls"`        // 留空则使用默认，支持 "global", "direct" 关键字
+	ProxyMode        string            `json:"proxy_mode"`       // 运行时状态，非JSON字段，由Load解析逻辑填充
+	ASCII            string            `json:"ascii"`            // "prefer_entropy" (默认): 旧模式, 低熵, 二进制混淆"，prefer_ascii": 新模式, 纯ASCII字符，高熵
+	Layout           string            `json:"layout"`           // 线路字符布局: "lowercase", "hex", "base64", "custom"，留空则由 ascii 决定；两端须一致
+	CustomLayout     *CustomLayout     `json:"custom_layout"`    // layout 为 "custom" 时使用的字符
+	PermuteLayout    bool              `json:"permute_layout"`   // 按 key 打乱布局内提示与填充字符的分配，两端须一致
+	Grid             string            `json:"grid"`             // 数独网格: "4x4" (默认), "6x6", "9x9"，更大的网格线路字节更少；两端须一致
+	TableCache       string            `json:"table_cache"`      // 数独表缓存目录，首次生成后写入，之后直接加载；留空不缓存
+	EnableMieru      bool              `json:"enable_mieru"`     // 开启上下行分离
+	MieruConfig      *MieruConfig      `json:"mieru_config"`     // Mieru 特定配置
+	Mux              *MuxConfig        `json:"mux"`              // 单连接多路复用
+	Users            []UserConfig      `json:"users"`            // 服务端: 多用户列表，为空时所有客户端共用 key
+	User             *UserConfig       `json:"user"`             // 客户端: 连接多用户服务端时使用的身份
+	Accounting       *AccountingConfig `json:"accounting"`       // 服务端: 流量统计与持久化
+	RateLimit        *RateLimitConfig  `json:"rate_limit"`       // 带宽限速
+	ACL              *ACLConfig        `json:"acl"`              // 服务端: 代理目标的访问控制
+	Ban              *BanConfig        `json:"ban"`              // 服务端: 握手反复失败的来源 IP 临时封禁
+	MetricsAddr      string            `json:"metrics_address"`  // Prometheus 指标监听地址 (如 "127.0.0.1:9100")，留空不启用
+	AdminAddr        string            `json:"admin_address"`    // 管理接口监听地址，仅允许回环地址 (如 "127.0.0.1:9090")，留空不启用
+	AdminToken       string            `json:"admin_token"`      // 管理接口修改状态的请求 (DELETE / POST) 须携带的 Bearer Token
+	ShutdownTimeout  int               `json:"shutdown_timeout"` // 收到 SIGINT/SIGTERM 后等待活动会话结束的最长时间 (秒)
+	Timeouts         *TimeoutConfig    `json:"timeouts"`         // 建立连接各阶段的超时
+	Optimistic       bool              `json:"optimistic"`       // 客户端: 不等待服务端应答即视为连接成功，省去一个往返；handshake_version 为 1 时总是如此 (旧版服务端不发送应答)
+	Path             string            `json:"-"`                // 配置文件路径，热更新时重新读取
+}
+
+// RateLimitConfig 带宽限速 (KB/s，上下行分别计算)，0 为不限
+// 客户端仅使用 global 与 per_conn
+type RateLimitConfig struct {
+	GlobalKBps  int64 `json:"global_kbps"`   // 全部连接合计
+	PerUserKBps int64 `json:"per_user_kbps"` // 服务端: 每个用户的默认上限，可被用户的 rate_limit_kbps 覆盖
+	PerConnKBps int64 `json:"per_conn_kbps"` // 每条连接 (多路复用时为每个流)
+}
+
+// ACLConfig 服务端代理目标的访问控制，在解析域名之后对每个 IP 判断
+// 规则按顺序匹配，首条命中的规则生效；均未命中时拒绝私有/回环地址 (除非 allow_private)，其余允许
+type ACLConfig struct {
+	AllowPrivate bool      `json:"allow_private"` // 允许私有、回环、链路本地等内网地址
+	Rules        []ACLRule `json:"rules"`
+}
+
+// ACLRule 单条规则，各条件均满足时命中，留空的条件不限制
+// 未列出 cidrs 的 allow 规则不会放行内网地址
+type ACLRule struct {
+	Action  string   `json:"action"`  // "allow" or "deny"
+	Users   []string `json:"users"`   // 生效的用户，留空对所有用户生效
+	CIDRs   []string `json:"cidrs"`   // 如 "10.0.0.0/8", "2001:db8::/32"
+	Domains []string `json:"domains"` // 匹配域名本身及其子域名，仅对以域名请求的目标生效
+	Ports   []string `json:"ports"`   // 如 "443", "8000-9000"
+}
+
+// BanConfig 来源 IP 在 window 内握手失败 threshold 次后封禁 duration，
+// 封禁期间的连接不经数独解码，直接按 suspicious_action 处理
+type BanConfig struct {
+	Threshold int    `json:"threshold"` // 触发封禁的失败次数，0 为不启用
+	Window    int    `json:"window"`    // 统计失败次数的窗口 (秒)
+	Duration  int    `json:"duration"`  // 封禁时长 (秒)
+	File      string `json:"file"`      // 封禁列表文件，留空则重启后清空
+}
+
+// ShapingConfig 数独层的写入整形，握手完成后生效
+type ShapingConfig struct {
+	Enable       bool `json:"enable"`
+	FlushBytes   int  `json:"flush_bytes"`      // 缓冲的编码数据达到该字节数时立即发送
+	FlushDelay   int  `json:"flush_delay_ms"`   // 缓冲数据的最长等待时间 (毫秒)
+	SegmentMin   int  `json:"segment_min"`      // 发送时随机分段的最小长度 (字节)，0 为不拆分
+	SegmentMax   int  `json:"segment_max"`      // 发送时随机分段的最大长度 (字节)
+	IdleInterval int  `json:"idle_interval_ms"` // 空闲时发送纯填充块的平均间隔 (毫秒)，0 为不发送
+}
+
+// CustomLayout 自定义线路布局，两组字符不能重复或重叠
+type CustomLayout struct {
+	Hints   string `json:"hints"`   // 提示字符，少于 64 个时每个提示占用多个字符
+	Padding string `json:"padding"` // 填充字符
+}
+
+// TimeoutConfig 建立连接各阶段的超时 (秒)
+type TimeoutConfig struct {
+	Connect   int `json:"connect"`   // TCP 连接服务端、目标或回落地址
+	Handshake int `json:"handshake"` // Sudoku 握手 (含密钥交换) 的全部读写
+	Pairing   int `json:"pairing"`   // 分离模式下 Sudoku 上行与 Mieru 下行的配对
+}
+
+type AccountingConfig struct {
+	File            string `json:"file"`             // 流量记录文件，留空则仅在内存中统计 (重启后清零)
+	FlushInterval   int    `json:"flush_interval"`   // 写入文件的间隔 (秒)
+	MaxDestinations int    `json:"max_destinations"` // 按用户与目标统计的最大条目数 (全部用户合计)，超出部分合并计入该用户的 "(other)"
+}
+
+// UserConfig 多用户模式下的单个用户
+// 顶层 key 仍用于生成数独混淆表 (所有用户共享)，用户 key 用于认证、加密与 Mieru 密码
+type UserConfig struct {
+	Name           string `json:"name"`
+	Key            string `json:"key"`
+	DailyQuotaMB   int64  `json:"daily_quota_mb"`   // 每日流量配额 (MB，上下行合计)，0 为不限
+	MonthlyQuotaMB int64  `json:"monthly_quota_mb"` // 每月流量配额 (MB，上下行合计)，0 为不限
+	RateLimitKBps  int64  `json:"rate_limit_kbps"`  // 该用户的带宽上限 (KB/s)，0 则使用 rate_limit.per_user_kbps
 }
 
 type MieruConfig struct {
@@ -34,6 +136,12 @@ type MieruConfig struct {
 	ApplySettings bool   `json:"-"`            // 内部标记
 }
 
+type MuxConfig struct {
+	Enable      bool `json:"enable"`       // 客户端是否启用多路复用 (服务端始终接受)
+	MaxStreams  int  `json:"max_streams"`  // 单个会话最大并发流数量，客户端应不大于服务端
+	IdleTimeout int  `json:"idle_timeout"` // 会话无活动流后的保留时间 (秒)
+}
+
 func Load(path string) (*Config, error) {
 	f, err := os.Open(path)
 	if err != nil {
@@ -45,14 +153,153 @@ func Load(path string) (*Config, error) {
 	if err := json.NewDecoder(f).Decode(&cfg); err != nil {
 		return nil, err
 	}
+	cfg.Path = path
 
+	if err := cfg.Normalize(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Normalize 填充默认值并校验配置
+// Load 与 pkg/sudoku 的入口都会调用，可重复调用
+func (cfg *Config) Normalize() error {
 	if cfg.Transport == "" {
 		cfg.Transport = "tcp"
 	}
 
+	if cfg.ReplayWindow <= 0 {
+		cfg.ReplayWindow = 60
+	}
+	if cfg.ReplayCacheSize <= 0 {
+		cfg.ReplayCacheSize = 65536
+	}
+
+	if cfg.Accounting == nil {
+		cfg.Accounting = &AccountingConfig{}
+	}
+	if cfg.Accounting.FlushInterval <= 0 {
+		cfg.Accounting.FlushInterval = 60
+	}
+	if cfg.Accounting.MaxDestinations <= 0 {
+		cfg.Accounting.MaxDestinations = 10000
+	}
+
+	if cfg.ShutdownTimeout <= 0 {
+		cfg.ShutdownTimeout = 30
+	}
+
+	if cfg.Timeouts == nil {
+		cfg.Timeouts = &TimeoutConfig{}
+	}
+	if cfg.Timeouts.Connect <= 0 {
+		cfg.Timeouts.Connect = 10
+	}
+	if cfg.Timeouts.Handshake <= 0 {
+		cfg.Timeouts.Handshake = 5
+	}
+	if cfg.Timeouts.Pairing <= 0 {
+		cfg.Timeouts.Pairing = 10
+	}
+
+	if cfg.RateLimit == nil {
+		cfg.RateLimit = &RateLimitConfig{}
+	}
+
+	if cfg.ACL == nil {
+		cfg.ACL = &ACLConfig{}
+	}
+
+	if cfg.Ban == nil {
+		cfg.Ban = &BanConfig{}
+	}
+	if cfg.Ban.Window <= 0 {
+		cfg.Ban.Window = 600
+	}
+	if cfg.Ban.Duration <= 0 {
+		cfg.Ban.Duration = 3600
+	}
+
+	switch cfg.PaddingProfile {
+	case "":
+		cfg.PaddingProfile = "uniform"
+	case "uniform", "bursty", "constant", "http":
+	default:
+		return fmt.Errorf("padding_profile: unknown profile %q", cfg.PaddingProfile)
+	}
+
+	if cfg.Shaping == nil {
+		cfg.Shaping = &ShapingConfig{}
+	}
+	if cfg.Shaping.FlushBytes <= 0 {
+		cfg.Shaping.FlushBytes = 16384
+	}
+	if cfg.Shaping.FlushDelay <= 0 {
+		cfg.Shaping.FlushDelay = 5
+	}
+	if cfg.Shaping.SegmentMin < 0 || cfg.Shaping.SegmentMax < cfg.Shaping.SegmentMin {
+		return fmt.Errorf("shaping: invalid segment range %d-%d", cfg.Shaping.SegmentMin, cfg.Shaping.SegmentMax)
+	}
+
+	if cfg.FallbackProxy < 0 || cfg.FallbackProxy > 2 {
+		return fmt.Errorf("fallback_proxy_protocol: must be 0, 1 or 2")
+	}
+	if cfg.ProxyProtocol && len(cfg.ProxyFrom) == 0 {
+		return fmt.Errorf("proxy_protocol_from: required when proxy_protocol is enabled")
+	}
+
+	if cfg.HandshakeVersion == 0 {
+		cfg.HandshakeVersion = 1
+	}
+	if cfg.HandshakeVersion < 1 || cfg.HandshakeVersion > 2 {
+		return fmt.Errorf("handshake_version: must be 1 or 2")
+	}
+	if cfg.MinHandshake == 0 {
+		cfg.MinHandshake = 1
+	}
+	if cfg.MinHandshake < 1 || cfg.MinHandshake > 2 {
+		return fmt.Errorf("min_handshake_version: must be 1 or 2")
+	}
+
 	if cfg.ASCII == "" {
 		cfg.ASCII = "prefer_entropy"
 	}
+	switch cfg.Layout {
+	case "":
+		cfg.Layout = "prefer_entropy"
+		if cfg.ASCII == "prefer_ascii" {
+			cfg.Layout = "prefer_ascii"
+		}
+	case "prefer_ascii", "prefer_entropy", "lowercase", "hex", "base64":
+	case "custom":
+		if cfg.CustomLayout == nil {
+			return fmt.Errorf("layout: custom_layout is required for \"custom\"")
+		}
+	default:
+		return fmt.Errorf("layout: unknown layout %q", cfg.Layout)
+	}
+
+	switch cfg.Grid {
+	case "":
+		cfg.Grid = "4x4"
+	case "4x4", "6x6", "9x9":
+	default:
+		return fmt.Errorf("grid: unknown grid %q", cfg.Grid)
+	}
+
+	seen := make(map[string]bool)
+	for _, u := range cfg.Users {
+		if u.Name == "" || u.Key == "" {
+			return fmt.Errorf("users: name and key are required")
+		}
+		if seen[u.Name] {
+			return fmt.Errorf("users: duplicate name %q", u.Name)
+		}
+		seen[u.Name] = true
+	}
+	if cfg.User != nil && (cfg.User.Name == "" || cfg.User.Key == "") {
+		return fmt.Errorf("user: name and key are required")
+	}
 
 	if cfg.EnableMieru {
 		if cfg.MieruConfig == nil {
@@ -66,9 +313,15 @@ func Load(path string) (*Config, error) {
 		}
 		if cfg.MieruConfig.Username == "" {
 			cfg.MieruConfig.Username = "sudoku_user"
+			if cfg.User != nil {
+				cfg.MieruConfig.Username = cfg.User.Name
+			}
 		}
 		if cfg.MieruConfig.Password == "" {
 			cfg.MieruConfig.Password = cfg.Key // 复用密码
+			if cfg.User != nil {
+				cfg.MieruConfig.Password = cfg.User.Key
+			}
 		}
 		if cfg.MieruConfig.MTU == 0 {
 			cfg.MieruConfig.MTU = 1400
@@ -78,6 +331,16 @@ func Load(path string) (*Config, error) {
 		}
 	}
 
+	if cfg.Mux == nil {
+		cfg.Mux = &MuxConfig{}
+	}
+	if cfg.Mux.MaxStreams <= 0 {
+		cfg.Mux.MaxStreams = 32
+	}
+	if cfg.Mux.IdleTimeout <= 0 {
+		cfg.Mux.IdleTimeout = 60
+	}
+
 	// 处理 ProxyMode 和 默认规则
 	// 如果用户显式设置了 rule_urls 为 ["global"] 或 ["direct"]，则覆盖模式
 	if len(cfg.RuleURLs) > 0 && (cfg.RuleURLs[0] == "global" || cfg.RuleURLs[0] == "direct") {
@@ -91,5 +354,5 @@ func Load(path string) (*Config, error) {
 		}
 	}
 
-	return &cfg, nil
+	return nil
 }
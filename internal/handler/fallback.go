@@ -8,16 +8,30 @@ import (
 	"sync"
 	"time"
 
+	"github.com/Futaiii/Sudoku_ASCII/internal/ban"
 	"github.com/Futaiii/Sudoku_ASCII/internal/config"
+	"github.com/Futaiii/Sudoku_ASCII/internal/metrics"
+	"github.com/Futaiii/Sudoku_ASCII/internal/proxyproto"
 	"github.com/Futaiii/Sudoku_ASCII/pkg/obfs/sudoku"
 )
 
-func HandleSuspicious(sConn *sudoku.Conn, rawConn net.Conn, cfg *config.Config) {
+// tarpitMaxBytes silent 模式下最多吞掉的字节数
+const tarpitMaxBytes = 64 * 1024
+
+// HandleSuspicious 按 suspicious_action 处理握手失败的连接，bans 非 nil 时计入来源 IP 的失败次数
+// sConn 为 nil 时 (已封禁的 IP) 没有已读取的数据需要转发；调用方只对探测类失败传入 bans
+func HandleSuspicious(sConn *sudoku.Conn, rawConn net.Conn, cfg *config.Config, bans *ban.Tracker) {
 	remoteAddr := rawConn.RemoteAddr().String()
+	if bans != nil {
+		host, _, _ := net.SplitHostPort(remoteAddr)
+		bans.Fail(host)
+	}
 
 	if cfg.SuspiciousAction == "silent" {
 		log.Printf("[Silent] Suspicious %s. Tarpit.", remoteAddr)
-		io.Copy(io.Discard, rawConn)
+		// 吞掉数据的时间与字节数均有上限，慢速探测无法长期占用连接
+		rawConn.SetReadDeadline(time.Now().Add(time.Duration(cfg.Timeouts.Handshake) * time.Second))
+		io.CopyN(io.Discard, rawConn, tarpitMaxBytes)
 		time.Sleep(5 * time.Second)
 		rawConn.Close()
 		return
@@ -29,13 +43,21 @@ func HandleSuspicious(sConn *sudoku.Conn, rawConn net.Conn, cfg *config.Config)
 	}
 
 	log.Printf("[Fallback] %s -> %s", remoteAddr, cfg.FallbackAddr)
-	dst, err := net.DialTimeout("tcp", cfg.FallbackAddr, 3*time.Second)
+	metrics.Fallbacks.Inc()
+	dst, err := net.DialTimeout("tcp", cfg.FallbackAddr, time.Duration(cfg.Timeouts.Connect)*time.Second)
 	if err != nil {
 		rawConn.Close()
 		return
 	}
 
-	badData := sConn.GetBufferedAndRecorded()
+	// PROXY 头让诱饵服务器看到真实来源 (rawConn 已读取入站 PROXY 头时为其中的地址)
+	var badData []byte
+	if cfg.FallbackProxy != 0 {
+		badData = proxyproto.Header(cfg.FallbackProxy, rawConn.RemoteAddr(), rawConn.LocalAddr())
+	}
+	if sConn != nil {
+		badData = append(badData, sConn.GetBufferedAndRecorded()...)
+	}
 	if len(badData) > 0 {
 		if _, err := dst.Write(badData); err != nil {
 			dst.Close()
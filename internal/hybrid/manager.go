@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/Futaiii/Sudoku_ASCII/internal/config"
+	"github.com/Futaiii/Sudoku_ASCII/internal/metrics"
 	"github.com/enfein/mieru/v3/apis/model"
 
 	mieruClient "github.com/enfein/mieru/v3/apis/client"
@@ -22,10 +23,7 @@ import (
 	"github.com/enfein/mieru/v3/pkg/appctl/appctlpb"
 )
 
-const (
-	BindingDomainSuffix = ".sudoku-binding"
-	BindingTimeout      = 10 * time.Second
-)
+const BindingDomainSuffix = ".sudoku-binding"
 
 // === 辅助函数：解决 Protobuf 指针类型不匹配问题 ===
 func toPtr[T any](v T) *T {
@@ -48,6 +46,20 @@ func (s *SplitConn) Write(b []byte) (n int, err error) {
 	return s.Writer.Write(b)
 }
 
+// SetReadDeadline 作用于下行，SetWriteDeadline 作用于上行
+func (s *SplitConn) SetDeadline(t time.Time) error {
+	s.Reader.SetReadDeadline(t)
+	return s.Writer.SetWriteDeadline(t)
+}
+
+func (s *SplitConn) SetReadDeadline(t time.Time) error {
+	return s.Reader.SetReadDeadline(t)
+}
+
+func (s *SplitConn) SetWriteDeadline(t time.Time) error {
+	return s.Writer.SetWriteDeadline(t)
+}
+
 func (s *SplitConn) Close() error {
 	if s.CloseFn != nil {
 		return s.CloseFn()
@@ -75,10 +87,36 @@ func GetInstance(cfg *config.Config) *Manager {
 	return instance
 }
 
+// Acquire 与 GetInstance 相同，但 cfg 开启分离模式且其 Mieru 配置与首次初始化时不一致时返回错误
+// Mieru 客户端 / 服务端每个进程只启动一次，不能按不同的配置同时运行
+func Acquire(cfg *config.Config) (*Manager, error) {
+	m := GetInstance(cfg)
+	if !cfg.EnableMieru || m.cfg == cfg {
+		return m, nil
+	}
+	switch {
+	case !m.cfg.EnableMieru:
+		return nil, errors.New("mieru: split mode was not enabled when this process started Mieru")
+	case m.cfg.MieruConfig == nil || cfg.MieruConfig == nil || *m.cfg.MieruConfig != *cfg.MieruConfig:
+		return nil, errors.New("mieru: mieru_config differs from the one this process started with")
+	case serverHost(m.cfg.ServerAddress) != serverHost(cfg.ServerAddress):
+		return nil, fmt.Errorf("mieru: downlink already points to %s, server_address change requires a restart", serverHost(m.cfg.ServerAddress))
+	}
+	return m, nil
+}
+
+// serverHost 去掉端口，Mieru 下行只使用服务端的主机部分
+func serverHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
 // === Client Side ===
 
 func (m *Manager) StartMieruClient() error {
-	if !m.cfg.EnableMieru {
+	if !m.cfg.EnableMieru || m.mieruCli != nil {
 		return nil
 	}
 
@@ -145,8 +183,8 @@ func (m *Manager) StartMieruClient() error {
 	return nil
 }
 
-// DialMieruForDownlink 建立 Mieru 连接并发送绑定请求
-func (m *Manager) DialMieruForDownlink(uuid string) (net.Conn, error) {
+// DialMieruForDownlink 建立 Mieru 连接并发送绑定请求，ctx 结束时放弃
+func (m *Manager) DialMieruForDownlink(ctx context.Context, uuid string) (net.Conn, error) {
 	if m.mieruCli == nil {
 		return nil, errors.New("mieru client not initialized")
 	}
@@ -154,9 +192,6 @@ func (m *Manager) DialMieruForDownlink(uuid string) (net.Conn, error) {
 	// 使用 UUID 构造一个伪造的域名，服务端通过这个域名识别并提取 UUID
 	fakeAddr := fmt.Sprintf("%s%s:80", uuid, BindingDomainSuffix)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
 	// 调用 Mieru 的 Dial
 	conn, err := m.mieruCli.DialContext(ctx, &NetAddr{NetworkStr: "tcp", AddrStr: fakeAddr})
 	if err != nil {
@@ -172,7 +207,7 @@ func (m *Manager) DialMieruForDownlink(uuid string) (net.Conn, error) {
 // === Server Side ===
 
 func (m *Manager) StartMieruServer() error {
-	if !m.cfg.EnableMieru {
+	if !m.cfg.EnableMieru || m.mieruSrv != nil {
 		return nil
 	}
 
@@ -187,6 +222,23 @@ func (m *Manager) StartMieruServer() error {
 		transportProto = appctlpb.TransportProtocol_TCP
 	}
 
+	// 多用户模式下每个用户以自己的 name/key 作为 Mieru 账号
+	users := []*appctlpb.User{
+		{
+			Name:     toPtr(mc.Username),
+			Password: toPtr(mc.Password),
+		},
+	}
+	for _, u := range m.cfg.Users {
+		if u.Name == mc.Username {
+			continue
+		}
+		users = append(users, &appctlpb.User{
+			Name:     toPtr(u.Name),
+			Password: toPtr(u.Key),
+		})
+	}
+
 	// 构造 Server Config
 	srvCfgPB := &appctlpb.ServerConfig{
 		PortBindings: []*appctlpb.PortBinding{
@@ -195,13 +247,8 @@ func (m *Manager) StartMieruServer() error {
 				Protocol: toPtr(transportProto),
 			},
 		},
-		Users: []*appctlpb.User{
-			{
-				Name:     toPtr(mc.Username),
-				Password: toPtr(mc.Password),
-			},
-		},
-		Mtu: toPtr(int32(mc.MTU)),
+		Users: users,
+		Mtu:   toPtr(int32(mc.MTU)),
 	}
 
 	m.mieruSrv = mieruServer.NewServer()
@@ -234,13 +281,15 @@ func (m *Manager) acceptLoop() {
 		// 异步处理每个连接，防止单个连接的重试阻塞主 Accept 循环
 		go func(c net.Conn, r *model.Request) {
 			// 获取目标地址 (UUID)
-			dst := req.DstAddr.FQDN
+			dst := r.DstAddr.FQDN
 
 			if strings.HasSuffix(dst, BindingDomainSuffix) {
 				uuid := strings.TrimSuffix(dst, BindingDomainSuffix)
 
+				// Mieru 连接可能先于 Sudoku 上行到达，最多等待一个配对超时
 				matched := false
-				for i := 0; i < 50; i++ {
+				deadline := time.Now().Add(time.Duration(m.cfg.Timeouts.Pairing) * time.Second)
+				for time.Now().Before(deadline) {
 					if val, ok := m.pending.Load(uuid); ok {
 						ch := val.(chan net.Conn)
 
@@ -278,18 +327,37 @@ func (m *Manager) acceptLoop() {
 	}
 }
 
-// RegisterSudokuConn 注册一个 Sudoku 上行连接，等待 Mieru 下行连接
-func (m *Manager) RegisterSudokuConn(uuid string) (net.Conn, error) {
+// Stop 停止 Mieru 客户端与服务端 (如已启动)
+func (m *Manager) Stop() {
+	if m.mieruCli != nil && m.mieruCli.IsRunning() {
+		if err := m.mieruCli.Stop(); err != nil {
+			log.Printf("[Mieru] Client stop error: %v", err)
+		}
+	}
+	if m.mieruSrv != nil && m.mieruSrv.IsRunning() {
+		if err := m.mieruSrv.Stop(); err != nil {
+			log.Printf("[Mieru] Server stop error: %v", err)
+		}
+	}
+}
+
+// RegisterSudokuConn 注册一个 Sudoku 上行连接，等待 Mieru 下行连接直到 ctx 结束
+func (m *Manager) RegisterSudokuConn(ctx context.Context, uuid string) (net.Conn, error) {
 	ch := make(chan net.Conn)
 	m.pending.Store(uuid, ch)
 
 	defer m.pending.Delete(uuid)
 
+	start := time.Now()
 	select {
 	case mConn := <-ch:
+		metrics.MieruPairing.Observe(time.Since(start).Seconds())
 		return mConn, nil
-	case <-time.After(BindingTimeout):
-		return nil, fmt.Errorf("timeout waiting for mieru downlink")
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			metrics.MieruPairingTimeouts.Inc()
+		}
+		return nil, fmt.Errorf("waiting for mieru downlink: %w", ctx.Err())
 	}
 }
 
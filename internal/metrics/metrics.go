@@ -0,0 +1,171 @@
+// internal/metrics/metrics.go
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 轻量的 Prometheus 文本格式指标实现，只覆盖本项目用到的类型
+
+// Counter 单调递增计数
+type Counter struct{ v atomic.Int64 }
+
+func (c *Counter) Inc()         { c.v.Add(1) }
+func (c *Counter) Add(n int64)  { c.v.Add(n) }
+func (c *Counter) Value() int64 { return c.v.Load() }
+
+// Gauge 可增可减的当前值
+type Gauge struct{ v atomic.Int64 }
+
+func (g *Gauge) Inc()         { g.v.Add(1) }
+func (g *Gauge) Dec()         { g.v.Add(-1) }
+func (g *Gauge) Value() int64 { return g.v.Load() }
+
+// CounterVec 按标签区分的一组计数
+type CounterVec struct {
+	labels []string
+	mu     sync.Mutex
+	m      map[string]*Counter
+}
+
+// With 按标签值取计数，值的数量与顺序需与定义时一致
+func (v *CounterVec) With(values ...string) *Counter {
+	key := strings.Join(values, "\xff")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	c, ok := v.m[key]
+	if !ok {
+		c = &Counter{}
+		v.m[key] = c
+	}
+	return c
+}
+
+// Histogram 累积分布，单位由调用方决定 (本项目为秒)
+type Histogram struct {
+	bounds []float64
+	mu     sync.Mutex
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	for i, b := range h.bounds {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+	h.mu.Unlock()
+}
+
+// === 注册与输出 ===
+
+type metric struct {
+	name, help, typ string
+	write           func(w io.Writer, name string)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []metric
+)
+
+func register(name, help, typ string, write func(w io.Writer, name string)) {
+	registryMu.Lock()
+	registry = append(registry, metric{name: name, help: help, typ: typ, write: write})
+	registryMu.Unlock()
+}
+
+func newCounter(name, help string) *Counter {
+	c := &Counter{}
+	register(name, help, "counter", func(w io.Writer, name string) {
+		fmt.Fprintf(w, "%s %d\n", name, c.Value())
+	})
+	return c
+}
+
+func newGauge(name, help string) *Gauge {
+	g := &Gauge{}
+	register(name, help, "gauge", func(w io.Writer, name string) {
+		fmt.Fprintf(w, "%s %d\n", name, g.Value())
+	})
+	return g
+}
+
+func newCounterVec(name, help string, labels ...string) *CounterVec {
+	v := &CounterVec{labels: labels, m: make(map[string]*Counter)}
+	register(name, help, "counter", func(w io.Writer, name string) {
+		v.mu.Lock()
+		keys := make([]string, 0, len(v.m))
+		for k := range v.m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(w, "%s%s %d\n", name, formatLabels(v.labels, strings.Split(k, "\xff")), v.m[k].Value())
+		}
+		v.mu.Unlock()
+	})
+	return v
+}
+
+func newHistogram(name, help string, bounds ...float64) *Histogram {
+	h := &Histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+	register(name, help, "histogram", func(w io.Writer, name string) {
+		h.mu.Lock()
+		for i, b := range h.bounds {
+			fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", name, strconv.FormatFloat(b, 'g', -1, 64), h.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+		fmt.Fprintf(w, "%s_sum %s\n", name, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "%s_count %d\n", name, h.count)
+		h.mu.Unlock()
+	})
+	return h
+}
+
+// labelEscaper 文本格式的标签值只允许转义反斜杠、双引号与换行
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names, values []string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, n := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		val := ""
+		if i < len(values) {
+			val = values[i]
+		}
+		b.WriteString(n)
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(val))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// WriteText 以 Prometheus 文本格式输出全部指标
+func WriteText(w io.Writer) {
+	registryMu.Lock()
+	list := append([]metric(nil), registry...)
+	registryMu.Unlock()
+
+	for _, m := range list {
+		fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", m.name, m.typ)
+		m.write(w, m.name)
+	}
+}
@@ -0,0 +1,54 @@
+// internal/metrics/metrics_test.go
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLabelEscaping(t *testing.T) {
+	got := formatLabels([]string{"user", "reason"}, []string{`a"b\c` + "\n用户"})
+	want := `{user="a\"b\\c\n用户",reason=""}`
+	if got != want {
+		t.Fatalf("formatLabels = %s, want %s", got, want)
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	v := newCounterVec("test_requests_total", "Test requests.", "code")
+	v.With("500").Inc()
+	v.With("200").Add(3)
+	h := newHistogram("test_latency_seconds", "Test latency.", 0.1, 1)
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(2)
+
+	var buf bytes.Buffer
+	WriteText(&buf)
+	out := buf.String()
+	for _, want := range []string{
+		"# HELP test_requests_total Test requests.\n# TYPE test_requests_total counter\n" +
+			"test_requests_total{code=\"200\"} 3\ntest_requests_total{code=\"500\"} 1\n",
+		"# TYPE test_latency_seconds histogram\n" +
+			"test_latency_seconds_bucket{le=\"0.1\"} 1\n" +
+			"test_latency_seconds_bucket{le=\"1\"} 2\n" +
+			"test_latency_seconds_bucket{le=\"+Inf\"} 3\n" +
+			"test_latency_seconds_sum 2.55\n" +
+			"test_latency_seconds_count 3\n",
+		"# TYPE sudoku_active_connections gauge\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing:\n%s\ngot:\n%s", want, out)
+		}
+	}
+}
+
+func TestServe(t *testing.T) {
+	if err := Serve(""); err != nil {
+		t.Fatalf("Serve(\"\") = %v", err)
+	}
+	if err := Serve("127.0.0.1:-1"); err == nil {
+		t.Fatal("Serve with an invalid address returned nil")
+	}
+}
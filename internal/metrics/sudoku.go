@@ -0,0 +1,131 @@
+// internal/metrics/sudoku.go
+package metrics
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/Futaiii/Sudoku_ASCII/pkg/crypto"
+	"github.com/Futaiii/Sudoku_ASCII/pkg/obfs/sudoku"
+)
+
+// 握手失败原因
+const (
+	ReasonTimeout     = "timeout"
+	ReasonTimeSkew    = "time_skew"
+	ReasonMapMiss     = "INVALID_SUDOKU_MAP_MISS"
+	ReasonDecrypt     = "decrypt_failure"
+	ReasonReplay      = "replay"
+	ReasonUnknownUser = "unknown_user"
+	ReasonQuota       = "quota"
+	ReasonKeyExchange = "key_exchange"
+	ReasonVersion     = "handshake_version"
+	ReasonProxyProto  = "proxy_protocol"
+	ReasonOther       = "other"
+)
+
+// 流量所在层: raw 为线路上的混淆数据，decoded 为数独解码后的数据
+const (
+	LayerRaw     = "raw"
+	LayerDecoded = "decoded"
+)
+
+var (
+	ActiveConns = newGauge("sudoku_active_connections",
+		"Connections currently being handled.")
+	HandshakeSuccess = newCounter("sudoku_handshake_success_total",
+		"Successful handshakes.")
+	HandshakeFailures = newCounterVec("sudoku_handshake_failures_total",
+		"Failed handshakes by reason.", "reason")
+	Fallbacks = newCounter("sudoku_fallback_total",
+		"Connections forwarded to the fallback address.")
+	Bytes = newCounterVec("sudoku_bytes_total",
+		"Bytes transferred by layer (raw on the wire, decoded after Sudoku) and direction.", "layer", "direction")
+	MieruPairing = newHistogram("sudoku_mieru_pairing_seconds",
+		"Time spent waiting for the Mieru downlink to pair with a Sudoku uplink.",
+		0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10)
+	MieruPairingTimeouts = newCounter("sudoku_mieru_pairing_timeouts_total",
+		"Sudoku uplinks that timed out waiting for the Mieru downlink.")
+	PACDecisions = newCounterVec("sudoku_pac_decisions_total",
+		"PAC routing decisions.", "decision")
+	Bans = newCounter("sudoku_bans_total",
+		"Source IPs banned after repeated handshake failures.")
+	BannedConns = newCounter("sudoku_banned_connections_total",
+		"Connections from banned IPs handled without decoding.")
+	ACLDenied = newCounterVec("sudoku_acl_denied_total",
+		"Proxy destinations refused by the server ACL, by user.", "user")
+)
+
+// FailureReason 将握手阶段的读取错误归类
+func FailureReason(err error) string {
+	var ne net.Error
+	switch {
+	case errors.As(err, &ne) && ne.Timeout():
+		return ReasonTimeout
+	case errors.Is(err, sudoku.ErrMapMiss):
+		return ReasonMapMiss
+	case errors.Is(err, crypto.ErrDecrypt):
+		return ReasonDecrypt
+	default:
+		return ReasonOther
+	}
+}
+
+// countingConn 统计读写字节数，Read 的字节数交给 read，Write 的交给 write
+type countingConn struct {
+	net.Conn
+	read, write func(n int64)
+}
+
+// CountConn 包装连接以统计指定层的流量，Read 计为 in，Write 计为 out
+func CountConn(c net.Conn, layer string) net.Conn {
+	return WrapCounting(c, Bytes.With(layer, "in").Add, Bytes.With(layer, "out").Add)
+}
+
+// WrapCounting 包装连接，每次读写后以实际字节数调用 read / write
+// 管理接口等需要按连接计数的地方共用，避免各自再包一层
+func WrapCounting(c net.Conn, read, write func(n int64)) net.Conn {
+	return &countingConn{Conn: c, read: read, write: write}
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.read(int64(n))
+	}
+	return n, err
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.write(int64(n))
+	}
+	return n, err
+}
+
+// Serve 在 addr 上提供 /metrics，addr 为空时不启动
+// 监听失败时返回错误，避免配置了指标地址却静默无输出
+func Serve(addr string) error {
+	if addr == "" {
+		return nil
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WriteText(w)
+	})
+	log.Printf("[Metrics] Listening on %s", l.Addr())
+	go func() {
+		if err := http.Serve(l, mux); err != nil {
+			log.Printf("[Metrics] Server stopped: %v", err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,365 @@
+// internal/mux/mux_test.go
+package mux
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pair 在内存连接上建立一对客户端 / 服务端会话
+func pair(t *testing.T, cfg Config) (*Session, *Session) {
+	t.Helper()
+	c1, c2 := net.Pipe()
+	client, server := Client(c1, cfg), Server(c2, cfg)
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client, server
+}
+
+// open 打开一个流并在服务端接受
+func open(t *testing.T, client, server *Session) (*Stream, *Stream) {
+	t.Helper()
+	cs, err := client.OpenStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss, err := server.AcceptStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cs, ss
+}
+
+// eventually 等待 cond 成立，最多 2 秒
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func TestStreamTransfer(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+	}{
+		{"empty", 0},
+		{"one frame", maxFramePayload},
+		{"window", initialWindow},
+		{"several windows", 4*initialWindow + 123},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := pair(t, Config{})
+			cs, ss := open(t, client, server)
+
+			data := make([]byte, tt.size)
+			rand.New(rand.NewSource(1)).Read(data)
+			// 服务端边读边回显，两个方向同时传输，任一方向都不能因对方未读而卡住
+			errs := make(chan error, 2)
+			go func() {
+				_, err := cs.Write(data)
+				errs <- err
+			}()
+			go func() {
+				_, err := io.CopyN(ss, ss, int64(tt.size))
+				ss.Close()
+				errs <- err
+			}()
+
+			// 流不支持半关闭: 读完回显的数据后对端关闭，随后返回 EOF
+			got, err := io.ReadAll(cs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for range 2 {
+				if err := <-errs; err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatalf("echoed %d bytes, want %d", len(got), len(data))
+			}
+		})
+	}
+}
+
+// TestWindowAccounting 对端不读取时写满一个窗口即阻塞，读取过半窗口后归还
+func TestWindowAccounting(t *testing.T) {
+	client, server := pair(t, Config{})
+	cs, ss := open(t, client, server)
+
+	cs.SetWriteDeadline(time.Now().Add(100 * time.Millisecond))
+	n, err := cs.Write(make([]byte, initialWindow+1))
+	if !errors.Is(err, ErrTimeout) || n != initialWindow {
+		t.Fatalf("Write = %d, %v, want %d, ErrTimeout", n, err, initialWindow)
+	}
+	cs.mu.Lock()
+	if cs.sendWindow != 0 {
+		t.Errorf("sendWindow = %d, want 0", cs.sendWindow)
+	}
+	cs.mu.Unlock()
+
+	// 读取不足半个窗口时不归还
+	buf := make([]byte, initialWindow/2-1)
+	if _, err := io.ReadFull(ss, buf); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	cs.mu.Lock()
+	if cs.sendWindow != 0 {
+		t.Errorf("sendWindow = %d after reading less than half, want 0", cs.sendWindow)
+	}
+	cs.mu.Unlock()
+
+	// 再读 1 字节达到半个窗口，对端获得同样大小的窗口
+	if _, err := io.ReadFull(ss, buf[:1]); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "window update", func() bool {
+		cs.mu.Lock()
+		defer cs.mu.Unlock()
+		return cs.sendWindow == initialWindow/2
+	})
+	ss.mu.Lock()
+	if ss.recvWindow != initialWindow/2 || ss.consumed != 0 {
+		t.Errorf("recvWindow = %d, consumed = %d, want %d, 0", ss.recvWindow, ss.consumed, initialWindow/2)
+	}
+	ss.mu.Unlock()
+
+	cs.SetWriteDeadline(time.Time{})
+	if n, err := cs.Write(make([]byte, initialWindow/2)); err != nil || n != initialWindow/2 {
+		t.Fatalf("Write after window update = %d, %v", n, err)
+	}
+}
+
+// TestPeerExceedsWindow 对端无视接收窗口时关闭会话
+func TestPeerExceedsWindow(t *testing.T) {
+	c1, c2 := net.Pipe()
+	server := Server(c2, Config{})
+	defer server.Close()
+	defer c1.Close()
+
+	frame := func(typ byte, id uint32, payload []byte) []byte {
+		b := []byte{typ, 0, 0, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(b[1:5], id)
+		binary.BigEndian.PutUint16(b[5:7], uint16(len(payload)))
+		return append(b, payload...)
+	}
+	go io.Copy(io.Discard, c1)
+	c1.Write(frame(frameOpen, 1, nil))
+	if _, err := server.AcceptStream(); err != nil {
+		t.Fatal(err)
+	}
+	chunk := make([]byte, maxFramePayload)
+	for sent := 0; sent <= initialWindow; sent += len(chunk) {
+		if _, err := c1.Write(frame(frameData, 1, chunk)); err != nil {
+			break
+		}
+	}
+	select {
+	case <-server.CloseChan():
+	case <-time.After(2 * time.Second):
+		t.Fatal("session still open after peer exceeded the window")
+	}
+}
+
+// TestRemoteCloseDrainsBuffer 对端关闭后仍可读完已收到的数据，随后返回 EOF
+func TestRemoteCloseDrainsBuffer(t *testing.T) {
+	client, server := pair(t, Config{})
+	cs, ss := open(t, client, server)
+
+	cs.Write([]byte("hello"))
+	cs.Close()
+	got, err := io.ReadAll(ss)
+	if err != nil || string(got) != "hello" {
+		t.Fatalf("ReadAll = %q, %v", got, err)
+	}
+	if _, err := ss.Write([]byte("x")); !errors.Is(err, ErrStreamClosed) {
+		t.Fatalf("Write after remote close = %v, want ErrStreamClosed", err)
+	}
+	ss.Close()
+	eventually(t, "streams removed", func() bool { return client.NumStreams() == 0 && server.NumStreams() == 0 })
+}
+
+// TestSessionCloseUnblocks 会话关闭时阻塞中的读写立即返回
+func TestSessionCloseUnblocks(t *testing.T) {
+	client, server := pair(t, Config{})
+	cs, _ := open(t, client, server)
+	cs2, _ := open(t, client, server)
+
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := cs.Read(make([]byte, 1))
+		readErr <- err
+	}()
+	writeErr := make(chan error, 1)
+	go func() {
+		_, err := cs2.Write(make([]byte, 2*initialWindow)) // 对端不读，写满窗口后阻塞
+		writeErr <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	server.Close()
+
+	for _, ch := range []chan error{readErr, writeErr} {
+		select {
+		case err := <-ch:
+			if err == nil {
+				t.Error("blocked call returned nil error after session close")
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("blocked call did not return after session close")
+		}
+	}
+	// 连接断开后对端会话随之关闭
+	eventually(t, "client session closed", client.IsClosed)
+	if _, err := client.OpenStream(); !errors.Is(err, ErrSessionClosed) {
+		t.Fatalf("OpenStream after close = %v, want ErrSessionClosed", err)
+	}
+}
+
+// TestCloseRace 两端同时关闭大量流，最终两端都不再保留任何流
+func TestCloseRace(t *testing.T) {
+	client, server := pair(t, Config{})
+	go func() {
+		for {
+			ss, err := server.AcceptStream()
+			if err != nil {
+				return
+			}
+			go func() {
+				ss.Write([]byte("x"))
+				ss.Close()
+			}()
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cs, err := client.OpenStream()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if i%2 == 0 {
+				cs.Read(make([]byte, 1))
+			}
+			cs.Close()
+			cs.Close() // 重复关闭无副作用
+		}()
+	}
+	wg.Wait()
+	eventually(t, "streams removed", func() bool { return client.NumStreams() == 0 && server.NumStreams() == 0 })
+	if client.IsClosed() || server.IsClosed() {
+		t.Fatal("session closed during stream close race")
+	}
+}
+
+func TestMaxStreams(t *testing.T) {
+	client, server := pair(t, Config{MaxStreams: 1})
+	open(t, client, server)
+
+	if client.CanOpen() {
+		t.Error("CanOpen = true with MaxStreams streams open")
+	}
+	if _, err := client.OpenStream(); !errors.Is(err, ErrTooManyStream) {
+		t.Fatalf("OpenStream = %v, want ErrTooManyStream", err)
+	}
+}
+
+// TestServerRejectsOverLimit 客户端上限大于服务端时，多出的流被服务端关闭
+func TestServerRejectsOverLimit(t *testing.T) {
+	c1, c2 := net.Pipe()
+	client := Client(c1, Config{MaxStreams: 4})
+	server := Server(c2, Config{MaxStreams: 1})
+	defer client.Close()
+	defer server.Close()
+
+	open(t, client, server)
+	extra, err := client.OpenStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	extra.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := extra.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("Read on rejected stream = %v, want EOF", err)
+	}
+	if n := server.NumStreams(); n != 1 {
+		t.Fatalf("server streams = %d, want 1", n)
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	client, server := pair(t, Config{IdleTimeout: 50 * time.Millisecond})
+	cs, _ := open(t, client, server)
+
+	time.Sleep(100 * time.Millisecond)
+	if client.IsClosed() {
+		t.Fatal("session closed while a stream was open")
+	}
+	cs.Close()
+	eventually(t, "idle close", client.IsClosed)
+}
+
+// TestCloseWhenIdle 已有的流继续可用，最后一个流结束后会话立即关闭
+func TestCloseWhenIdle(t *testing.T) {
+	client, server := pair(t, Config{IdleTimeout: time.Hour})
+	cs, ss := open(t, client, server)
+
+	client.CloseWhenIdle()
+	if _, err := client.OpenStream(); !errors.Is(err, ErrSessionClosed) {
+		t.Fatalf("OpenStream after CloseWhenIdle = %v, want ErrSessionClosed", err)
+	}
+	go ss.Write([]byte("ok"))
+	if _, err := io.ReadFull(cs, make([]byte, 2)); err != nil {
+		t.Fatalf("existing stream: %v", err)
+	}
+	if client.IsClosed() {
+		t.Fatal("session closed while a stream was open")
+	}
+	cs.Close()
+	eventually(t, "close after the last stream", client.IsClosed)
+
+	idle, _ := pair(t, Config{})
+	idle.CloseWhenIdle()
+	if !idle.IsClosed() {
+		t.Fatal("session without streams not closed")
+	}
+}
+
+// TestSessionCloseDrainsBuffer 会话关闭前收到的数据仍可读完，之后 Read 返回 EOF、Write 返回错误
+func TestSessionCloseDrainsBuffer(t *testing.T) {
+	client, server := pair(t, Config{})
+	cs, ss := open(t, client, server)
+
+	ss.Write([]byte("hello"))
+	eventually(t, "data buffered", func() bool {
+		cs.mu.Lock()
+		defer cs.mu.Unlock()
+		return cs.buf.Len() == 5
+	})
+	client.Close()
+
+	got, err := io.ReadAll(cs)
+	if err != nil || string(got) != "hello" {
+		t.Fatalf("ReadAll = %q, %v", got, err)
+	}
+	if _, err := cs.Write([]byte("x")); err == nil {
+		t.Fatal("Write after session close succeeded")
+	}
+}
@@ -0,0 +1,328 @@
+// internal/mux/session.go
+package mux
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// 帧格式: [Type(1)][StreamID(4)][Len(2)][Payload]
+const (
+	frameOpen   = 0x01 // 打开流 (仅客户端发起)
+	frameData   = 0x02 // 数据
+	frameClose  = 0x03 // 关闭流
+	frameWindow = 0x04 // 接收窗口更新, Payload 为 4 字节增量
+
+	headerSize      = 7
+	maxFramePayload = 16 * 1024
+
+	// initialWindow 每个流的初始接收窗口
+	initialWindow = 256 * 1024
+)
+
+var (
+	ErrSessionClosed = errors.New("mux: session closed")
+	ErrStreamClosed  = errors.New("mux: stream closed")
+	ErrTooManyStream = errors.New("mux: too many streams")
+	ErrTimeout       = &timeoutError{}
+)
+
+type timeoutError struct{}
+
+func (e *timeoutError) Error() string   { return "mux: i/o timeout" }
+func (e *timeoutError) Timeout() bool   { return true }
+func (e *timeoutError) Temporary() bool { return true }
+
+// Config 会话参数
+type Config struct {
+	MaxStreams  int           // 单个会话最大并发流数量
+	IdleTimeout time.Duration // 无活动流时的会话保活时间, 0 表示不超时
+}
+
+// Session 在一条已完成握手的连接上承载多个逻辑流
+type Session struct {
+	conn   net.Conn
+	cfg    Config
+	client bool
+
+	mu        sync.Mutex
+	streams   map[uint32]*Stream
+	nextID    uint32
+	idleTimer *time.Timer
+	draining  bool // CloseWhenIdle 之后: 不再打开新流，最后一个流结束时关闭
+
+	writeMu sync.Mutex
+
+	acceptCh  chan *Stream
+	die       chan struct{}
+	closeOnce sync.Once
+}
+
+// Client 创建客户端会话，负责打开流
+func Client(conn net.Conn, cfg Config) *Session {
+	return newSession(conn, cfg, true)
+}
+
+// Server 创建服务端会话，负责接受流
+func Server(conn net.Conn, cfg Config) *Session {
+	return newSession(conn, cfg, false)
+}
+
+func newSession(conn net.Conn, cfg Config, client bool) *Session {
+	s := &Session{
+		conn:     conn,
+		cfg:      cfg,
+		client:   client,
+		streams:  make(map[uint32]*Stream),
+		nextID:   1,
+		acceptCh: make(chan *Stream, 16),
+		die:      make(chan struct{}),
+	}
+	s.resetIdleLocked()
+	go s.recvLoop()
+	return s
+}
+
+// OpenStream 打开一个新的逻辑流
+func (s *Session) OpenStream() (*Stream, error) {
+	s.mu.Lock()
+	if s.IsClosed() || s.draining {
+		s.mu.Unlock()
+		return nil, ErrSessionClosed
+	}
+	if s.cfg.MaxStreams > 0 && len(s.streams) >= s.cfg.MaxStreams {
+		s.mu.Unlock()
+		return nil, ErrTooManyStream
+	}
+	id := s.nextID
+	s.nextID += 2
+	st := newStream(id, s)
+	s.streams[id] = st
+	s.resetIdleLocked()
+	s.mu.Unlock()
+
+	if err := s.writeFrame(frameOpen, id, nil); err != nil {
+		s.removeStream(id)
+		return nil, err
+	}
+	return st, nil
+}
+
+// AcceptStream 等待对端打开的流
+func (s *Session) AcceptStream() (*Stream, error) {
+	select {
+	case st := <-s.acceptCh:
+		return st, nil
+	case <-s.die:
+		return nil, ErrSessionClosed
+	}
+}
+
+// NumStreams 当前活动的流数量
+func (s *Session) NumStreams() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.streams)
+}
+
+// CanOpen 会话是否仍可承载新流
+func (s *Session) CanOpen() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.IsClosed() || s.draining {
+		return false
+	}
+	return s.cfg.MaxStreams <= 0 || len(s.streams) < s.cfg.MaxStreams
+}
+
+func (s *Session) IsClosed() bool {
+	select {
+	case <-s.die:
+		return true
+	default:
+		return false
+	}
+}
+
+// CloseChan 会话关闭时被关闭
+func (s *Session) CloseChan() <-chan struct{} {
+	return s.die
+}
+
+// CloseWhenIdle 不再打开新流，已有的流不受影响，全部结束后立即关闭会话 (不等待空闲超时)
+func (s *Session) CloseWhenIdle() {
+	s.mu.Lock()
+	s.draining = true
+	idle := len(s.streams) == 0
+	s.mu.Unlock()
+	if idle {
+		s.Close()
+	}
+}
+
+func (s *Session) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.die)
+		err = s.conn.Close()
+
+		s.mu.Lock()
+		if s.idleTimer != nil {
+			s.idleTimer.Stop()
+		}
+		streams := s.streams
+		s.streams = make(map[uint32]*Stream)
+		s.mu.Unlock()
+
+		for _, st := range streams {
+			st.sessionClosed()
+		}
+	})
+	return err
+}
+
+func (s *Session) LocalAddr() net.Addr  { return s.conn.LocalAddr() }
+func (s *Session) RemoteAddr() net.Addr { return s.conn.RemoteAddr() }
+
+// resetIdleLocked 没有活动流时启动空闲计时，有流时停止
+func (s *Session) resetIdleLocked() {
+	if s.cfg.IdleTimeout <= 0 {
+		return
+	}
+	if len(s.streams) > 0 {
+		if s.idleTimer != nil {
+			s.idleTimer.Stop()
+		}
+		return
+	}
+	if s.idleTimer == nil {
+		s.idleTimer = time.AfterFunc(s.cfg.IdleTimeout, s.onIdle)
+	} else {
+		s.idleTimer.Reset(s.cfg.IdleTimeout)
+	}
+}
+
+func (s *Session) onIdle() {
+	s.mu.Lock()
+	idle := len(s.streams) == 0
+	s.mu.Unlock()
+	if idle {
+		s.Close()
+	}
+}
+
+func (s *Session) removeStream(id uint32) {
+	s.mu.Lock()
+	if _, ok := s.streams[id]; ok {
+		delete(s.streams, id)
+		s.resetIdleLocked()
+	}
+	done := s.draining && len(s.streams) == 0
+	s.mu.Unlock()
+	if done {
+		s.Close()
+	}
+}
+
+func (s *Session) writeFrame(typ byte, id uint32, payload []byte) error {
+	buf := make([]byte, headerSize+len(payload))
+	buf[0] = typ
+	binary.BigEndian.PutUint32(buf[1:5], id)
+	binary.BigEndian.PutUint16(buf[5:7], uint16(len(payload)))
+	copy(buf[headerSize:], payload)
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if s.IsClosed() {
+		return ErrSessionClosed
+	}
+	if _, err := s.conn.Write(buf); err != nil {
+		s.Close()
+		return err
+	}
+	return nil
+}
+
+func (s *Session) recvLoop() {
+	defer s.Close()
+
+	header := make([]byte, headerSize)
+	for {
+		if _, err := io.ReadFull(s.conn, header); err != nil {
+			return
+		}
+		typ := header[0]
+		id := binary.BigEndian.Uint32(header[1:5])
+		length := int(binary.BigEndian.Uint16(header[5:7]))
+
+		var payload []byte
+		if length > 0 {
+			payload = make([]byte, length)
+			if _, err := io.ReadFull(s.conn, payload); err != nil {
+				return
+			}
+		}
+
+		switch typ {
+		case frameOpen:
+			if s.client {
+				// 客户端不接受对端打开的流
+				return
+			}
+			s.handleOpen(id)
+		case frameData:
+			if st := s.getStream(id); st != nil {
+				if !st.pushData(payload) {
+					// 对端无视接收窗口，视为协议错误
+					return
+				}
+			}
+		case frameClose:
+			if st := s.getStream(id); st != nil {
+				st.remoteClose()
+			}
+		case frameWindow:
+			if len(payload) != 4 {
+				return
+			}
+			if st := s.getStream(id); st != nil {
+				st.addWindow(binary.BigEndian.Uint32(payload))
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (s *Session) handleOpen(id uint32) {
+	s.mu.Lock()
+	if _, exists := s.streams[id]; exists {
+		s.mu.Unlock()
+		return
+	}
+	if s.cfg.MaxStreams > 0 && len(s.streams) >= s.cfg.MaxStreams {
+		s.mu.Unlock()
+		// 超过上限直接拒绝
+		go s.writeFrame(frameClose, id, nil)
+		return
+	}
+	st := newStream(id, s)
+	s.streams[id] = st
+	s.resetIdleLocked()
+	s.mu.Unlock()
+
+	select {
+	case s.acceptCh <- st:
+	case <-s.die:
+	}
+}
+
+func (s *Session) getStream(id uint32) *Stream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.streams[id]
+}
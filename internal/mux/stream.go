@@ -0,0 +1,245 @@
+// internal/mux/stream.go
+package mux
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Stream 会话中的一个逻辑流，实现 net.Conn
+type Stream struct {
+	id   uint32
+	sess *Session
+
+	mu           sync.Mutex
+	buf          bytes.Buffer
+	recvWindow   int // 对端还可发送的字节数
+	consumed     int // 已读取但尚未归还窗口的字节数
+	sendWindow   int
+	localClosed  bool
+	remoteClosed bool
+
+	readDeadline  time.Time
+	writeDeadline time.Time
+
+	readNotify  chan struct{}
+	writeNotify chan struct{}
+	closeOnce   sync.Once
+}
+
+func newStream(id uint32, sess *Session) *Stream {
+	return &Stream{
+		id:          id,
+		sess:        sess,
+		recvWindow:  initialWindow,
+		sendWindow:  initialWindow,
+		readNotify:  make(chan struct{}, 1),
+		writeNotify: make(chan struct{}, 1),
+	}
+}
+
+func (st *Stream) ID() uint32 { return st.id }
+
+func (st *Stream) Read(p []byte) (int, error) {
+	for {
+		st.mu.Lock()
+		if st.buf.Len() > 0 {
+			n, _ := st.buf.Read(p)
+			st.consumed += n
+			var grant int
+			// 消费超过半个窗口后归还
+			if st.consumed >= initialWindow/2 && !st.remoteClosed {
+				grant = st.consumed
+				st.recvWindow += grant
+				st.consumed = 0
+			}
+			st.mu.Unlock()
+
+			if grant > 0 {
+				var inc [4]byte
+				binary.BigEndian.PutUint32(inc[:], uint32(grant))
+				st.sess.writeFrame(frameWindow, st.id, inc[:])
+			}
+			return n, nil
+		}
+		if st.remoteClosed {
+			st.mu.Unlock()
+			return 0, io.EOF
+		}
+		if st.localClosed {
+			st.mu.Unlock()
+			return 0, ErrStreamClosed
+		}
+		deadline := st.readDeadline
+		st.mu.Unlock()
+
+		if err := st.wait(st.readNotify, deadline); err == ErrSessionClosed {
+			// 会话关闭后仍允许读完缓冲区，读完返回 EOF
+			st.mu.Lock()
+			buffered := st.buf.Len()
+			st.mu.Unlock()
+			if buffered == 0 {
+				return 0, io.EOF
+			}
+		} else if err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (st *Stream) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		st.mu.Lock()
+		if st.localClosed || st.remoteClosed {
+			st.mu.Unlock()
+			return written, ErrStreamClosed
+		}
+		if st.sendWindow == 0 {
+			deadline := st.writeDeadline
+			st.mu.Unlock()
+			if err := st.wait(st.writeNotify, deadline); err != nil {
+				return written, err
+			}
+			continue
+		}
+		n := len(p)
+		if n > st.sendWindow {
+			n = st.sendWindow
+		}
+		if n > maxFramePayload {
+			n = maxFramePayload
+		}
+		st.sendWindow -= n
+		st.mu.Unlock()
+
+		if err := st.sess.writeFrame(frameData, st.id, p[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func (st *Stream) Close() error {
+	st.closeOnce.Do(func() {
+		st.mu.Lock()
+		st.localClosed = true
+		remoteClosed := st.remoteClosed
+		st.mu.Unlock()
+		st.notify()
+
+		if !remoteClosed {
+			st.sess.writeFrame(frameClose, st.id, nil)
+		}
+		st.sess.removeStream(st.id)
+	})
+	return nil
+}
+
+func (st *Stream) LocalAddr() net.Addr  { return st.sess.LocalAddr() }
+func (st *Stream) RemoteAddr() net.Addr { return st.sess.RemoteAddr() }
+
+func (st *Stream) SetDeadline(t time.Time) error {
+	st.mu.Lock()
+	st.readDeadline = t
+	st.writeDeadline = t
+	st.mu.Unlock()
+	st.notify()
+	return nil
+}
+
+func (st *Stream) SetReadDeadline(t time.Time) error {
+	st.mu.Lock()
+	st.readDeadline = t
+	st.mu.Unlock()
+	st.notify()
+	return nil
+}
+
+func (st *Stream) SetWriteDeadline(t time.Time) error {
+	st.mu.Lock()
+	st.writeDeadline = t
+	st.mu.Unlock()
+	st.notify()
+	return nil
+}
+
+// wait 阻塞直到被唤醒、超时或会话关闭，会话关闭时返回 ErrSessionClosed
+func (st *Stream) wait(ch chan struct{}, deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return ErrTimeout
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-ch:
+		return nil
+	case <-timeout:
+		return ErrTimeout
+	case <-st.sess.die:
+		return ErrSessionClosed
+	}
+}
+
+func (st *Stream) notify() {
+	select {
+	case st.readNotify <- struct{}{}:
+	default:
+	}
+	select {
+	case st.writeNotify <- struct{}{}:
+	default:
+	}
+}
+
+// pushData 收到数据帧，超出接收窗口返回 false
+func (st *Stream) pushData(p []byte) bool {
+	st.mu.Lock()
+	if len(p) > st.recvWindow {
+		st.mu.Unlock()
+		return false
+	}
+	st.recvWindow -= len(p)
+	if !st.localClosed {
+		st.buf.Write(p)
+	}
+	st.mu.Unlock()
+	st.notify()
+	return true
+}
+
+func (st *Stream) addWindow(n uint32) {
+	st.mu.Lock()
+	st.sendWindow += int(n)
+	st.mu.Unlock()
+	st.notify()
+}
+
+func (st *Stream) remoteClose() {
+	st.mu.Lock()
+	st.remoteClosed = true
+	localClosed := st.localClosed
+	st.mu.Unlock()
+	st.notify()
+	if localClosed {
+		st.sess.removeStream(st.id)
+	}
+}
+
+func (st *Stream) sessionClosed() {
+	st.mu.Lock()
+	st.remoteClosed = true
+	st.mu.Unlock()
+	st.notify()
+}
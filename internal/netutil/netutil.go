@@ -0,0 +1,13 @@
+// internal/netutil/netutil.go
+package netutil
+
+import "time"
+
+// AcceptBackoff 返回 Accept 连续失败时的下一次等待时间: 5ms 起倍增，最多 1s
+// 文件描述符耗尽等错误会立即重现，退避以免空转
+func AcceptBackoff(prev time.Duration) time.Duration {
+	if prev == 0 {
+		return 5 * time.Millisecond
+	}
+	return min(prev*2, time.Second)
+}
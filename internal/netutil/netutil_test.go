@@ -0,0 +1,19 @@
+// internal/netutil/netutil_test.go
+package netutil
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAcceptBackoff(t *testing.T) {
+	var d time.Duration
+	for _, want := range []time.Duration{5, 10, 20, 40} {
+		if d = AcceptBackoff(d); d != want*time.Millisecond {
+			t.Fatalf("AcceptBackoff = %v, want %v", d, want*time.Millisecond)
+		}
+	}
+	if d = AcceptBackoff(800 * time.Millisecond); d != time.Second {
+		t.Fatalf("AcceptBackoff = %v, want 1s cap", d)
+	}
+}
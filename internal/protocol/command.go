@@ -0,0 +1,21 @@
+// internal/protocol/command.go
+package protocol
+
+// HandshakeVersionX25519 紧跟在 16 字节时间戳握手之后，表示客户端发起 v2 握手:
+// 双方交换经 PSK 认证的 X25519 临时公钥并派生按方向区分的会话密钥。
+// 旧版 (v1) 客户端不发送版本字节，直接发送下方的命令字节，两者取值互不冲突
+const HandshakeVersionX25519 = 0x02
+
+// 握手完成后的首字节决定该连接的用途:
+//
+//	0xFF: Split 上下行分离请求，其后跟 [Len][UUID]，然后再跟一个命令字节
+//	0xFE: UDP 关联，后续为 Datagram 帧 (见 udp.go)
+//	0xFD: 多路复用会话，后续为 mux 帧，每个流内部再按本规则分发
+//	0xFC: 带应答的 TCP 代理，其后跟目标地址，服务端连接目标后回复 1 字节应答码 (见 reply.go)
+//	其他: SOCKS5 地址类型，即普通 TCP 代理的目标地址 (无应答)
+const (
+	SplitMagic        = 0xFF
+	UDPAssociateMagic = 0xFE
+	MuxMagic          = 0xFD
+	ConnectAckMagic   = 0xFC
+)
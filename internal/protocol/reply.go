@@ -0,0 +1,105 @@
+// internal/protocol/reply.go
+package protocol
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// 服务端对 ConnectAckMagic 请求的应答码
+const (
+	ReplySucceeded       = 0x00
+	ReplyGeneralFailure  = 0x01
+	ReplyNotAllowed      = 0x02 // 服务端规则禁止连接该目标
+	ReplyHostUnreachable = 0x03 // 网络或主机不可达
+	ReplyRefused         = 0x04 // 目标拒绝连接
+	ReplyDNSFailure      = 0x05 // 域名解析失败
+	ReplyTimeout         = 0x06 // 连接目标超时
+)
+
+// ErrNotAllowed 服务端规则禁止连接目标
+var ErrNotAllowed = errors.New("destination not allowed")
+
+// ReplyError 服务端报告的目标连接失败
+type ReplyError struct {
+	Code byte
+}
+
+func (e *ReplyError) Error() string {
+	return "server reply: " + ReplyText(e.Code)
+}
+
+func (e *ReplyError) Timeout() bool {
+	return e.Code == ReplyTimeout
+}
+
+// ReplyText 应答码的可读描述
+func ReplyText(code byte) string {
+	switch code {
+	case ReplySucceeded:
+		return "succeeded"
+	case ReplyGeneralFailure:
+		return "general failure"
+	case ReplyNotAllowed:
+		return "not allowed"
+	case ReplyHostUnreachable:
+		return "host unreachable"
+	case ReplyRefused:
+		return "connection refused"
+	case ReplyDNSFailure:
+		return "dns failure"
+	case ReplyTimeout:
+		return "timeout"
+	default:
+		return fmt.Sprintf("unknown (%d)", code)
+	}
+}
+
+// ReplyFor 将连接目标的错误归类为应答码，nil 为成功
+func ReplyFor(err error) byte {
+	var re *ReplyError
+	var dnsErr *net.DNSError
+	var ne net.Error
+	switch {
+	case err == nil:
+		return ReplySucceeded
+	case errors.As(err, &re):
+		return re.Code
+	case errors.Is(err, ErrNotAllowed):
+		return ReplyNotAllowed
+	case errors.As(err, &dnsErr):
+		if dnsErr.IsTimeout {
+			return ReplyTimeout
+		}
+		return ReplyDNSFailure
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &ne) && ne.Timeout():
+		return ReplyTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ReplyRefused
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return ReplyHostUnreachable
+	default:
+		return ReplyGeneralFailure
+	}
+}
+
+// SocksReply 应答码对应的 SOCKS5 REP 字段
+func SocksReply(code byte) byte {
+	switch code {
+	case ReplySucceeded:
+		return 0x00
+	case ReplyNotAllowed:
+		return 0x02
+	case ReplyHostUnreachable, ReplyDNSFailure:
+		return 0x04
+	case ReplyRefused:
+		return 0x05
+	case ReplyTimeout:
+		return 0x06
+	default:
+		return 0x01
+	}
+}
@@ -0,0 +1,57 @@
+// internal/protocol/reply_test.go
+package protocol
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestReplyFor(t *testing.T) {
+	dialErr := func(errno syscall.Errno) error {
+		return &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", errno)}
+	}
+	tests := []struct {
+		name  string
+		err   error
+		code  byte
+		socks byte
+	}{
+		{"success", nil, ReplySucceeded, 0x00},
+		{"not allowed", fmt.Errorf("acl: %w", ErrNotAllowed), ReplyNotAllowed, 0x02},
+		{"refused", dialErr(syscall.ECONNREFUSED), ReplyRefused, 0x05},
+		{"host unreachable", dialErr(syscall.EHOSTUNREACH), ReplyHostUnreachable, 0x04},
+		{"network unreachable", dialErr(syscall.ENETUNREACH), ReplyHostUnreachable, 0x04},
+		{"dns not found", &net.DNSError{Err: "no such host", Name: "x.invalid", IsNotFound: true}, ReplyDNSFailure, 0x04},
+		{"dns timeout", &net.DNSError{Err: "timeout", Name: "x.test", IsTimeout: true}, ReplyTimeout, 0x06},
+		{"deadline", context.DeadlineExceeded, ReplyTimeout, 0x06},
+		{"server reply", &ReplyError{Code: ReplyRefused}, ReplyRefused, 0x05},
+		{"wrapped server reply", fmt.Errorf("dial: %w", &ReplyError{Code: ReplyDNSFailure}), ReplyDNSFailure, 0x04},
+		{"other", errors.New("boom"), ReplyGeneralFailure, 0x01},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := ReplyFor(tt.err)
+			if code != tt.code {
+				t.Fatalf("ReplyFor = %s, want %s", ReplyText(code), ReplyText(tt.code))
+			}
+			if got := SocksReply(code); got != tt.socks {
+				t.Fatalf("SocksReply = %#x, want %#x", got, tt.socks)
+			}
+		})
+	}
+}
+
+// TestReplyErrorTimeout 服务端报告的超时可被 os.IsTimeout 等按 Timeout 方法识别
+func TestReplyErrorTimeout(t *testing.T) {
+	if !os.IsTimeout(&ReplyError{Code: ReplyTimeout}) {
+		t.Fatal("timeout reply is not a timeout")
+	}
+	if os.IsTimeout(&ReplyError{Code: ReplyRefused}) {
+		t.Fatal("refused reply reported as timeout")
+	}
+}
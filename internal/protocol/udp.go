@@ -0,0 +1,53 @@
+// internal/protocol/udp.go
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// MaxDatagramSize UDP 负载的最大长度
+const MaxDatagramSize = 65535
+
+// WriteDatagram 将一个 UDP 包写入流
+// 帧格式: [SOCKS5 地址][Len(2)][Payload]
+// 整帧通过一次 Write 发出，避免被 AEAD 层拆成多个帧
+func WriteDatagram(w io.Writer, addr string, payload []byte) error {
+	if len(payload) > MaxDatagramSize {
+		return errors.New("datagram too large")
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(payload) + 262)
+	if err := WriteAddress(&buf, addr); err != nil {
+		return err
+	}
+	var lenBytes [2]byte
+	binary.BigEndian.PutUint16(lenBytes[:], uint16(len(payload)))
+	buf.Write(lenBytes[:])
+	buf.Write(payload)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// ReadDatagram 从流中读取一个 UDP 包
+// 返回: 地址 (host:port), 负载, error
+func ReadDatagram(r io.Reader) (string, []byte, error) {
+	addr, _, _, err := ReadAddress(r)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var lenBytes [2]byte
+	if _, err := io.ReadFull(r, lenBytes[:]); err != nil {
+		return "", nil, err
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(lenBytes[:]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return "", nil, err
+	}
+	return addr, payload, nil
+}
@@ -0,0 +1,95 @@
+// internal/protocol/udp_test.go
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestDatagramFraming(t *testing.T) {
+	tests := []struct {
+		name    string
+		addr    string
+		payload []byte
+		wire    []byte // 为空时只检查往返
+	}{
+		{"ipv4", "192.0.2.1:53", []byte("hi"), []byte{AddrTypeIPv4, 192, 0, 2, 1, 0, 53, 0, 2, 'h', 'i'}},
+		{"domain", "example.com:443", []byte{1}, append(append([]byte{AddrTypeDomain, 11}, "example.com"...), 0x01, 0xBB, 0, 1, 1)},
+		{"ipv6", "[2001:db8::1]:8080", []byte("x"), nil},
+		{"empty payload", "192.0.2.1:1", nil, []byte{AddrTypeIPv4, 192, 0, 2, 1, 0, 1, 0, 0}},
+		{"max payload", "192.0.2.1:1", make([]byte, MaxDatagramSize), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteDatagram(&buf, tt.addr, tt.payload); err != nil {
+				t.Fatal(err)
+			}
+			if tt.wire != nil && !bytes.Equal(buf.Bytes(), tt.wire) {
+				t.Fatalf("wire = %x, want %x", buf.Bytes(), tt.wire)
+			}
+			addr, payload, err := ReadDatagram(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if addr != tt.addr || !bytes.Equal(payload, tt.payload) {
+				t.Fatalf("ReadDatagram = %s, %d bytes, want %s, %d bytes", addr, len(payload), tt.addr, len(tt.payload))
+			}
+			if buf.Len() != 0 {
+				t.Fatalf("%d bytes left after one frame", buf.Len())
+			}
+		})
+	}
+}
+
+// TestDatagramBackToBack 连续的帧在流上逐个读出，互不粘连
+func TestDatagramBackToBack(t *testing.T) {
+	var buf bytes.Buffer
+	for _, p := range []string{"one", "", "three"} {
+		WriteDatagram(&buf, "192.0.2.1:9", []byte(p))
+	}
+	for _, want := range []string{"one", "", "three"} {
+		if _, p, err := ReadDatagram(&buf); err != nil || string(p) != want {
+			t.Fatalf("ReadDatagram = %q, %v, want %q", p, err, want)
+		}
+	}
+	if _, _, err := ReadDatagram(&buf); err != io.EOF {
+		t.Fatalf("ReadDatagram at end = %v, want EOF", err)
+	}
+}
+
+func TestDatagramRejects(t *testing.T) {
+	var frame bytes.Buffer
+	WriteDatagram(&frame, "192.0.2.1:53", []byte("payload"))
+	full := frame.Bytes()
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"unknown address type", []byte{0x02, 0, 0, 0, 0}},
+		{"truncated address", full[:3]},
+		{"truncated length", full[:8]},
+		{"truncated payload", full[:len(full)-1]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := ReadDatagram(bytes.NewReader(tt.data)); err == nil {
+				t.Fatal("ReadDatagram succeeded, want error")
+			}
+		})
+	}
+
+	if err := WriteDatagram(io.Discard, "192.0.2.1:53", make([]byte, MaxDatagramSize+1)); err == nil {
+		t.Error("WriteDatagram accepted an oversized payload")
+	}
+	if err := WriteDatagram(io.Discard, "no-port", nil); err == nil {
+		t.Error("WriteDatagram accepted an address without port")
+	}
+	if _, _, err := ReadDatagram(bytes.NewReader(full[:len(full)-1])); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("truncated payload err = %v, want ErrUnexpectedEOF", err)
+	}
+}
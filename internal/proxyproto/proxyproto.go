@@ -0,0 +1,243 @@
+// internal/proxyproto/proxyproto.go
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// v2 头部的固定签名
+var signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// v1 头部最长 107 字节 (含 CRLF)
+const maxV1Len = 107
+
+var ErrNoHeader = errors.New("proxyproto: missing PROXY protocol header")
+
+// Header 生成 HAProxy PROXY protocol 头 (version 为 1 或 2)
+// src/dst 不是 TCP 地址时生成 UNKNOWN (v1) 或 LOCAL (v2) 头，接收方将使用连接本身的地址
+func Header(version int, src, dst net.Addr) []byte {
+	s, sok := src.(*net.TCPAddr)
+	d, dok := dst.(*net.TCPAddr)
+	ok := sok && dok
+	var sIP, dIP net.IP
+	v4 := false
+	if ok {
+		sIP, dIP = s.IP.To4(), d.IP.To4()
+		if v4 = sIP != nil && dIP != nil; !v4 {
+			// 地址族不一致时统一为 IPv6 (IPv4 映射地址)
+			sIP, dIP = s.IP.To16(), d.IP.To16()
+			ok = sIP != nil && dIP != nil
+		}
+	}
+
+	if version == 1 {
+		if !ok {
+			return []byte("PROXY UNKNOWN\r\n")
+		}
+		if v4 {
+			return fmt.Appendf(nil, "PROXY TCP4 %s %s %d %d\r\n", sIP, dIP, s.Port, d.Port)
+		}
+		// TCP6 须使用 IPv6 写法，net.IP 会把 IPv4 映射地址打印为点分十进制
+		sAddr, dAddr := netip.AddrFrom16([16]byte(sIP)), netip.AddrFrom16([16]byte(dIP))
+		return fmt.Appendf(nil, "PROXY TCP6 %s %s %d %d\r\n", sAddr, dAddr, s.Port, d.Port)
+	}
+
+	b := append([]byte(nil), signature...)
+	if !ok {
+		return append(b, 0x20, 0x00, 0x00, 0x00) // LOCAL
+	}
+	fam := byte(0x21) // TCP over IPv6
+	if v4 {
+		fam = 0x11 // TCP over IPv4
+	}
+	b = append(b, 0x21, fam)
+	b = binary.BigEndian.AppendUint16(b, uint16(2*len(sIP)+4))
+	b = append(b, sIP...)
+	b = append(b, dIP...)
+	b = binary.BigEndian.AppendUint16(b, uint16(s.Port))
+	b = binary.BigEndian.AppendUint16(b, uint16(d.Port))
+	return b
+}
+
+// Conn 已读取 PROXY 头的连接，RemoteAddr/LocalAddr 返回头部中的地址
+type Conn struct {
+	net.Conn
+	r      *bufio.Reader // 读取头部时多读的数据，读完后置空
+	remote net.Addr
+	local  net.Addr
+}
+
+func (c *Conn) Read(p []byte) (int, error) {
+	if c.r != nil {
+		if c.r.Buffered() > 0 {
+			return c.r.Read(p)
+		}
+		c.r = nil
+	}
+	return c.Conn.Read(p)
+}
+
+func (c *Conn) RemoteAddr() net.Addr { return c.remote }
+func (c *Conn) LocalAddr() net.Addr  { return c.local }
+
+// Accept 读取并解析 conn 开头的 PROXY 头 (自动识别 v1/v2)
+// 调用方负责设置读取超时；UNKNOWN/LOCAL 头保留连接本身的地址
+func Accept(conn net.Conn) (*Conn, error) {
+	c := &Conn{Conn: conn, r: bufio.NewReaderSize(conn, 256), remote: conn.RemoteAddr(), local: conn.LocalAddr()}
+	// v1 最短的 "PROXY UNKNOWN\r\n" 也有 15 字节，预读 12 字节不会阻塞合法连接
+	peek, err := c.r.Peek(len(signature))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case bytes.Equal(peek, signature):
+		err = c.readV2()
+	case bytes.HasPrefix(peek, []byte("PROXY ")):
+		err = c.readV1()
+	default:
+		err = ErrNoHeader
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Conn) readV1() error {
+	var line []byte
+	for len(line) < maxV1Len {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	s, ok := strings.CutSuffix(string(line), "\r\n")
+	if !ok {
+		return fmt.Errorf("proxyproto: malformed v1 header")
+	}
+
+	fields := strings.Split(s, " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return fmt.Errorf("proxyproto: malformed v1 header %q", s)
+	}
+	src, err1 := parseV1Addr(fields[2], fields[4])
+	dst, err2 := parseV1Addr(fields[3], fields[5])
+	if err := errors.Join(err1, err2); err != nil {
+		return fmt.Errorf("proxyproto: malformed v1 header %q: %w", s, err)
+	}
+	c.remote, c.local = src, dst
+	return nil
+}
+
+func parseV1Addr(host, port string) (*net.TCPAddr, error) {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid address %q", host)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q", port)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(p)}, nil
+}
+
+func (c *Conn) readV2() error {
+	var hdr [16]byte
+	if _, err := io.ReadFull(c.r, hdr[:]); err != nil {
+		return err
+	}
+	if hdr[12]>>4 != 2 {
+		return fmt.Errorf("proxyproto: unsupported v2 version %d", hdr[12]>>4)
+	}
+	body := make([]byte, binary.BigEndian.Uint16(hdr[14:]))
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return err
+	}
+
+	switch hdr[12] & 0x0F {
+	case 0x0: // LOCAL: 负载均衡自身的连接 (如健康检查)
+		return nil
+	case 0x1: // PROXY
+	default:
+		return fmt.Errorf("proxyproto: unknown v2 command %d", hdr[12]&0x0F)
+	}
+
+	var ipLen int
+	switch hdr[13] >> 4 {
+	case 0x1:
+		ipLen = net.IPv4len
+	case 0x2:
+		ipLen = net.IPv6len
+	default:
+		// UNSPEC 或 UNIX 地址，保留连接本身的地址
+		return nil
+	}
+	if len(body) < 2*ipLen+4 {
+		return fmt.Errorf("proxyproto: short v2 address block")
+	}
+	// 其后的 TLV 扩展直接忽略
+	c.remote = &net.TCPAddr{
+		IP:   net.IP(body[:ipLen]),
+		Port: int(binary.BigEndian.Uint16(body[2*ipLen:])),
+	}
+	c.local = &net.TCPAddr{
+		IP:   net.IP(body[ipLen : 2*ipLen]),
+		Port: int(binary.BigEndian.Uint16(body[2*ipLen+2:])),
+	}
+	return nil
+}
+
+// Trusted 允许发送 PROXY 头的来源 (负载均衡的地址)
+type Trusted []netip.Prefix
+
+// ParseTrusted 解析 CIDR 列表，也可直接写单个 IP
+func ParseTrusted(list []string) (Trusted, error) {
+	t := make(Trusted, 0, len(list))
+	for _, s := range list {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			addr, aerr := netip.ParseAddr(s)
+			if aerr != nil {
+				return nil, fmt.Errorf("proxyproto: invalid trusted source %q", s)
+			}
+			p = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		t = append(t, p.Masked())
+	}
+	return t, nil
+}
+
+// Contains 判断连接的对端是否为受信任的来源，IPv4 映射地址按 IPv4 判断
+func (t Trusted) Contains(addr net.Addr) bool {
+	a, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	ip, ok := netip.AddrFromSlice(a.IP)
+	if !ok {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, p := range t {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
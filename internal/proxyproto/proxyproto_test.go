@@ -0,0 +1,210 @@
+// internal/proxyproto/proxyproto_test.go
+package proxyproto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakeConn 从固定数据读取的连接
+type fakeConn struct {
+	net.Conn
+	r io.Reader
+}
+
+var (
+	connRemote = &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 40000}
+	connLocal  = &net.TCPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 443}
+)
+
+func (c *fakeConn) Read(p []byte) (int, error) { return c.r.Read(p) }
+func (c *fakeConn) RemoteAddr() net.Addr       { return connRemote }
+func (c *fakeConn) LocalAddr() net.Addr        { return connLocal }
+
+func tcp(s string) *net.TCPAddr {
+	a, err := net.ResolveTCPAddr("tcp", s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+func sameAddr(a net.Addr, want string) bool {
+	got, w := tcp(a.String()), tcp(want)
+	return got.IP.Equal(w.IP) && got.Port == w.Port
+}
+
+// v2 构造 v2 头: cmd 为版本与命令字节，fam 为地址族字节
+func v2(cmd, fam byte, body []byte) []byte {
+	b := append([]byte(nil), signature...)
+	b = append(b, cmd, fam)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(body)))
+	return append(b, body...)
+}
+
+func TestAccept(t *testing.T) {
+	const payload = "hello"
+	v4Body := []byte{192, 0, 2, 1, 198, 51, 100, 7, 0x30, 0x39, 0x01, 0xBB}
+
+	tests := []struct {
+		name        string
+		header      []byte
+		remote      string // 为空时应保留连接本身的地址
+		local       string
+		err         string // 期望错误包含的内容，空表示成功
+		errNoHeader bool
+		errEOF      bool // 期望 io.EOF / io.ErrUnexpectedEOF
+	}{
+		{name: "v1 tcp4", header: []byte("PROXY TCP4 192.0.2.1 198.51.100.7 12345 443\r\n"), remote: "192.0.2.1:12345", local: "198.51.100.7:443"},
+		{name: "v1 tcp6", header: []byte("PROXY TCP6 2001:db8::1 2001:db8::2 1 65535\r\n"), remote: "[2001:db8::1]:1", local: "[2001:db8::2]:65535"},
+		{name: "v1 unknown", header: []byte("PROXY UNKNOWN\r\n")},
+		{name: "v1 unknown with addresses", header: []byte("PROXY UNKNOWN ffff:f...f ffff:f...f 65535 65535\r\n")},
+		{name: "v1 truncated", header: []byte("PROXY TCP4 192.0.2.1 198.51"), errEOF: true},
+		{name: "v1 oversized", header: []byte("PROXY TCP6 " + strings.Repeat("1", 120) + "\r\n"), err: "malformed v1 header"},
+		{name: "v1 missing CR", header: []byte("PROXY TCP4 192.0.2.1 198.51.100.7 12345 443\n"), err: "malformed v1 header"},
+		{name: "v1 bad protocol", header: []byte("PROXY UDP4 192.0.2.1 198.51.100.7 12345 443\r\n"), err: "malformed v1 header"},
+		{name: "v1 bad address", header: []byte("PROXY TCP4 192.0.2.300 198.51.100.7 12345 443\r\n"), err: "invalid address"},
+		{name: "v1 bad port", header: []byte("PROXY TCP4 192.0.2.1 198.51.100.7 65536 443\r\n"), err: "invalid port"},
+		{name: "v1 missing field", header: []byte("PROXY TCP4 192.0.2.1 198.51.100.7 12345\r\n"), err: "malformed v1 header"},
+
+		{name: "v2 tcp4", header: v2(0x21, 0x11, v4Body), remote: "192.0.2.1:12345", local: "198.51.100.7:443"},
+		{name: "v2 tcp6", header: v2(0x21, 0x21, append(append(append(net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")...), 0, 1), 0xFF, 0xFF)), remote: "[2001:db8::1]:1", local: "[2001:db8::2]:65535"},
+		{name: "v2 with TLV", header: v2(0x21, 0x11, append(v4Body, 0x04, 0x00, 0x01, 0xAA)), remote: "192.0.2.1:12345", local: "198.51.100.7:443"},
+		{name: "v2 local", header: v2(0x20, 0x00, nil)},
+		{name: "v2 local with addresses", header: v2(0x20, 0x11, v4Body)},
+		{name: "v2 unspec", header: v2(0x21, 0x00, nil)},
+		{name: "v2 unix", header: v2(0x21, 0x31, make([]byte, 216))},
+		{name: "v2 truncated header", header: append(append([]byte(nil), signature...), 0x21), errEOF: true},
+		{name: "v2 truncated body", header: v2(0x21, 0x11, v4Body)[:20], errEOF: true},
+		{name: "v2 short address block", header: v2(0x21, 0x11, v4Body[:8]), err: "short v2 address block"},
+		{name: "v2 bad version", header: v2(0x11, 0x11, v4Body), err: "unsupported v2 version"},
+		{name: "v2 unknown command", header: v2(0x22, 0x11, v4Body), err: "unknown v2 command"},
+
+		{name: "no header", header: []byte("GET / HTTP/1.1\r\n\r\n"), errNoHeader: true},
+		{name: "short input", header: []byte("PROXY"), errEOF: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := append(append([]byte(nil), tt.header...), payload...)
+			if tt.errEOF {
+				in = tt.header
+			}
+			c, err := Accept(&fakeConn{r: bytes.NewReader(in)})
+
+			switch {
+			case tt.errNoHeader:
+				if !errors.Is(err, ErrNoHeader) {
+					t.Fatalf("err = %v, want ErrNoHeader", err)
+				}
+				return
+			case tt.errEOF:
+				if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+					t.Fatalf("err = %v, want EOF", err)
+				}
+				return
+			case tt.err != "":
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wantRemote, wantLocal := connRemote.String(), connLocal.String()
+			if tt.remote != "" {
+				wantRemote, wantLocal = tt.remote, tt.local
+			}
+			if got := c.RemoteAddr().String(); got != wantRemote {
+				t.Errorf("RemoteAddr = %s, want %s", got, wantRemote)
+			}
+			if got := c.LocalAddr().String(); got != wantLocal {
+				t.Errorf("LocalAddr = %s, want %s", got, wantLocal)
+			}
+			// 头部之后的数据原样保留
+			if rest, _ := io.ReadAll(c); string(rest) != payload {
+				t.Errorf("payload = %q, want %q", rest, payload)
+			}
+		})
+	}
+}
+
+// TestHeaderV1Mixed 地址族不一致的 v1 头中 IPv4 以 IPv4 映射的 IPv6 写法出现
+func TestHeaderV1Mixed(t *testing.T) {
+	got := string(Header(1, tcp("[2001:db8::1]:5000"), tcp("198.51.100.7:80")))
+	want := "PROXY TCP6 2001:db8::1 ::ffff:198.51.100.7 5000 80\r\n"
+	if got != want {
+		t.Fatalf("Header = %q, want %q", got, want)
+	}
+}
+
+// TestHeaderRoundTrip Header 生成的头部经 Accept 解析后得到相同的地址
+func TestHeaderRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		src, dst   net.Addr
+		wantSrc    string
+		wantDst    string
+		keepsConns bool // UNKNOWN / LOCAL，保留连接本身的地址
+	}{
+		{name: "ipv4", src: tcp("192.0.2.1:5000"), dst: tcp("198.51.100.7:80"), wantSrc: "192.0.2.1:5000", wantDst: "198.51.100.7:80"},
+		{name: "ipv6", src: tcp("[2001:db8::1]:5000"), dst: tcp("[2001:db8::2]:80"), wantSrc: "[2001:db8::1]:5000", wantDst: "[2001:db8::2]:80"},
+		{name: "mixed", src: tcp("[2001:db8::1]:5000"), dst: tcp("198.51.100.7:80"), wantSrc: "[2001:db8::1]:5000", wantDst: "198.51.100.7:80"},
+		{name: "not tcp", src: &net.UnixAddr{Name: "/tmp/s", Net: "unix"}, dst: tcp("198.51.100.7:80"), keepsConns: true},
+	}
+	for _, version := range []int{1, 2} {
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%s/v%d", tt.name, version), func(t *testing.T) {
+				h := Header(version, tt.src, tt.dst)
+				c, err := Accept(&fakeConn{r: bytes.NewReader(h)})
+				if err != nil {
+					t.Fatalf("Accept(%q): %v", h, err)
+				}
+				wantSrc, wantDst := tt.wantSrc, tt.wantDst
+				if tt.keepsConns {
+					wantSrc, wantDst = connRemote.String(), connLocal.String()
+				}
+				// 地址族不一致时 IPv4 变为 IPv4 映射地址，按 IP.Equal 比较
+				if !sameAddr(c.RemoteAddr(), wantSrc) {
+					t.Errorf("RemoteAddr = %s, want %s", c.RemoteAddr(), wantSrc)
+				}
+				if !sameAddr(c.LocalAddr(), wantDst) {
+					t.Errorf("LocalAddr = %s, want %s", c.LocalAddr(), wantDst)
+				}
+			})
+		}
+	}
+}
+
+func TestTrusted(t *testing.T) {
+	trusted, err := ParseTrusted([]string{"10.0.0.0/8", "2001:db8::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		addr net.Addr
+		want bool
+	}{
+		{tcp("10.1.2.3:5000"), true},
+		{tcp("[::ffff:10.1.2.3]:5000"), true},
+		{tcp("[2001:db8::1]:5000"), true},
+		{tcp("[2001:db8::2]:5000"), false},
+		{tcp("192.0.2.1:5000"), false},
+		{&net.UnixAddr{Name: "/tmp/s", Net: "unix"}, false},
+	}
+	for _, tt := range tests {
+		if got := trusted.Contains(tt.addr); got != tt.want {
+			t.Errorf("Contains(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+	if _, err := ParseTrusted([]string{"lb.example"}); err == nil {
+		t.Fatal("ParseTrusted accepted a host name")
+	}
+}
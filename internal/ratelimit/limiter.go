@@ -0,0 +1,179 @@
+// internal/ratelimit/limiter.go
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// minBurst 令牌桶容量下限，避免低速率时单次读写被切得过碎
+const minBurst = 64 * 1024
+
+// Bucket 令牌桶，速率单位为字节/秒，速率为 0 时不限速
+// 允许令牌透支: 一次消耗超过容量时先放行，随后按欠量等待，
+// 因此单次读写的大小不受桶容量限制
+type Bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	source *atomic.Int64 // 非空时每次等待前从此读取最新速率，热更新因此作用于已建立的连接
+}
+
+// NewBucket 创建令牌桶，bytesPerSec <= 0 时返回 nil (不限速)
+func NewBucket(bytesPerSec int64) *Bucket {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	b := &Bucket{last: time.Now()}
+	b.setRate(bytesPerSec)
+	b.tokens = b.burst
+	return b
+}
+
+// newSharedBucket 创建速率跟随 source 的令牌桶，source 当前 <= 0 时返回 nil
+func newSharedBucket(source *atomic.Int64) *Bucket {
+	b := NewBucket(source.Load())
+	if b != nil {
+		b.source = source
+	}
+	return b
+}
+
+func (b *Bucket) setRate(bytesPerSec int64) {
+	b.rate = float64(bytesPerSec)
+	b.burst = b.rate
+	if b.burst < minBurst {
+		b.burst = minBurst
+	}
+}
+
+// SetRate 调整速率，已有的令牌保留，bytesPerSec <= 0 时改为不限速
+func (b *Bucket) SetRate(bytesPerSec int64) {
+	b.mu.Lock()
+	b.setRateLocked(time.Now(), bytesPerSec)
+	b.mu.Unlock()
+}
+
+func (b *Bucket) setRateLocked(now time.Time, bytesPerSec int64) {
+	b.refill(now)
+	if bytesPerSec < 0 {
+		bytesPerSec = 0
+	}
+	b.setRate(bytesPerSec)
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// WaitN 消耗 n 个令牌，不足时阻塞，ctx 结束时提前返回 ctx.Err()
+func (b *Bucket) WaitN(ctx context.Context, n int) error {
+	return sleep(ctx, b.reserve(n))
+}
+
+// reserve 立即扣除 n 个令牌 (可透支)，返回补足欠量所需的等待时间
+func (b *Bucket) reserve(n int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	if b.source != nil {
+		if r := b.source.Load(); float64(max(r, 0)) != b.rate {
+			b.setRateLocked(now, r)
+		}
+	}
+	if b.rate == 0 {
+		return 0
+	}
+	b.refill(now)
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// reserveAll 在每个令牌桶上扣除 n 个令牌，返回其中最长的等待时间
+// 各级令牌桶同时补充，只需等待最慢的一个，而不是依次等待每一个
+func reserveAll(buckets []*Bucket, n int) time.Duration {
+	var wait time.Duration
+	for _, b := range buckets {
+		wait = max(wait, b.reserve(n))
+	}
+	return wait
+}
+
+// sleep 等待 d，ctx 结束时提前返回 ctx.Err()
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// active 速率为 0 的令牌桶不再分配给新连接
+func (b *Bucket) active() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.rate > 0
+}
+
+func (b *Bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.last).Seconds()
+	b.last = now
+	b.tokens += elapsed * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// Conn 对读写分别应用一组令牌桶，Close 会中断正在进行的等待
+type Conn struct {
+	net.Conn
+	read   []*Bucket
+	write  []*Bucket
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewConn 包装连接，两组桶都为空时原样返回
+func NewConn(c net.Conn, read, write []*Bucket) net.Conn {
+	if len(read) == 0 && len(write) == 0 {
+		return c
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Conn{Conn: c, read: read, write: write, ctx: ctx, cancel: cancel}
+}
+
+func (c *Conn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 && sleep(c.ctx, reserveAll(c.read, n)) != nil {
+		return n, net.ErrClosed
+	}
+	return n, err
+}
+
+func (c *Conn) Write(p []byte) (int, error) {
+	if sleep(c.ctx, reserveAll(c.write, len(p))) != nil {
+		return 0, net.ErrClosed
+	}
+	return c.Conn.Write(p)
+}
+
+func (c *Conn) Close() error {
+	c.cancel()
+	return c.Conn.Close()
+}
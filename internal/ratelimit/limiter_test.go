@@ -0,0 +1,116 @@
+// internal/ratelimit/limiter_test.go
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Futaiii/Sudoku_ASCII/internal/config"
+)
+
+// overdraw 透支约 10 秒的令牌 (1 KB/s 时)
+const overdraw = minBurst + 10*bytesPerKB
+
+func limiterConfig(global, perUser, perConn int64) *config.Config {
+	return &config.Config{RateLimit: &config.RateLimitConfig{GlobalKBps: global, PerUserKBps: perUser, PerConnKBps: perConn}}
+}
+
+// waitsLong 在 100ms 内未完成等待即视为被限速
+func waitsLong(b *Bucket, n int) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	return b.WaitN(ctx, n) != nil
+}
+
+func TestWaitNCancel(t *testing.T) {
+	b := NewBucket(bytesPerKB)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	start := time.Now()
+	if err := b.WaitN(ctx, overdraw); !errors.Is(err, context.Canceled) {
+		t.Fatalf("WaitN = %v, want context.Canceled", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("WaitN returned after %v", d)
+	}
+}
+
+// TestReserveAllWaitsOnce 多级令牌桶同时透支时只等待最长的欠量，而不是各级之和
+func TestReserveAllWaitsOnce(t *testing.T) {
+	slow, fast := NewBucket(bytesPerKB), NewBucket(2*bytesPerKB)
+	wait := reserveAll([]*Bucket{slow, fast}, overdraw)
+	if wait < 9*time.Second || wait > 10*time.Second {
+		t.Fatalf("reserveAll = %v, want about 10s", wait)
+	}
+	// 每一级都已扣除令牌
+	if !waitsLong(fast, 1) {
+		t.Fatal("fast bucket not debited")
+	}
+}
+
+// TestReloadToUnlimited 热更新将速率改为 0 后，已建立连接的令牌桶不再限速
+func TestReloadToUnlimited(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		cfg  *config.Config
+	}{
+		{"global", limiterConfig(1, 0, 0)},
+		{"per user", limiterConfig(0, 1, 0)},
+		{"per conn", limiterConfig(0, 0, 1)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLimiter(tt.cfg)
+			up, _ := l.Buckets("alice")
+			if len(up) != 1 {
+				t.Fatalf("got %d buckets, want 1", len(up))
+			}
+			if !waitsLong(up[0], overdraw) {
+				t.Fatal("bucket did not limit")
+			}
+
+			l.Update(limiterConfig(0, 0, 0))
+			if waitsLong(up[0], overdraw) {
+				t.Fatal("existing bucket still limited after reload")
+			}
+			if up, _ := l.Buckets("alice"); len(up) != 0 {
+				t.Fatalf("new connection got %d buckets, want 0", len(up))
+			}
+
+			// 再次开启后，仍持有该桶的连接重新受限
+			l.Update(tt.cfg)
+			if !waitsLong(up[0], overdraw) {
+				t.Fatal("existing bucket not limited after re-enabling")
+			}
+		})
+	}
+}
+
+func TestConnCloseInterruptsWait(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close()
+	bucket := NewBucket(bytesPerKB)
+	c := NewConn(a, nil, []*Bucket{bucket})
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := c.Write(make([]byte, overdraw))
+		errc <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	c.Close()
+
+	select {
+	case err := <-errc:
+		if !errors.Is(err, net.ErrClosed) {
+			t.Fatalf("Write = %v, want net.ErrClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Close did not interrupt the rate limit wait")
+	}
+}
@@ -0,0 +1,109 @@
+// internal/ratelimit/manager.go
+package ratelimit
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/Futaiii/Sudoku_ASCII/internal/config"
+)
+
+const bytesPerKB = 1024
+
+// pair 上下行各一个令牌桶
+type pair struct {
+	up   *Bucket
+	down *Bucket
+}
+
+func newPair(kbps int64) pair {
+	return pair{up: NewBucket(kbps * bytesPerKB), down: NewBucket(kbps * bytesPerKB)}
+}
+
+// Limiter 管理全局、按用户、按连接三级限速
+// 上下行分别限速，互不占用额度。
+// 单用户模式下所有客户端都属于同一个用户 (auth.DefaultUserName)，per_user_kbps 因此相当于全局限速
+type Limiter struct {
+	mu          sync.Mutex
+	global      pair
+	perUserKBps int64
+	perConn     atomic.Int64     // 连接级速率 (字节/秒)，已建立连接的令牌桶每次等待时读取
+	userKBps    map[string]int64 // 单独配置了速率的用户
+	users       map[string]pair
+}
+
+// updatePair 原地调整速率，使新旧连接继续共享同一份额度
+// 速率改为 0 时保留令牌桶并改为不限速，已建立的连接随之解除限制
+func updatePair(p pair, kbps int64) pair {
+	if p.up == nil {
+		return newPair(kbps)
+	}
+	p.up.SetRate(kbps * bytesPerKB)
+	p.down.SetRate(kbps * bytesPerKB)
+	return p
+}
+
+// NewLimiter 根据配置创建限速器
+func NewLimiter(cfg *config.Config) *Limiter {
+	l := &Limiter{users: make(map[string]pair)}
+	l.Update(cfg)
+	return l
+}
+
+// Update 按新配置调整速率 (热更新)，对已建立的连接同样生效
+// 已有的全局与用户级令牌桶原地修改；连接级令牌桶在下次等待时读取新速率，
+// 但建立时未限速的连接不会因开启 per_conn_kbps 而受限
+func (l *Limiter) Update(cfg *config.Config) {
+	rl := cfg.RateLimit
+	userKBps := make(map[string]int64)
+	for _, u := range cfg.Users {
+		if u.RateLimitKBps > 0 {
+			userKBps[u.Name] = u.RateLimitKBps
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.global = updatePair(l.global, rl.GlobalKBps)
+	l.perUserKBps = rl.PerUserKBps
+	l.perConn.Store(rl.PerConnKBps * bytesPerKB)
+	l.userKBps = userKBps
+	for name, p := range l.users {
+		l.users[name] = updatePair(p, l.userRateLocked(name))
+	}
+}
+
+// Buckets 返回一条新连接应使用的上行与下行令牌桶
+// 每次调用都会创建新的连接级令牌桶，user 为空时跳过用户级限速
+func (l *Limiter) Buckets(user string) (up, down []*Bucket) {
+	add := func(p pair) {
+		if p.up.active() {
+			up = append(up, p.up)
+		}
+		if p.down.active() {
+			down = append(down, p.down)
+		}
+	}
+
+	l.mu.Lock()
+	add(l.global)
+	if user != "" {
+		p, ok := l.users[user]
+		if !ok {
+			p = newPair(l.userRateLocked(user))
+			l.users[user] = p
+		}
+		add(p)
+	}
+	l.mu.Unlock()
+
+	add(pair{up: newSharedBucket(&l.perConn), down: newSharedBucket(&l.perConn)})
+	return up, down
+}
+
+func (l *Limiter) userRateLocked(user string) int64 {
+	if v, ok := l.userKBps[user]; ok {
+		return v
+	}
+	return l.perUserKBps
+}
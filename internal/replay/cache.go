@@ -0,0 +1,88 @@
+// internal/replay/cache.go
+package replay
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// NonceSize 握手中 [Timestamp(8)][Nonce(8)] 的长度
+const NonceSize = 16
+
+// Cache 按时间分桶的握手去重缓存
+// 维护 current / previous 两个桶，每隔 2*window 轮换一次，
+// 保证时间偏差窗口内的任意握手都能在缓存中找到。
+// 轮换只由时钟驱动，可接受的时间戳下限不会因流量而提前。
+// 单个桶达到上限后拒绝新的握手直到下一次轮换 (宁可拒绝不放过)，
+// 已有记录不会被挤出，因此不会漏判重放
+type Cache struct {
+	mu       sync.Mutex
+	window   time.Duration
+	maxSize  int
+	current  map[[NonceSize]byte]struct{}
+	previous map[[NonceSize]byte]struct{}
+	since    time.Time // previous 桶的起始时间，即缓存覆盖的最早时刻
+	rotated  time.Time // current 桶的起始时间
+	full     bool      // 本桶已记录过满的日志
+}
+
+// New 创建缓存
+// window: 允许的时间偏差; maxSize: 单个桶的最大条目数
+func New(window time.Duration, maxSize int) *Cache {
+	now := time.Now()
+	return &Cache{
+		window:   window,
+		maxSize:  maxSize,
+		current:  make(map[[NonceSize]byte]struct{}),
+		previous: make(map[[NonceSize]byte]struct{}),
+		// 启动前的握手无法被记录，回退两个窗口使启动初期不误拒正常客户端
+		since:   now.Add(-2 * window),
+		rotated: now,
+	}
+}
+
+// Check 记录一次握手，首次出现返回 true，重放、时间戳过旧或当前桶已满返回 false
+// ts 为握手中的 Unix 时间戳 (调用方已校验过时间偏差)
+func (c *Cache) Check(handshake []byte, ts int64) bool {
+	var key [NonceSize]byte
+	copy(key[:], handshake)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.rotated) >= 2*c.window {
+		c.rotate(now)
+	}
+
+	// 原握手最早可能在 ts-window 到达，若早于覆盖范围则无法判断
+	if ts-int64(c.window/time.Second) < c.since.Unix() {
+		return false
+	}
+
+	if _, ok := c.current[key]; ok {
+		return false
+	}
+	if _, ok := c.previous[key]; ok {
+		return false
+	}
+
+	if len(c.current) >= c.maxSize {
+		if !c.full {
+			log.Printf("[Replay] Cache bucket full (%d), refusing new handshakes until %s", c.maxSize, c.rotated.Add(2*c.window).Format(time.TimeOnly))
+			c.full = true
+		}
+		return false
+	}
+	c.current[key] = struct{}{}
+	return true
+}
+
+func (c *Cache) rotate(now time.Time) {
+	c.previous = c.current
+	c.current = make(map[[NonceSize]byte]struct{}, len(c.previous))
+	c.since = c.rotated
+	c.rotated = now
+	c.full = false
+}
@@ -0,0 +1,102 @@
+// internal/replay/cache_test.go
+package replay
+
+import (
+	"testing"
+	"time"
+)
+
+const testWindow = 60 * time.Second
+
+// age 将缓存的时钟回拨 d，相当于经过了 d
+func age(c *Cache, d time.Duration) {
+	c.rotated = c.rotated.Add(-d)
+	c.since = c.since.Add(-d)
+}
+
+func nonce(b byte) []byte {
+	h := make([]byte, NonceSize)
+	h[NonceSize-1] = b
+	return h
+}
+
+func TestCheckDuplicate(t *testing.T) {
+	c := New(testWindow, 16)
+	now := time.Now().Unix()
+	if !c.Check(nonce(1), now) {
+		t.Fatal("first handshake refused")
+	}
+	if c.Check(nonce(1), now) {
+		t.Fatal("replayed handshake accepted")
+	}
+	if !c.Check(nonce(2), now) {
+		t.Fatal("distinct handshake refused")
+	}
+}
+
+func TestRotation(t *testing.T) {
+	c := New(testWindow, 16)
+	now := time.Now().Unix()
+	c.Check(nonce(1), now)
+
+	// 未满 2*window 不轮换
+	age(c, 2*testWindow-time.Second)
+	c.Check(nonce(2), now)
+	if len(c.current) != 2 || len(c.previous) != 0 {
+		t.Fatalf("rotated early: current %d, previous %d", len(c.current), len(c.previous))
+	}
+
+	// 轮换后旧记录移入 previous，仍能识别重放
+	age(c, time.Second)
+	if !c.Check(nonce(3), now) {
+		t.Fatal("handshake refused after rotation")
+	}
+	if len(c.current) != 1 || len(c.previous) != 2 {
+		t.Fatalf("after rotation: current %d, previous %d", len(c.current), len(c.previous))
+	}
+	if c.Check(nonce(1), now) {
+		t.Fatal("replay of previous bucket accepted")
+	}
+	if c.Check(nonce(3), now) {
+		t.Fatal("replay of current bucket accepted")
+	}
+
+	// 再次轮换后最早的桶被丢弃，覆盖范围随之后移
+	age(c, 2*testWindow)
+	c.Check(nonce(4), now)
+	if _, ok := c.previous[[NonceSize]byte(nonce(3))]; !ok {
+		t.Fatal("current bucket not moved to previous")
+	}
+	if _, ok := c.previous[[NonceSize]byte(nonce(1))]; ok {
+		t.Fatal("oldest bucket not dropped")
+	}
+	if c.Check(nonce(5), now-int64(2*testWindow/time.Second)) {
+		t.Fatal("handshake older than the covered range accepted")
+	}
+}
+
+func TestRefuseWhenFull(t *testing.T) {
+	c := New(testWindow, 2)
+	now := time.Now().Unix()
+	if !c.Check(nonce(1), now) || !c.Check(nonce(2), now) {
+		t.Fatal("handshake refused below the limit")
+	}
+	if c.Check(nonce(3), now) {
+		t.Fatal("handshake accepted into a full bucket")
+	}
+	if c.Check(nonce(1), now) {
+		t.Fatal("replay accepted into a full bucket")
+	}
+	if len(c.current) != 2 {
+		t.Fatalf("full bucket grew to %d", len(c.current))
+	}
+
+	// 轮换后恢复接受，已记录的握手仍被拒绝
+	age(c, 2*testWindow)
+	if !c.Check(nonce(3), now) {
+		t.Fatal("handshake refused after rotation")
+	}
+	if c.Check(nonce(2), now) {
+		t.Fatal("replay accepted after rotation")
+	}
+}
@@ -16,45 +16,78 @@ import (
 	"golang.org/x/crypto/chacha20poly1305"
 )
 
+// ErrDecrypt 帧认证失败 (密钥错误或数据被篡改)
+var ErrDecrypt = errors.New("decryption failed")
+
 type AEADConn struct {
 	net.Conn
-	aead      cipher.AEAD
+	method    string
+	aead      cipher.AEAD // 写方向
+	readAEAD  cipher.AEAD // 读方向，未协商会话密钥时与写方向相同
 	readBuf   bytes.Buffer
 	nonceSize int
 }
 
 func NewAEADConn(c net.Conn, key string, method string) (*AEADConn, error) {
 	if method == "none" {
-		return &AEADConn{Conn: c, aead: nil}, nil
+		return &AEADConn{Conn: c, method: method, aead: nil}, nil
 	}
 
 	h := sha256.New()
 	h.Write([]byte(key))
 	keyBytes := h.Sum(nil)
 
-	var aead cipher.AEAD
-	var err error
-
-	switch method {
-	case "aes-128-gcm":
-		block, _ := aes.NewCipher(keyBytes[:16])
-		aead, err = cipher.NewGCM(block)
-	case "chacha20-poly1305":
-		aead, err = chacha20poly1305.New(keyBytes)
-	default:
-		return nil, fmt.Errorf("unsupported cipher: %s", method)
-	}
+	aead, err := newAEAD(method, keyBytes)
 	if err != nil {
 		return nil, err
 	}
 
 	return &AEADConn{
 		Conn:      c,
+		method:    method,
 		aead:      aead,
+		readAEAD:  aead,
 		nonceSize: aead.NonceSize(),
 	}, nil
 }
 
+// Rekey 切换为按方向区分的会话密钥 (32 字节，AES-128 取前 16 字节)
+// 调用方需保证此时读缓冲中没有使用旧密钥解出的剩余数据
+func (cc *AEADConn) Rekey(readKey, writeKey []byte) error {
+	if cc.aead == nil {
+		return nil
+	}
+	if cc.readBuf.Len() > 0 {
+		return errors.New("rekey with pending plaintext")
+	}
+	readAEAD, err := newAEAD(cc.method, readKey)
+	if err != nil {
+		return err
+	}
+	writeAEAD, err := newAEAD(cc.method, writeKey)
+	if err != nil {
+		return err
+	}
+	cc.readAEAD = readAEAD
+	cc.aead = writeAEAD
+	return nil
+}
+
+func newAEAD(method string, keyBytes []byte) (cipher.AEAD, error) {
+	switch method {
+	case "aes-128-gcm":
+		block, err := aes.NewCipher(keyBytes[:16])
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case "chacha20-poly1305":
+		return chacha20poly1305.New(keyBytes)
+	default:
+		return nil, fmt.Errorf("unsupported cipher: %s", method)
+	}
+}
+
 func (cc *AEADConn) Write(p []byte) (int, error) {
 	if cc.aead == nil {
 		return cc.Conn.Write(p)
@@ -121,9 +154,9 @@ func (cc *AEADConn) Read(p []byte) (int, error) {
 	nonce := body[:cc.nonceSize]
 	ciphertext := body[cc.nonceSize:]
 
-	plaintext, err := cc.aead.Open(nil, nonce, ciphertext, nil)
+	plaintext, err := cc.readAEAD.Open(nil, nonce, ciphertext, nil)
 	if err != nil {
-		return 0, errors.New("decryption failed")
+		return 0, ErrDecrypt
 	}
 
 	cc.readBuf.Write(plaintext)
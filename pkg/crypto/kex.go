@@ -0,0 +1,84 @@
+// pkg/crypto/kex.go
+package crypto
+
+import (
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+)
+
+const (
+	// KexPublicKeySize X25519 公钥长度
+	KexPublicKeySize = 32
+	// KexMACSize 握手认证码长度 (HMAC-SHA256)
+	KexMACSize = sha256.Size
+
+	// KexLabelClient / KexLabelServer 区分两个方向认证码的标签
+	KexLabelClient = "sudoku-kex-c"
+	KexLabelServer = "sudoku-kex-s"
+
+	sessionKeySize = 32
+)
+
+// KeyExchange 单次握手使用的 X25519 临时密钥
+// 会话密钥只由临时密钥协商得出，PSK 仅用于认证公钥，
+// 因此 PSK 泄露后也无法解密已记录的会话 (前向安全)
+type KeyExchange struct {
+	priv *ecdh.PrivateKey
+}
+
+func NewKeyExchange() (*KeyExchange, error) {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyExchange{priv: priv}, nil
+}
+
+func (k *KeyExchange) PublicKey() []byte {
+	return k.priv.PublicKey().Bytes()
+}
+
+// SessionKeys 根据对端公钥派生读写两个方向的会话密钥
+// salt 为本次握手的随机数据，保证每个会话的密钥互不相同
+func (k *KeyExchange) SessionKeys(peerPub, salt []byte, isClient bool) (readKey, writeKey []byte, err error) {
+	pub, err := ecdh.X25519().NewPublicKey(peerPub)
+	if err != nil {
+		return nil, nil, err
+	}
+	shared, err := k.priv.ECDH(pub)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c2s, err := hkdf.Key(sha256.New, shared, salt, "sudoku c2s", sessionKeySize)
+	if err != nil {
+		return nil, nil, err
+	}
+	s2c, err := hkdf.Key(sha256.New, shared, salt, "sudoku s2c", sessionKeySize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if isClient {
+		return s2c, c2s, nil
+	}
+	return c2s, s2c, nil
+}
+
+// KexMAC 使用 PSK 对握手内容计算认证码，label 区分方向
+func KexMAC(psk string, label string, parts ...[]byte) []byte {
+	mac := hmac.New(sha256.New, []byte(psk))
+	mac.Write([]byte(label))
+	for _, p := range parts {
+		mac.Write(p)
+	}
+	return mac.Sum(nil)
+}
+
+// VerifyKexMAC 常数时间比较认证码
+func VerifyKexMAC(psk string, label string, expected []byte, parts ...[]byte) bool {
+	return hmac.Equal(expected, KexMAC(psk, label, parts...))
+}
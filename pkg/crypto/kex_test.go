@@ -0,0 +1,185 @@
+// pkg/crypto/kex_test.go
+package crypto
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestSessionKeysAgree(t *testing.T) {
+	client, err := NewKeyExchange()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := NewKeyExchange()
+	if err != nil {
+		t.Fatal(err)
+	}
+	salt := []byte("0123456789abcdef")
+
+	cRead, cWrite, err := client.SessionKeys(server.PublicKey(), salt, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sRead, sWrite, err := server.SessionKeys(client.PublicKey(), salt, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cWrite, sRead) || !bytes.Equal(sWrite, cRead) {
+		t.Fatal("client and server derived different session keys")
+	}
+	if bytes.Equal(cWrite, cRead) {
+		t.Fatal("c2s and s2c keys are identical")
+	}
+
+	// 不同的 salt 得到不同的会话密钥
+	other, _, err := client.SessionKeys(server.PublicKey(), []byte("fedcba9876543210"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(other, cRead) {
+		t.Fatal("session keys do not depend on salt")
+	}
+
+	if _, _, err := client.SessionKeys([]byte("short"), salt, true); err == nil {
+		t.Fatal("SessionKeys accepted a malformed public key")
+	}
+}
+
+func TestKexMAC(t *testing.T) {
+	handshake := []byte("0123456789abcdef")
+	pub := bytes.Repeat([]byte{0x42}, KexPublicKeySize)
+	mac := KexMAC("psk", KexLabelClient, handshake, pub)
+	if len(mac) != KexMACSize {
+		t.Fatalf("MAC length = %d, want %d", len(mac), KexMACSize)
+	}
+	if !VerifyKexMAC("psk", KexLabelClient, mac, handshake, pub) {
+		t.Fatal("valid MAC rejected")
+	}
+
+	tamperedPub := bytes.Clone(pub)
+	tamperedPub[0] ^= 1
+	tamperedMAC := bytes.Clone(mac)
+	tamperedMAC[len(tamperedMAC)-1] ^= 1
+
+	tests := []struct {
+		name  string
+		psk   string
+		label string
+		mac   []byte
+		pub   []byte
+	}{
+		{"wrong psk", "other", KexLabelClient, mac, pub},
+		{"wrong direction", "psk", KexLabelServer, mac, pub},
+		{"tampered pubkey", "psk", KexLabelClient, mac, tamperedPub},
+		{"tampered mac", "psk", KexLabelClient, tamperedMAC, pub},
+		{"truncated mac", "psk", KexLabelClient, mac[:16], pub},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if VerifyKexMAC(tt.psk, tt.label, tt.mac, handshake, tt.pub) {
+				t.Fatal("invalid MAC accepted")
+			}
+		})
+	}
+}
+
+// TestRekey 切换会话密钥后两端仍能互相收发，旧密钥无法解密新数据
+func TestRekey(t *testing.T) {
+	for _, method := range []string{"aes-128-gcm", "chacha20-poly1305"} {
+		t.Run(method, func(t *testing.T) {
+			a, b := net.Pipe()
+			defer a.Close()
+			defer b.Close()
+			client, err := NewAEADConn(a, "psk", method)
+			if err != nil {
+				t.Fatal(err)
+			}
+			server, err := NewAEADConn(b, "psk", method)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			exchange(t, client, server, []byte("before rekey"))
+
+			ck, _ := NewKeyExchange()
+			sk, _ := NewKeyExchange()
+			salt := []byte("0123456789abcdef")
+			cRead, cWrite, _ := ck.SessionKeys(sk.PublicKey(), salt, true)
+			sRead, sWrite, _ := sk.SessionKeys(ck.PublicKey(), salt, false)
+			if err := client.Rekey(cRead, cWrite); err != nil {
+				t.Fatal(err)
+			}
+			if err := server.Rekey(sRead, sWrite); err != nil {
+				t.Fatal(err)
+			}
+
+			exchange(t, client, server, []byte("after rekey, client to server"))
+			exchange(t, server, client, []byte("after rekey, server to client"))
+		})
+	}
+}
+
+// TestRekeyMismatch 两端会话密钥不一致时读取失败
+func TestRekeyMismatch(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	client, _ := NewAEADConn(a, "psk", "aes-128-gcm")
+	server, _ := NewAEADConn(b, "psk", "aes-128-gcm")
+
+	key1 := bytes.Repeat([]byte{1}, sessionKeySize)
+	key2 := bytes.Repeat([]byte{2}, sessionKeySize)
+	if err := client.Rekey(key1, key1); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Rekey(key2, key2); err != nil {
+		t.Fatal(err)
+	}
+
+	go client.Write([]byte("hello"))
+	buf := make([]byte, 16)
+	if _, err := server.Read(buf); err == nil {
+		t.Fatal("read with mismatched session key succeeded")
+	}
+}
+
+// TestRekeyPendingData 读缓冲中仍有旧密钥解出的数据时拒绝切换
+func TestRekeyPendingData(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	client, _ := NewAEADConn(a, "psk", "aes-128-gcm")
+	server, _ := NewAEADConn(b, "psk", "aes-128-gcm")
+
+	go client.Write([]byte("hello world"))
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(server, buf); err != nil {
+		t.Fatal(err)
+	}
+	key := bytes.Repeat([]byte{1}, sessionKeySize)
+	if err := server.Rekey(key, key); err == nil {
+		t.Fatal("Rekey succeeded with buffered plaintext")
+	}
+}
+
+func exchange(t *testing.T, w, r *AEADConn, msg []byte) {
+	t.Helper()
+	errc := make(chan error, 1)
+	go func() {
+		_, err := w.Write(msg)
+		errc <- err
+	}()
+	got := make([]byte, len(msg))
+	if _, err := io.ReadFull(r, got); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, msg) {
+		t.Fatalf("got %q, want %q", got, msg)
+	}
+}
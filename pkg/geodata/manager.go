@@ -52,13 +52,17 @@ func GetInstance(urls []string) *Manager {
 }
 
 func (m *Manager) Update() {
-	log.Printf("[GeoData] Updating rules from %d sources...", len(m.urls))
+	m.mu.RLock()
+	urls := m.urls
+	m.mu.RUnlock()
+
+	log.Printf("[GeoData] Updating rules from %d sources...", len(urls))
 
 	var tempRanges []IPRange
 	tempExact := make(map[string]struct{})
 	tempSuffix := make(map[string]struct{})
 
-	for _, u := range m.urls {
+	for _, u := range urls {
 		m.downloadAndParse(u, &tempRanges, tempExact, tempSuffix)
 	}
 
@@ -75,6 +79,33 @@ func (m *Manager) Update() {
 		len(mergedIPs), len(tempExact), len(tempSuffix))
 }
 
+// Reload 更换规则来源并在后台重新下载，下载完成前继续使用旧规则
+func (m *Manager) Reload(urls []string) {
+	m.mu.Lock()
+	m.urls = urls
+	m.mu.Unlock()
+	go m.Update()
+}
+
+// Stats 已加载的规则数量
+type Stats struct {
+	Sources  int `json:"sources"`
+	IPRanges int `json:"ip_ranges"`
+	Domains  int `json:"domains"`
+	Suffixes int `json:"suffixes"`
+}
+
+func (m *Manager) Stats() Stats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return Stats{
+		Sources:  len(m.urls),
+		IPRanges: len(m.ipRanges),
+		Domains:  len(m.domainExact),
+		Suffixes: len(m.domainSuffix),
+	}
+}
+
 func (m *Manager) downloadAndParse(url string, ipRanges *[]IPRange, exact, suffix map[string]struct{}) {
 	client := http.Client{Timeout: 30 * time.Second}
 	resp, err := client.Get(url)
@@ -0,0 +1,205 @@
+// pkg/obfs/sudoku/cache.go
+package sudoku
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/Futaiii/Sudoku_ASCII/internal/fsutil"
+)
+
+// 表缓存文件格式 (大端):
+//
+//	"SDKT" | 版本 | key 摘要 (32) | 内容 | 以上全部的 SHA-256 (32)
+//
+// 版本 1 (4x4): 内容为 256 × { 数量 (2) | 数量 × 提示组 (3) }，提示组为 4 个 6 位提示编号
+// 版本 2 (码本): 内容为 名称长度 (1) | 网格名称 | 窗口格 (Window) | bookSymbols × 窗口取值 (Window)
+// 缓存只保存与布局无关的部分，解码表在加载时重建。
+// 生成算法变化时须提升对应版本号，使旧缓存失效
+const (
+	tableMagic         = "SDKT"
+	tableFormatVersion = 1
+	bookFormatVersion  = 2
+	tableHeaderLen     = len(tableMagic) + 1 + sha256.Size
+)
+
+var ErrTableKey = errors.New("table was built for a different key or grid")
+
+// tableKeyHash 缓存中标识 key 与网格的摘要
+func tableKeyHash(key string, v *Variant) [32]byte {
+	if v.Name == Grid4x4 {
+		return sha256.Sum256([]byte("sudoku-table:" + key))
+	}
+	return sha256.Sum256([]byte("sudoku-table:" + v.Name + ":" + key))
+}
+
+// TableCachePath 返回 key 与网格在缓存目录中对应的文件
+func TableCachePath(dir, key string, v *Variant) string {
+	h := tableKeyHash(key, v)
+	return filepath.Join(dir, hex.EncodeToString(h[:8])+".table")
+}
+
+// MarshalBinary 按缓存文件格式序列化编码表
+func (t *Table) MarshalBinary() ([]byte, error) {
+	if b := t.book; b != nil {
+		buf := make([]byte, 0, tableHeaderLen+1+len(b.v.Name)+len(b.window)+len(b.tuples)+sha256.Size)
+		buf = append(buf, tableMagic...)
+		buf = append(buf, bookFormatVersion)
+		buf = append(buf, t.keyHash[:]...)
+		buf = append(buf, byte(len(b.v.Name)))
+		buf = append(buf, b.v.Name...)
+		buf = append(buf, b.window...)
+		buf = append(buf, b.tuples...)
+		sum := sha256.Sum256(buf)
+		return append(buf, sum[:]...), nil
+	}
+
+	buf := make([]byte, 0, tableHeaderLen+256*2+len(t.EncodeTable[0])*256*3+sha256.Size)
+	buf = append(buf, tableMagic...)
+	buf = append(buf, tableFormatVersion)
+	buf = append(buf, t.keyHash[:]...)
+	for _, hints := range t.EncodeTable {
+		if len(hints) > 0xFFFF {
+			return nil, fmt.Errorf("too many hint sets: %d", len(hints))
+		}
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(hints)))
+		for _, h := range hints {
+			v := uint32(h[0])<<18 | uint32(h[1])<<12 | uint32(h[2])<<6 | uint32(h[3])
+			buf = append(buf, byte(v>>16), byte(v>>8), byte(v))
+		}
+	}
+	sum := sha256.Sum256(buf)
+	return append(buf, sum[:]...), nil
+}
+
+// LoadTable 从缓存文件内容恢复混淆表，校验格式、校验和、key 与网格
+func LoadTable(data []byte, key string, v *Variant, layout *Layout) (*Table, error) {
+	if len(data) < tableHeaderLen+sha256.Size || string(data[:len(tableMagic)]) != tableMagic {
+		return nil, errors.New("not a Sudoku table file")
+	}
+	version := data[len(tableMagic)]
+	if version != tableFormatVersion && version != bookFormatVersion {
+		return nil, fmt.Errorf("unsupported table format version %d", version)
+	}
+	body, sum := data[:len(data)-sha256.Size], data[len(data)-sha256.Size:]
+	if s := sha256.Sum256(body); !bytes.Equal(s[:], sum) {
+		return nil, errors.New("table checksum mismatch")
+	}
+	if h := tableKeyHash(key, v); !bytes.Equal(h[:], body[len(tableMagic)+1:tableHeaderLen]) {
+		return nil, ErrTableKey
+	}
+	if (version == tableFormatVersion) != (v.Name == Grid4x4) {
+		return nil, ErrTableKey
+	}
+	if version == bookFormatVersion {
+		return loadBook(body[tableHeaderLen:], key, v, layout)
+	}
+
+	var enc [256][][4]byte
+	rest := body[tableHeaderLen:]
+	for b := range enc {
+		if len(rest) < 2 {
+			return nil, errors.New("truncated table")
+		}
+		n := int(binary.BigEndian.Uint16(rest))
+		rest = rest[2:]
+		if n == 0 {
+			return nil, fmt.Errorf("no hint sets for byte %d", b)
+		}
+		if len(rest) < n*3 {
+			return nil, errors.New("truncated table")
+		}
+		enc[b] = make([][4]byte, n)
+		for i := range enc[b] {
+			v := uint32(rest[0])<<16 | uint32(rest[1])<<8 | uint32(rest[2])
+			enc[b][i] = [4]byte{byte(v >> 18 & 0x3F), byte(v >> 12 & 0x3F), byte(v >> 6 & 0x3F), byte(v & 0x3F)}
+			if _, ok := hintIndex(enc[b][i]); !ok {
+				return nil, errors.New("invalid hint set in table")
+			}
+			rest = rest[3:]
+		}
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("trailing data in table")
+	}
+	return newTable(key, layout, &enc), nil
+}
+
+// loadBook 恢复码本网格的混淆表
+func loadBook(rest []byte, key string, v *Variant, layout *Layout) (*Table, error) {
+	if len(rest) < 1 || len(rest) < 1+int(rest[0]) || string(rest[1:1+rest[0]]) != v.Name {
+		return nil, ErrTableKey
+	}
+	rest = rest[1+len(v.Name):]
+	if len(rest) != v.Window+bookSymbols*v.Window {
+		return nil, errors.New("truncated table")
+	}
+	window, tuples := rest[:v.Window], rest[v.Window:]
+	var seen [81]bool
+	for _, c := range window {
+		if int(c) >= v.Size*v.Size || seen[c] {
+			return nil, errors.New("invalid window in table")
+		}
+		seen[c] = true
+	}
+	for _, val := range tuples {
+		if val < 1 || int(val) > v.Size {
+			return nil, errors.New("invalid grid value in table")
+		}
+	}
+
+	book := newCodebook(v, slices.Clone(window), slices.Clone(tuples))
+	for s := 0; s < bookSymbols; s++ {
+		if book.off[s+1] == book.off[s] {
+			return nil, fmt.Errorf("no hint sets for symbol %d", s)
+		}
+	}
+	return newBookTable(key, layout, book), nil
+}
+
+// NewTableCached 与 NewTableVariant 相同，但优先从 dir 中的缓存加载，
+// 缓存不存在或无效时生成并写入。dir 为空时不使用缓存
+func NewTableCached(key string, v *Variant, layout *Layout, dir string) *Table {
+	if dir == "" {
+		return NewTableVariant(key, v, layout)
+	}
+
+	path := TableCachePath(dir, key, v)
+	start := time.Now()
+	if data, err := os.ReadFile(path); err == nil {
+		t, err := LoadTable(data, key, v, layout)
+		if err == nil {
+			log.Printf("[Init] Sudoku Tables loaded from %s (%s, %s) in %v", path, v.Name, layout.Name, time.Since(start))
+			return t
+		}
+		log.Printf("[Init] Ignoring table cache %s: %v", path, err)
+	}
+
+	t := NewTableVariant(key, v, layout)
+	if err := t.WriteFile(path); err != nil {
+		log.Printf("[Init] Failed to write table cache: %v", err)
+	}
+	return t
+}
+
+// WriteFile 将表写入 path (先写临时文件再替换)
+// 文件内容可还原混淆映射，权限为 0600
+func (t *Table) WriteFile(path string) error {
+	data, err := t.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return fsutil.AtomicWriteFile(path, data, 0o600)
+}
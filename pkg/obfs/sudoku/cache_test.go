@@ -0,0 +1,105 @@
+// pkg/obfs/sudoku/cache_test.go
+package sudoku
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// rebuild 修改文件内容 (不含校验和) 后重新计算校验和，用于构造校验和正确但内容无效的文件
+func rebuild(data []byte, f func(body []byte) []byte) []byte {
+	body := f(bytes.Clone(data[:len(data)-sha256.Size]))
+	sum := sha256.Sum256(body)
+	return append(body, sum[:]...)
+}
+
+func TestLoadTableRejects(t *testing.T) {
+	v4, _ := VariantByName(Grid4x4)
+	v6, _ := VariantByName(Grid6x6)
+	v9, _ := VariantByName(Grid9x9)
+	data4, _ := testTable(t, Grid4x4).MarshalBinary()
+	data6, _ := testTable(t, Grid6x6).MarshalBinary()
+
+	edit := func(data []byte, f func([]byte) []byte) []byte {
+		return f(bytes.Clone(data))
+	}
+	tests := []struct {
+		name    string
+		data    []byte
+		key     string
+		v       *Variant
+		wantKey bool // 期望 ErrTableKey
+	}{
+		{"empty", nil, testKey, v4, false},
+		{"bad magic", edit(data4, func(d []byte) []byte { d[0] = 'X'; return d }), testKey, v4, false},
+		{"bad version", rebuild(data4, func(d []byte) []byte { d[len(tableMagic)] = 9; return d }), testKey, v4, false},
+		{"flipped bit", edit(data4, func(d []byte) []byte { d[len(d)/2] ^= 1; return d }), testKey, v4, false},
+		{"flipped checksum", edit(data6, func(d []byte) []byte { d[len(d)-1] ^= 1; return d }), testKey, v6, false},
+		{"truncated", data4[:len(data4)/2], testKey, v4, false},
+		{"truncated book", rebuild(data6, func(d []byte) []byte { return d[:len(d)-10] }), testKey, v6, false},
+		{"trailing data", rebuild(data4, func(d []byte) []byte { return append(d, 0, 0, 0) }), testKey, v4, false},
+		{"zero hint sets", rebuild(data4, func(d []byte) []byte { d[tableHeaderLen], d[tableHeaderLen+1] = 0, 0; return d }), testKey, v4, false},
+		{"invalid grid value", rebuild(data6, func(d []byte) []byte { d[len(d)-1] = 7; return d }), testKey, v6, false},
+		{"wrong key", data4, "other-key", v4, true},
+		{"wrong key book", data6, "other-key", v6, true},
+		{"4x4 file as 6x6", data4, testKey, v6, true},
+		{"6x6 file as 9x9", data6, testKey, v9, true},
+		{"6x6 file as 4x4", data6, testKey, v4, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadTable(tt.data, tt.key, tt.v, entropyLayout())
+			if err == nil {
+				t.Fatal("LoadTable succeeded, want error")
+			}
+			if got := errors.Is(err, ErrTableKey); got != tt.wantKey {
+				t.Fatalf("err = %v, ErrTableKey = %v, want %v", err, got, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestLoadTableMatches(t *testing.T) {
+	for _, grid := range []string{Grid4x4, Grid6x6, Grid9x9} {
+		t.Run(grid, func(t *testing.T) {
+			v, _ := VariantByName(grid)
+			want, _ := testTable(t, grid).MarshalBinary()
+			table, err := LoadTable(want, testKey, v, entropyLayout())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := table.MarshalBinary(); !bytes.Equal(got, want) {
+				t.Fatal("loaded table differs from the generated one")
+			}
+		})
+	}
+}
+
+// TestTableCacheReplacesCorrupt 缓存文件损坏时重新生成并覆盖
+func TestTableCacheReplacesCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	v, _ := VariantByName(Grid4x4)
+	path := TableCachePath(dir, testKey, v)
+	if err := os.WriteFile(path, []byte("SDKT garbage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	NewTableCached(testKey, v, entropyLayout(), dir)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadTable(data, testKey, v, entropyLayout()); err != nil {
+		t.Fatalf("cache was not rewritten: %v", err)
+	}
+	if fi, _ := os.Stat(path); fi.Mode().Perm() != 0o600 {
+		t.Fatalf("cache mode = %v, want 0600", fi.Mode().Perm())
+	}
+	if tmps, _ := filepath.Glob(filepath.Join(dir, ".*")); len(tmps) != 0 {
+		t.Fatalf("temporary files left behind: %v", tmps)
+	}
+}
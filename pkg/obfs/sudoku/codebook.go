@@ -0,0 +1,280 @@
+// pkg/obfs/sudoku/codebook.go
+package sudoku
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math/rand"
+	"slices"
+)
+
+// 6x6 / 9x9 网格的码本
+// 4x4 网格只有 288 种，一个谜题最多编码 1 字节。更大的网格由 key 抽样出 bookSymbols 个组成码本，
+// 每个网格对应一个符号: 0..65535 为 2 字节 (高字节在前)，65536+b 为 Write 末尾落单的 1 字节。
+// 一组 Clues 个提示若只与码本中的一个网格吻合，即可作为该网格的谜题
+const (
+	bookPairs   = 1 << 16
+	bookSymbols = bookPairs + 256
+	maxClues    = 8
+	relabels    = 8 // 每个回溯生成的网格替换数字得到的候选数
+)
+
+type codebook struct {
+	v      *Variant
+	window []uint8          // 可放置提示的格 (按行编号)
+	tuples []uint8          // 符号 s 的网格在窗口内的取值: tuples[s*Window : (s+1)*Window]
+	sets   []uint64         // 提示组，每个提示编号占 8 位，低位在前
+	off    []int32          // 符号 s 的提示组为 sets[off[s]:off[s+1]]
+	decode []uint32         // 下标: 窗口格组合的排名 * pow + 各提示取值 (Size 进制)，值为符号 + 1，0 表示无效
+	pow    int              // Size^Clues
+	keys   [hintCount]int16 // 提示编号 -> cell<<4 | (val-1)，无效编号为 -1
+	combos [][]uint8        // 全部 Clues 元窗口格组合 (升序)
+}
+
+// buildCodebook 按 key 选出窗口并逐个抽样网格加入码本，直到凑满 bookSymbols 个
+// 网格只有在窗口内至少有 minSets 组唯一的提示组、且不会使已加入的网格少于 minSets 组时才会加入
+func buildCodebook(key string, v *Variant) *codebook {
+	sum := sha256.Sum256([]byte("sudoku-grid:" + v.Name + ":" + key))
+	rng := rand.New(rand.NewSource(int64(binary.BigEndian.Uint64(sum[:8]))))
+	window := v.pickWindow(rng)
+	combos := windowCombos(v)
+	pow := clueSpace(v)
+
+	// owner[ci*pow + 取值]: 0 空闲，s+1 为唯一吻合的符号，-1 为多个符号吻合
+	owner := make([]int32, len(combos)*pow)
+	usable := make([]int32, 0, bookSymbols) // 各符号仍唯一的组合数
+	tuples := make([]uint8, 0, bookSymbols*v.Window)
+	g := make([]uint8, v.Size*v.Size)
+	t := make([]uint8, v.Window)
+	slots := make([]int, len(combos))
+	var hits []int32
+	var digits [10]uint8
+
+	for n := 0; len(usable) < bookSymbols; n++ {
+		// 回溯较慢，每个网格替换数字后得到多个候选，替换后仍是合法网格
+		if n%relabels == 0 {
+			v.randomGrid(rng, g)
+		}
+		for i := range digits {
+			digits[i] = uint8(i)
+		}
+		rng.Shuffle(v.Size, func(i, j int) { digits[i+1], digits[j+1] = digits[j+1], digits[i+1] })
+		for i, c := range window {
+			t[i] = digits[g[c]]
+		}
+
+		free := 0
+		hits = hits[:0]
+		for ci, combo := range combos {
+			slots[ci] = ci*pow + tupleIndex(t, combo, v.Size)
+			if o := owner[slots[ci]]; o == 0 {
+				free++
+			} else if o > 0 {
+				hits = append(hits, o-1)
+			}
+		}
+		if free < v.minSets || !spare(usable, hits, v.minSets) {
+			continue
+		}
+
+		s := int32(len(usable))
+		for _, slot := range slots {
+			if o := owner[slot]; o == 0 {
+				owner[slot] = s + 1
+			} else if o > 0 {
+				owner[slot] = -1
+				usable[o-1]--
+			}
+		}
+		usable = append(usable, int32(free))
+		tuples = append(tuples, t...)
+	}
+	return newCodebook(v, window, tuples)
+}
+
+// spare 判断 hits 中的符号在各失去一次组合后是否仍有至少 min 个可用的组合
+func spare(usable, hits []int32, min int) bool {
+	for i, s := range hits {
+		n := int32(0)
+		for _, h := range hits[i:] {
+			if h == s {
+				n++
+			}
+		}
+		if int(usable[s]-n) < min {
+			return false
+		}
+	}
+	return true
+}
+
+// windowCombos 返回全部 Clues 元窗口格组合 (升序)
+func windowCombos(v *Variant) [][]uint8 {
+	var combos [][]uint8
+	var combine func(s int, c []uint8)
+	combine = func(s int, c []uint8) {
+		if len(c) == v.Clues {
+			combos = append(combos, slices.Clone(c))
+			return
+		}
+		for i := s; i < v.Window; i++ {
+			combine(i+1, append(c, uint8(i)))
+		}
+	}
+	combine(0, nil)
+	return combos
+}
+
+// clueSpace 返回一个组合上可能的取值个数 Size^Clues
+func clueSpace(v *Variant) int {
+	n := 1
+	for i := 0; i < v.Clues; i++ {
+		n *= v.Size
+	}
+	return n
+}
+
+// tupleIndex 窗口取值 t 在组合 combo 上的取值 (Size 进制，组合中第一格为最低位)
+func tupleIndex(t, combo []uint8, size int) int {
+	idx, mul := 0, 1
+	for _, cell := range combo {
+		idx += int(t[cell]-1) * mul
+		mul *= size
+	}
+	return idx
+}
+
+// newCodebook 由窗口取值生成各符号的提示组与解码表，tuples 中的每个网格都是一个符号
+func newCodebook(v *Variant, window, tuples []uint8) *codebook {
+	b := &codebook{v: v, window: window, tuples: tuples, pow: clueSpace(v), combos: windowCombos(v)}
+	for id := range b.keys {
+		b.keys[id] = -1
+		if id < v.Size*v.Window {
+			b.keys[id] = int16(id%v.Window<<4 | id/v.Window)
+		}
+	}
+
+	// 逐个组合统计取值，只出现一次的即为该网格的唯一提示组
+	n := len(tuples) / v.Window
+	masks := make([]uint32, n) // 每个符号可用的组合 (C(Window, Clues) <= 32)
+	counts := make([]uint8, b.pow)
+	for ci, combo := range b.combos {
+		clear(counts)
+		for s := 0; s < n; s++ {
+			if i := tupleIndex(b.tuple(s), combo, v.Size); counts[i] < 2 {
+				counts[i]++
+			}
+		}
+		for s := 0; s < n; s++ {
+			if counts[tupleIndex(b.tuple(s), combo, v.Size)] == 1 {
+				masks[s] |= 1 << ci
+			}
+		}
+	}
+
+	b.off = make([]int32, n+1)
+	b.decode = make([]uint32, binom[v.Window][v.Clues]*b.pow)
+	for s, m := range masks {
+		t := b.tuple(s)
+		for ci, combo := range b.combos {
+			if m&(1<<ci) == 0 {
+				continue
+			}
+			var set uint64
+			for i, cell := range combo {
+				set |= uint64(int(t[cell]-1)*v.Window+int(cell)) << (8 * i)
+			}
+			b.sets = append(b.sets, set)
+			b.decode[b.comboRank(combo)*b.pow+tupleIndex(t, combo, v.Size)] = uint32(s + 1)
+		}
+		b.off[s+1] = int32(len(b.sets))
+	}
+	return b
+}
+
+// tuple 返回符号 s 的网格在窗口内的取值
+func (b *codebook) tuple(s int) []uint8 {
+	return b.tuples[s*b.v.Window : (s+1)*b.v.Window]
+}
+
+// comboRank 升序窗口格组合的排名
+func (b *codebook) comboRank(combo []uint8) int {
+	rank := 0
+	for i, cell := range combo {
+		rank += binom[cell][i+1]
+	}
+	return rank
+}
+
+// lookup 返回 Clues 个提示编号 (任意顺序) 对应的符号
+func (b *codebook) lookup(h *[maxClues]byte) (int, bool) {
+	clues, size := b.v.Clues, b.v.Size
+	// 以 cell<<4 | (val-1) 为键按格排序
+	var keys [maxClues]int
+	for i := 0; i < clues; i++ {
+		k := int(b.keys[h[i]&(hintCount-1)])
+		if k < 0 {
+			return 0, false
+		}
+		j := i
+		for ; j > 0 && keys[j-1] > k; j-- {
+			keys[j] = keys[j-1]
+		}
+		keys[j] = k
+	}
+
+	rank, idx, mul := 0, 0, 1
+	for i := 0; i < clues; i++ {
+		cell := keys[i] >> 4
+		if i > 0 && cell == keys[i-1]>>4 {
+			return 0, false
+		}
+		rank += binom[cell][i+1]
+		idx += (keys[i] & 0x0F) * mul
+		mul *= size
+	}
+	s := b.decode[rank*b.pow+idx]
+	return int(s) - 1, s != 0
+}
+
+// encodeBook 码本网格的编码: 每 2 字节一个谜题，末尾落单的字节单独成谜题
+func (sc *Conn) encodeBook(out, p []byte, thr uint64) []byte {
+	b := sc.table.book
+	k := b.v.Clues
+	codes := &sc.table.Layout.codes
+	rng := sc.rng
+	var order [maxClues]byte
+
+	for i := 0; i < len(p); i += 2 {
+		if sc.padSlot(thr) {
+			out = sc.appendPad(out)
+		}
+
+		s := bookPairs + int(p[i])
+		if i+1 < len(p) {
+			s = int(p[i])<<8 | int(p[i+1])
+		}
+		sets := b.sets[b.off[s]:b.off[s+1]]
+		set := sets[(rng.Uint64()&0xFFFFFFFF)*uint64(len(sets))>>32]
+		for j := 0; j < k; j++ {
+			order[j] = byte(set >> (8 * j))
+		}
+		// 打乱提示顺序，每步取 8 位随机数
+		r := rng.Uint64()
+		for j := k - 1; j > 0; j-- {
+			x := (r & 0xFF) * uint64(j+1) >> 8
+			r >>= 8
+			order[j], order[x] = order[x], order[j]
+		}
+
+		for _, id := range order[:k] {
+			for _, c := range codes[id] {
+				if sc.padSlot(thr) {
+					out = sc.appendPad(out)
+				}
+				out = append(out, c)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,75 @@
+// pkg/obfs/sudoku/codebook_test.go
+package sudoku
+
+import "testing"
+
+// withLayout 复用 testTable 的网格分配，换用另一种线路布局 (映射表与布局无关)
+func withLayout(t *testing.T, grid string, layout *Layout) *Table {
+	t.Helper()
+	data, err := testTable(t, grid).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, _ := VariantByName(grid)
+	table, err := LoadTable(data, testKey, v, layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return table
+}
+
+func TestGridRoundTrip(t *testing.T) {
+	custom, err := NewLayout(LayoutCustom, []byte("GETPOSHD"), []byte("/ .:-abcdefghijklmnopqrstuvwxyz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	layouts := []*Layout{custom}
+	for _, name := range []string{LayoutASCII, LayoutEntropy, LayoutLowercase, LayoutHex, LayoutBase64} {
+		l, err := LayoutByName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		layouts = append(layouts, l)
+	}
+
+	for _, grid := range []string{Grid4x4, Grid6x6, Grid9x9} {
+		for _, layout := range layouts {
+			for _, permute := range []bool{false, true} {
+				name := grid + "/" + layout.Name
+				l := layout
+				if permute {
+					name += "/permuted"
+					l = layout.Permute(testKey)
+				}
+				t.Run(name, func(t *testing.T) {
+					roundTrip(t, withLayout(t, grid, l), ProfileUniform, 5, 20, testWrites())
+				})
+			}
+		}
+	}
+}
+
+// TestCodebookUnique 码本中每个符号都有提示组，且每个提示组只解码为该符号
+func TestCodebookUnique(t *testing.T) {
+	for _, grid := range []string{Grid6x6, Grid9x9} {
+		t.Run(grid, func(t *testing.T) {
+			b := testTable(t, grid).book
+			var h [maxClues]byte
+			for s := 0; s < bookSymbols; s++ {
+				sets := b.sets[b.off[s]:b.off[s+1]]
+				if len(sets) == 0 {
+					t.Fatalf("symbol %d has no hint sets", s)
+				}
+				for _, set := range sets {
+					for i := 0; i < b.v.Clues; i++ {
+						// 倒序放入，lookup 应与提示顺序无关
+						h[b.v.Clues-1-i] = byte(set >> (8 * i))
+					}
+					if got, ok := b.lookup(&h); !ok || got != s {
+						t.Fatalf("symbol %d: lookup = %d, %v", s, got, ok)
+					}
+				}
+			}
+		})
+	}
+}
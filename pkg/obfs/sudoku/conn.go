@@ -9,11 +9,15 @@ import (
 	"errors"
 	"math/rand"
 	"net"
+	"slices"
 	"sync"
 )
 
 const IOBufferSize = 32 * 1024
 
+// ErrMapMiss 收到的提示组合不在解码表中 (密钥不一致或非 Sudoku 流量)
+var ErrMapMiss = errors.New("INVALID_SUDOKU_MAP_MISS")
+
 type Conn struct {
 	net.Conn
 	table      *Table
@@ -24,13 +28,27 @@ type Conn struct {
 
 	rawBuf      []byte
 	pendingData []byte
-	hintBuf     []byte
+	pendingOff  int            // pendingData 中已交给调用方的长度，全部取走后整体复位以复用容量
+	hints       [maxClues]byte // 已读取的提示编号
+	hintCount   int
+	hintAcc     int // 多字符提示已读取部分的数值
+	hintDigits  int // 多字符提示已读取的字符数
 
-	rng         *rand.Rand
-	paddingRate float32
+	rng    *rand.Rand
+	bits   uint64 // 填充判断使用的随机位，每次取 padBits 位
+	nbits  int
+	padder *padder
+	shaper *shaper // 写入整形，nil 时每次 Write 直接写出 (见 shaping.go)
 }
 
+// NewConn 使用 uniform 填充策略，其他策略见 NewConnProfile
 func NewConn(c net.Conn, table *Table, pMin, pMax int, record bool) *Conn {
+	sc, _ := NewConnProfile(c, table, ProfileUniform, pMin, pMax, record)
+	return sc
+}
+
+// NewConnProfile 按 profile 指定的策略插入填充 (见 padding.go)
+func NewConnProfile(c net.Conn, table *Table, profile string, pMin, pMax int, record bool) (*Conn, error) {
 	var seedBytes [8]byte
 	if _, err := crypto_rand.Read(seedBytes[:]); err != nil {
 		binary.BigEndian.PutUint64(seedBytes[:], uint64(rand.Int63()))
@@ -38,9 +56,10 @@ func NewConn(c net.Conn, table *Table, pMin, pMax int, record bool) *Conn {
 	seed := int64(binary.BigEndian.Uint64(seedBytes[:]))
 	localRng := rand.New(rand.NewSource(seed))
 
-	min := float32(pMin) / 100.0
-	rng := float32(pMax-pMin) / 100.0
-	rate := min + localRng.Float32()*rng
+	padder, err := newPadder(profile, pMin, pMax, localRng)
+	if err != nil {
+		return nil, err
+	}
 
 	sc := &Conn{
 		Conn:        c,
@@ -48,15 +67,14 @@ func NewConn(c net.Conn, table *Table, pMin, pMax int, record bool) *Conn {
 		reader:      bufio.NewReaderSize(c, IOBufferSize),
 		rawBuf:      make([]byte, IOBufferSize),
 		pendingData: make([]byte, 0, 4096),
-		hintBuf:     make([]byte, 0, 4),
 		rng:         localRng,
-		paddingRate: rate,
+		padder:      padder,
 	}
 	if record {
 		sc.recorder = new(bytes.Buffer)
 		sc.recording = true
 	}
-	return sc
+	return sc, nil
 }
 
 func (sc *Conn) StopRecording() {
@@ -90,49 +108,114 @@ func (sc *Conn) Write(p []byte) (n int, err error) {
 	if len(p) == 0 {
 		return 0, nil
 	}
+	if sc.shaper != nil {
+		return sc.shapedWrite(p)
+	}
+
+	bp := outPool.Get().(*[]byte)
+	out := sc.encode((*bp)[:0], p)
+	_, err = sc.Conn.Write(out)
+	if cap(out) <= maxPooledOut {
+		*bp = out
+		outPool.Put(bp)
+	}
+	return len(p), err
+}
+
+// outPool 复用 Write 的编码输出缓冲，过大的缓冲不放回
+var outPool = sync.Pool{New: func() any { b := make([]byte, 0, 6*IOBufferSize); return &b }}
+
+const maxPooledOut = 256 * 1024
+
+// 填充判断的精度: 概率量化为 1/4096
+const padBits = 12
+
+// padSlot 判断当前位置是否插入填充，thr 为 rate * 4096
+func (sc *Conn) padSlot(thr uint64) bool {
+	if sc.nbits < padBits {
+		sc.bits = sc.rng.Uint64()
+		sc.nbits = 64
+	}
+	v := sc.bits & (1<<padBits - 1)
+	sc.bits >>= padBits
+	sc.nbits -= padBits
+	return v < thr
+}
+
+// appendPad 追加一个随机填充字节
+func (sc *Conn) appendPad(out []byte) []byte {
+	pads := sc.table.PaddingPool
+	return append(out, pads[sc.rng.Uint64()%uint64(len(pads))])
+}
+
+// encode 将 p 编码为提示与填充字节并追加到 out 之后
+func (sc *Conn) encode(out []byte, p []byte) []byte {
+	start := len(out)
+	out = slices.Grow(out, len(p)*(4*sc.table.Layout.digits+2))
+	thr := uint64(sc.padder.plan(len(p), sc.rng) * (1 << padBits))
+
+	if sc.table.book != nil {
+		out = sc.encodeBook(out, p, thr)
+	} else {
+		out = sc.encodeBytes(out, p, thr)
+	}
+
+	if sc.padSlot(thr) {
+		out = sc.appendPad(out)
+	}
+	for target := start + sc.padder.fill(len(out)-start, sc.rng); len(out) < target; {
+		out = sc.appendPad(out)
+	}
+	return out
+}
 
-	outCapacity := len(p) * 6
-	out := make([]byte, 0, outCapacity)
+// encodeBytes 4x4 网格的编码: 每字节一个谜题
+func (sc *Conn) encodeBytes(out []byte, p []byte, thr uint64) []byte {
+	layout := sc.table.Layout
 	pads := sc.table.PaddingPool
-	padLen := len(pads)
+	padLen := uint64(len(pads))
+	codes := &layout.codes
+	var single *[hintCount]byte
+	if layout.digits == 1 {
+		single = &layout.single
+	}
+	rng := sc.rng
 
 	for _, b := range p {
-		if sc.rng.Float32() < sc.paddingRate {
-			out = append(out, pads[sc.rng.Intn(padLen)])
+		if sc.padSlot(thr) {
+			out = append(out, pads[rng.Uint64()%padLen])
 		}
 
+		// 一个 64 位随机数同时选出谜题 (低 32 位) 与提示顺序 (高 32 位)
+		r := rng.Uint64()
 		puzzles := sc.table.EncodeTable[b]
-		puzzle := puzzles[sc.rng.Intn(len(puzzles))]
-
-		// Shuffle hints
-		perm := []int{0, 1, 2, 3}
-		sc.rng.Shuffle(4, func(i, j int) { perm[i], perm[j] = perm[j], perm[i] })
+		puzzle := &puzzles[(r&0xFFFFFFFF)*uint64(len(puzzles))>>32]
+		perm := &perms[(r>>32)*24>>32]
 
+		if single != nil {
+			for _, idx := range perm {
+				if sc.padSlot(thr) {
+					out = append(out, pads[rng.Uint64()%padLen])
+				}
+				out = append(out, single[puzzle[idx]])
+			}
+			continue
+		}
 		for _, idx := range perm {
-			if sc.rng.Float32() < sc.paddingRate {
-				out = append(out, pads[sc.rng.Intn(padLen)])
+			for _, c := range codes[puzzle[idx]] {
+				if sc.padSlot(thr) {
+					out = append(out, pads[rng.Uint64()%padLen])
+				}
+				out = append(out, c)
 			}
-			out = append(out, puzzle[idx])
 		}
 	}
-
-	if sc.rng.Float32() < sc.paddingRate {
-		out = append(out, pads[sc.rng.Intn(padLen)])
-	}
-
-	_, err = sc.Conn.Write(out)
-	return len(p), err
+	return out
 }
 
 func (sc *Conn) Read(p []byte) (n int, err error) {
-	if len(sc.pendingData) > 0 {
-		n = copy(p, sc.pendingData)
-		if n == len(sc.pendingData) {
-			sc.pendingData = sc.pendingData[:0]
-		} else {
-			sc.pendingData = sc.pendingData[n:]
-		}
-		return n, nil
+	if sc.pendingOff < len(sc.pendingData) {
+		return sc.drain(p), nil
 	}
 
 	for {
@@ -149,39 +232,52 @@ func (sc *Conn) Read(p []byte) (n int, err error) {
 			}
 			sc.recordLock.Unlock()
 
+			layout := sc.table.Layout
 			for _, b := range chunk {
-				isPadding := false
-
-				if sc.table.IsASCII {
-					// === ASCII Mode ===
-					// Padding: 001xxxxx (Bit 6 is 0) -> (b & 0x40) == 0
-					// Hint:    01vvpppp (Bit 6 is 1) -> (b & 0x40) != 0
-					if (b & 0x40) == 0 {
-						isPadding = true
-					}
-				} else {
-					// === Entropy Mode ===
-					// Padding: 0x80... or 0x10... -> (b & 0x90) != 0
-					if (b & 0x90) != 0 {
-						isPadding = true
-					}
+				c := layout.class[b]
+				if c == classPadding {
+					continue
+				}
+				if c == classInvalid {
+					return 0, ErrMapMiss
 				}
 
-				if isPadding {
+				// 多字符提示按 s 进制累加
+				sc.hintAcc = sc.hintAcc*len(layout.symbols) + int(c)
+				sc.hintDigits++
+				if sc.hintDigits < layout.digits {
 					continue
 				}
+				id := layout.ids[sc.hintAcc]
+				if id < 0 {
+					return 0, ErrMapMiss
+				}
+				sc.hints[sc.hintCount] = byte(id)
+				sc.hintCount++
+				sc.hintAcc, sc.hintDigits = 0, 0
 
-				sc.hintBuf = append(sc.hintBuf, b)
-				if len(sc.hintBuf) == 4 {
-					key := packHintsToKey([4]byte{sc.hintBuf[0], sc.hintBuf[1], sc.hintBuf[2], sc.hintBuf[3]})
-					val, ok := sc.table.DecodeMap[key]
+				if sc.hintCount < sc.table.Variant.Clues {
+					continue
+				}
+				sc.hintCount = 0
+				if book := sc.table.book; book != nil {
+					sym, ok := book.lookup(&sc.hints)
 					if !ok {
-						// 在 ASCII 模式下，这可能是非常严重的错误或攻击
-						return 0, errors.New("INVALID_SUDOKU_MAP_MISS")
+						return 0, ErrMapMiss
 					}
-					sc.pendingData = append(sc.pendingData, val)
-					sc.hintBuf = sc.hintBuf[:0]
+					if sym < bookPairs {
+						sc.pendingData = append(sc.pendingData, byte(sym>>8), byte(sym))
+					} else {
+						sc.pendingData = append(sc.pendingData, byte(sym-bookPairs))
+					}
+					continue
+				}
+				val, ok := sc.table.Decode([4]byte(sc.hints[:4]))
+				if !ok {
+					// 在 ASCII 模式下，这可能是非常严重的错误或攻击
+					return 0, ErrMapMiss
 				}
+				sc.pendingData = append(sc.pendingData, val)
 			}
 		}
 
@@ -193,11 +289,16 @@ func (sc *Conn) Read(p []byte) (n int, err error) {
 		}
 	}
 
-	n = copy(p, sc.pendingData)
-	if n == len(sc.pendingData) {
+	return sc.drain(p), nil
+}
+
+// drain 将已解码的数据复制到 p
+func (sc *Conn) drain(p []byte) int {
+	n := copy(p, sc.pendingData[sc.pendingOff:])
+	sc.pendingOff += n
+	if sc.pendingOff == len(sc.pendingData) {
 		sc.pendingData = sc.pendingData[:0]
-	} else {
-		sc.pendingData = sc.pendingData[n:]
+		sc.pendingOff = 0
 	}
-	return n, nil
+	return n
 }
@@ -0,0 +1,263 @@
+// pkg/obfs/sudoku/conn_test.go
+package sudoku
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"testing"
+)
+
+const testKey = "test-key"
+
+// bufConn 内存中的连接: 写入追加到缓冲，读取从缓冲取出，读完返回 io.EOF
+type bufConn struct {
+	net.Conn
+	buf bytes.Buffer
+}
+
+func (c *bufConn) Read(p []byte) (int, error)  { return c.buf.Read(p) }
+func (c *bufConn) Write(p []byte) (int, error) { return c.buf.Write(p) }
+func (c *bufConn) Close() error                { return nil }
+
+// loopConn 循环读取 data，写入直接丢弃
+type loopConn struct {
+	net.Conn
+	data []byte
+	off  int
+}
+
+func (c *loopConn) Read(p []byte) (int, error) {
+	if c.off == len(c.data) {
+		c.off = 0
+	}
+	n := copy(p, c.data[c.off:])
+	c.off += n
+	return n, nil
+}
+
+func (c *loopConn) Write(p []byte) (int, error) { return len(p), nil }
+func (c *loopConn) Close() error                { return nil }
+
+var (
+	tablesMu sync.Mutex
+	tables   = map[string]*Table{}
+)
+
+// testTable 返回 testKey 下指定网格的 prefer_entropy 表，同一网格只生成一次
+func testTable(tb testing.TB, grid string) *Table {
+	tb.Helper()
+	tablesMu.Lock()
+	defer tablesMu.Unlock()
+	if t, ok := tables[grid]; ok {
+		return t
+	}
+	v, err := VariantByName(grid)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	t := NewTableVariant(testKey, v, entropyLayout())
+	tables[grid] = t
+	return t
+}
+
+// roundTrip 依次写入 writes 后从线路上读回，检查与写入的数据一致
+func roundTrip(t *testing.T, table *Table, profile string, pMin, pMax int, writes [][]byte) {
+	t.Helper()
+	conn := &bufConn{}
+	enc, err := NewConnProfile(conn, table, profile, pMin, pMax, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []byte
+	for _, w := range writes {
+		if n, err := enc.Write(w); err != nil || n != len(w) {
+			t.Fatalf("Write(%d bytes) = %d, %v", len(w), n, err)
+		}
+		want = append(want, w...)
+	}
+
+	got, err := io.ReadAll(NewConn(conn, table, 0, 0, false))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("decoded %d bytes, want %d (first mismatch at %d)", len(got), len(want), mismatch(got, want))
+	}
+}
+
+func mismatch(a, b []byte) int {
+	for i := range min(len(a), len(b)) {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return min(len(a), len(b))
+}
+
+// testWrites 覆盖全部 256 个字节值、单字节与奇数长度的写入，以及较大的随机数据
+func testWrites() [][]byte {
+	all := make([]byte, 256)
+	for i := range all {
+		all[i] = byte(i)
+	}
+	big := make([]byte, 64*1024+3)
+	rand.New(rand.NewSource(1)).Read(big)
+	return [][]byte{all, {0x00}, {0xFF}, {1, 2, 3}, bytes.Repeat([]byte{0xAA}, 1001), big}
+}
+
+func TestConnRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		profile    string
+		pMin, pMax int
+	}{
+		{"no padding", ProfileUniform, 0, 0},
+		{"uniform", ProfileUniform, 10, 30},
+		{"bursty", ProfileBursty, 5, 40},
+		{"constant", ProfileConstant, 5, 10},
+		{"http", ProfileHTTP, 5, 25},
+	}
+	table := testTable(t, Grid4x4)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roundTrip(t, table, tt.profile, tt.pMin, tt.pMax, testWrites())
+		})
+	}
+}
+
+// sizeConn 记录每次底层写入的长度
+type sizeConn struct {
+	net.Conn
+	sizes []int
+}
+
+func (c *sizeConn) Write(p []byte) (int, error) {
+	c.sizes = append(c.sizes, len(p))
+	return len(p), nil
+}
+
+// TestProfileShapes constant 的每次输出为同一帧长的整数倍；http 的首个写入至少补齐到头部大小
+func TestProfileShapes(t *testing.T) {
+	table := testTable(t, Grid4x4)
+	writes := [][]byte{{1}, make([]byte, 100), make([]byte, 5000), {2, 3}}
+
+	conn := &sizeConn{}
+	enc, err := NewConnProfile(conn, table, ProfileConstant, 5, 10, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range writes {
+		enc.Write(w)
+	}
+	frame := conn.sizes[0]
+	for i, n := range conn.sizes {
+		if n%frame != 0 {
+			t.Fatalf("constant: write %d is %d bytes, not a multiple of the %d byte frame", i, n, frame)
+		}
+	}
+
+	conn = &sizeConn{}
+	if enc, err = NewConnProfile(conn, table, ProfileHTTP, 5, 25, false); err != nil {
+		t.Fatal(err)
+	}
+	enc.Write([]byte{1})
+	if conn.sizes[0] < 300 {
+		t.Fatalf("http: first write is %d bytes, want at least 300", conn.sizes[0])
+	}
+
+	if _, err := NewConnProfile(conn, table, "nope", 0, 0, false); err == nil {
+		t.Fatal("unknown profile accepted")
+	}
+}
+
+func TestConnRejectsForeignBytes(t *testing.T) {
+	table := testTable(t, Grid4x4)
+	conn := &bufConn{}
+	conn.buf.WriteString("GET / HTTP/1.1\r\n\r\n")
+	if _, err := io.ReadAll(NewConn(conn, table, 0, 0, false)); err != ErrMapMiss {
+		t.Fatalf("err = %v, want ErrMapMiss", err)
+	}
+}
+
+// TestHotPathAllocs 稳定状态下的编码与解码不分配内存
+func TestHotPathAllocs(t *testing.T) {
+	for _, grid := range []string{Grid4x4, Grid6x6, Grid9x9} {
+		t.Run(grid, func(t *testing.T) {
+			table := testTable(t, grid)
+			plain := make([]byte, benchChunk)
+			rand.New(rand.NewSource(1)).Read(plain)
+
+			enc := NewConn(&loopConn{}, table, 2, 7, false)
+			enc.Write(plain)
+			if n := testing.AllocsPerRun(20, func() { enc.Write(plain) }); n != 0 {
+				t.Errorf("Write allocates %.1f times per call", n)
+			}
+
+			wire := &bufConn{}
+			src := NewConn(wire, table, 2, 7, false)
+			for i := 0; i < 8; i++ {
+				src.Write(plain)
+			}
+			dec := NewConn(&loopConn{data: wire.buf.Bytes()}, table, 0, 0, false)
+			buf := make([]byte, benchChunk)
+			io.ReadFull(dec, buf)
+			if n := testing.AllocsPerRun(20, func() { io.ReadFull(dec, buf) }); n != 0 {
+				t.Errorf("Read allocates %.1f times per call", n)
+			}
+		})
+	}
+}
+
+const benchChunk = 16 * 1024 // 与 TLS 记录大小相近
+
+func BenchmarkEncode(b *testing.B) {
+	for _, grid := range []string{Grid4x4, Grid6x6, Grid9x9} {
+		b.Run(grid, func(b *testing.B) {
+			table := testTable(b, grid)
+			plain := make([]byte, benchChunk)
+			rand.New(rand.NewSource(1)).Read(plain)
+			enc := NewConn(&loopConn{}, table, 2, 7, false)
+
+			b.SetBytes(benchChunk)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				enc.Write(plain)
+			}
+		})
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	for _, grid := range []string{Grid4x4, Grid6x6, Grid9x9} {
+		b.Run(grid, func(b *testing.B) {
+			table := testTable(b, grid)
+			plain := make([]byte, benchChunk)
+			rand.New(rand.NewSource(1)).Read(plain)
+
+			// 预先编码若干块，循环读取时每块都应还原为 plain
+			wire := &bufConn{}
+			src := NewConn(wire, table, 2, 7, false)
+			for i := 0; i < 16; i++ {
+				src.Write(plain)
+			}
+			dec := NewConn(&loopConn{data: wire.buf.Bytes()}, table, 0, 0, false)
+			buf := make([]byte, benchChunk)
+
+			b.SetBytes(benchChunk)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := io.ReadFull(dec, buf); err != nil {
+					b.Fatal(err)
+				}
+				if !bytes.Equal(buf, plain) {
+					b.Fatal("decoded data does not match input")
+				}
+			}
+		})
+	}
+}
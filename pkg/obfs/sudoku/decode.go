@@ -0,0 +1,83 @@
+// pkg/obfs/sudoku/decode.go
+package sudoku
+
+// 解码表下标: 4 个提示按位置排序后，位置组合 (C(16,4) = 1820 种) 的排名 << 8 | 4 个取值 (各 2 位)
+// 取代按排序后提示打包的哈希表，查找无需分配与哈希
+const (
+	comboCount = 1820
+	decodeSize = comboCount << 8
+)
+
+// binom[n][k] = C(n, k)，用于计算位置组合的排名 (码本同样使用，见 codebook.go)
+var binom = func() (b [17][9]int) {
+	for n := 0; n < 17; n++ {
+		b[n][0] = 1
+		for k := 1; k <= 8 && k <= n; k++ {
+			b[n][k] = b[n-1][k-1] + b[n-1][k]
+		}
+	}
+	return
+}()
+
+// perms 4 个提示的全部 24 种发送顺序
+var perms = func() (p [24][4]uint8) {
+	i := 0
+	for a := uint8(0); a < 4; a++ {
+		for b := uint8(0); b < 4; b++ {
+			for c := uint8(0); c < 4; c++ {
+				d := 6 - a - b - c
+				if a == b || a == c || b == c {
+					continue
+				}
+				p[i] = [4]uint8{a, b, c, d}
+				i++
+			}
+		}
+	}
+	return
+}()
+
+// minmax 无分支的比较交换 (提示顺序随机，分支预测几乎总是失败)
+func minmax(a, b int) (int, int) {
+	d := a - b
+	m := d >> 63
+	return b + d&m, a - d&m
+}
+
+// hintIndex 计算 4 个提示编号 (任意顺序) 在解码表中的下标，位置重复时返回 false
+func hintIndex(h [4]byte) (int, bool) {
+	// 以 pos<<2 | val 为键，用 4 元素排序网络按位置排序
+	k0 := int(h[0]&0x0F)<<2 | int(h[0]>>4)
+	k1 := int(h[1]&0x0F)<<2 | int(h[1]>>4)
+	k2 := int(h[2]&0x0F)<<2 | int(h[2]>>4)
+	k3 := int(h[3]&0x0F)<<2 | int(h[3]>>4)
+	k0, k1 = minmax(k0, k1)
+	k2, k3 = minmax(k2, k3)
+	k0, k2 = minmax(k0, k2)
+	k1, k3 = minmax(k1, k3)
+	k1, k2 = minmax(k1, k2)
+
+	p0, p1, p2, p3 := k0>>2, k1>>2, k2>>2, k3>>2
+	if p0 == p1 || p1 == p2 || p2 == p3 {
+		return 0, false
+	}
+	rank := p0 + binom[p1][2] + binom[p2][3] + binom[p3][4]
+	vals := (k0&3)<<6 | (k1&3)<<4 | (k2&3)<<2 | k3&3
+	return rank<<8 | vals, true
+}
+
+// setDecode 登记一组提示对应的字节
+func (t *Table) setDecode(h [4]byte, b byte) {
+	idx, _ := hintIndex(h)
+	t.decode[idx] = b
+	t.valid[idx>>6] |= 1 << (idx & 63)
+}
+
+// Decode 返回 4 个提示编号 ((val-1)<<4 | pos，任意顺序) 对应的字节，仅用于 4x4 网格
+func (t *Table) Decode(h [4]byte) (byte, bool) {
+	idx, ok := hintIndex(h)
+	if !ok || t.valid == nil || t.valid[idx>>6]&(1<<(idx&63)) == 0 {
+		return 0, false
+	}
+	return t.decode[idx], true
+}
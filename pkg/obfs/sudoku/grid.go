@@ -1,6 +1,12 @@
 // pkg/obfs/sudoku/grid.go
 package sudoku
 
+import (
+	"fmt"
+	"math/bits"
+	"math/rand"
+)
+
 // Grid represents a 4x4 sudoku grid
 type Grid [16]uint8
 
@@ -45,3 +51,103 @@ func GenerateAllGrids() []Grid {
 	backtrack(0)
 	return grids
 }
+
+// 网格规格名称
+const (
+	Grid4x4 = "4x4" // 原格式，一个谜题编码 1 字节
+	Grid6x6 = "6x6"
+	Grid9x9 = "9x9"
+)
+
+// Variant 描述一种数独网格及其谜题
+// 4x4 一个谜题编码 1 字节；6x6 与 9x9 使用码本，一个谜题编码 2 字节 (见 codebook.go)。
+// 6x6 与 9x9 的提示只放在由 key 选出的 Window 个格中，使提示编号 (val-1)*Window + cell
+// 不超过 64 个，所有布局仍用一个字符表示一个提示
+type Variant struct {
+	Name    string
+	Size    int // 边长，取值 1..Size
+	BoxRows int // 宫的行数
+	BoxCols int // 宫的列数
+	Window  int // 可放置提示的格数
+	Clues   int // 每个谜题的提示数
+
+	minSets int // 码本中每个符号至少拥有的提示组数
+}
+
+var variants = []*Variant{
+	{Name: Grid4x4, Size: 4, BoxRows: 2, BoxCols: 2, Window: 16, Clues: 4},
+	{Name: Grid6x6, Size: 6, BoxRows: 2, BoxCols: 3, Window: 8, Clues: 6, minSets: 1},
+	{Name: Grid9x9, Size: 9, BoxRows: 3, BoxCols: 3, Window: 7, Clues: 5, minSets: 2},
+}
+
+// VariantByName 返回内置网格规格
+func VariantByName(name string) (*Variant, error) {
+	for _, v := range variants {
+		if v.Name == name {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown grid %q", name)
+}
+
+// box 返回第 i 格 (按行编号) 所在的宫
+func (v *Variant) box(i int) int {
+	return i/v.Size/v.BoxRows*v.BoxRows + i%v.Size/v.BoxCols
+}
+
+// pickWindow 按 rng 选出 Window 个格，优先选取互不同行、同列、同宫的格，使窗口内的取值尽量独立
+func (v *Variant) pickWindow(rng *rand.Rand) []uint8 {
+	var window, rest []uint8
+	for _, c := range rng.Perm(v.Size * v.Size) {
+		free := len(window) < v.Window
+		for _, w := range window {
+			if int(w)/v.Size == c/v.Size || int(w)%v.Size == c%v.Size || v.box(int(w)) == v.box(c) {
+				free = false
+				break
+			}
+		}
+		if free {
+			window = append(window, uint8(c))
+		} else {
+			rest = append(rest, uint8(c))
+		}
+	}
+	return append(window, rest[:v.Window-len(window)]...)
+}
+
+// randomGrid 用随机回溯在 g 中生成一个完整网格 (按行存放)
+// 4x4 网格数量很少，直接由 GenerateAllGrids 枚举；更大的网格无法枚举，只能抽样
+func (v *Variant) randomGrid(rng *rand.Rand, g []uint8) {
+	n := v.Size
+	cells := n * n
+	full := uint16(1)<<n - 1
+	var rows, cols, boxes [9]uint16
+	var left [81]uint16 // 各格尚未尝试的取值
+	box := v.box
+
+	left[0] = full
+	for i := 0; i < cells; {
+		if left[i] == 0 {
+			// 无值可填，撤销上一格
+			i--
+			bit := uint16(1) << (g[i] - 1)
+			rows[i/n] &^= bit
+			cols[i%n] &^= bit
+			boxes[box(i)] &^= bit
+			continue
+		}
+		m := left[i]
+		for k := rng.Intn(bits.OnesCount16(m)); k > 0; k-- {
+			m &= m - 1
+		}
+		bit := m & -m
+		left[i] &^= bit
+		g[i] = uint8(bits.TrailingZeros16(bit) + 1)
+		rows[i/n] |= bit
+		cols[i%n] |= bit
+		boxes[box(i)] |= bit
+		if i++; i < cells {
+			left[i] = full &^ (rows[i/n] | cols[i%n] | boxes[box(i)])
+		}
+	}
+}
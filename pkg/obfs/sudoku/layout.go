@@ -0,0 +1,173 @@
+// pkg/obfs/sudoku/layout.go
+package sudoku
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+)
+
+// 提示编号: (val-1)<<4 | pos，共 64 种
+const hintCount = 64
+
+// 解码时字节的分类 (非负值为提示字符的数值)
+const (
+	classPadding = -1
+	classInvalid = -2
+)
+
+// 内置布局名称
+const (
+	LayoutASCII     = "prefer_ascii"   // 提示 01vvpppp，填充 001xxxxx，全部为可打印 ASCII
+	LayoutEntropy   = "prefer_entropy" // 提示 0vv0pppp，填充 0x80-0x87 / 0x10-0x17，低汉明重量
+	LayoutLowercase = "lowercase"      // 仅小写字母，每个提示占 2 个字符
+	LayoutHex       = "hex"            // 仅十六进制数字，每个提示占 2 个字符
+	LayoutBase64    = "base64"         // Base64 字符表，填充为 '=' 与换行
+	LayoutCustom    = "custom"
+)
+
+// Layout 决定提示 (val, pos) 与填充在线路上使用的字节
+// 提示字符表有 s 个字符时，每个提示编码为 d 位 s 进制数 (s^d >= 64)，字符表越小线路开销越大
+type Layout struct {
+	Name    string
+	symbols []byte            // 提示字符，下标即其数值
+	padding []byte            // 编码时使用的填充字节
+	digits  int               // 每个提示占用的字符数
+	class   [256]int16        // 解码: 提示字符的数值，或 classPadding / classInvalid
+	codes   [hintCount][]byte // 提示编号 -> 线路字节
+	single  [hintCount]byte   // digits 为 1 时的 codes，供编码快速路径使用
+	ids     []int16           // 解码: 提示编码值 (d 位 s 进制数) -> 提示编号，未使用的编码为 -1
+}
+
+// NewLayout 由提示字符表与填充字节构造布局，两者不能有重复或重叠的字节
+func NewLayout(name string, symbols, padding []byte) (*Layout, error) {
+	if len(symbols) < 2 {
+		return nil, fmt.Errorf("layout %s: need at least 2 hint symbols", name)
+	}
+	if len(padding) == 0 {
+		return nil, fmt.Errorf("layout %s: need at least 1 padding byte", name)
+	}
+	l := &Layout{
+		Name:    name,
+		symbols: append([]byte(nil), symbols...),
+		padding: append([]byte(nil), padding...),
+	}
+	for i := range l.class {
+		l.class[i] = classInvalid
+	}
+	for i, b := range l.symbols {
+		if l.class[b] != classInvalid {
+			return nil, fmt.Errorf("layout %s: duplicate hint symbol %q", name, b)
+		}
+		l.class[b] = int16(i)
+	}
+	for _, b := range l.padding {
+		if l.class[b] != classInvalid {
+			return nil, fmt.Errorf("layout %s: padding byte %q is duplicated or also a hint symbol", name, b)
+		}
+		l.class[b] = classPadding
+	}
+
+	space := 1
+	for space < hintCount {
+		space *= len(symbols)
+		l.digits++
+	}
+	values := make([]int, hintCount)
+	for i := range values {
+		values[i] = i
+	}
+	l.assign(values, space)
+	return l, nil
+}
+
+// assign 将提示编号 id 编码为数值 values[id]，space 为全部可能的编码值个数
+func (l *Layout) assign(values []int, space int) {
+	s := len(l.symbols)
+	l.ids = make([]int16, space)
+	for i := range l.ids {
+		l.ids[i] = -1
+	}
+	for id, v := range values {
+		l.ids[v] = int16(id)
+		code := make([]byte, l.digits)
+		for i := l.digits - 1; i >= 0; i-- {
+			code[i] = l.symbols[v%s]
+			v /= s
+		}
+		l.codes[id] = code
+		l.single[id] = code[0]
+	}
+}
+
+// Permute 返回按 key 打乱的布局: 在同一字符集内重新划分提示字符与填充字节，
+// 并打乱提示编号与线路编码的对应关系。解码仍为按字节查表
+// 旧布局中按位判断的宽松填充规则不再适用，只有填充集合内的字节会被视为填充
+func (l *Layout) Permute(key string) *Layout {
+	alphabet := append(append([]byte(nil), l.symbols...), l.padding...)
+	sum := sha256.Sum256([]byte("sudoku-layout:" + key))
+	rng := rand.New(rand.NewSource(int64(binary.BigEndian.Uint64(sum[:8]))))
+	rng.Shuffle(len(alphabet), func(i, j int) { alphabet[i], alphabet[j] = alphabet[j], alphabet[i] })
+
+	// 字节集合不变，不会出错
+	p, _ := NewLayout(l.Name, alphabet[:len(l.symbols)], alphabet[len(l.symbols):])
+	p.assign(rng.Perm(len(p.ids))[:hintCount], len(p.ids))
+	return p
+}
+
+// LayoutByName 返回内置布局
+func LayoutByName(name string) (*Layout, error) {
+	switch name {
+	case LayoutASCII:
+		return asciiLayout(), nil
+	case LayoutEntropy:
+		return entropyLayout(), nil
+	case LayoutLowercase:
+		// 常用字母作提示，其余字母作填充
+		return NewLayout(name, []byte("etaoinsr"), []byte("bcdfghjklmpquvwxyz"))
+	case LayoutHex:
+		return NewLayout(name, []byte("01234567"), []byte("89abcdef"))
+	case LayoutBase64:
+		return NewLayout(name, []byte("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"), []byte("=\n"))
+	}
+	return nil, fmt.Errorf("unknown layout %q", name)
+}
+
+// asciiLayout 原 prefer_ascii 格式: 提示 01vvpppp，填充 001xxxxx
+// 解码时第 6 位为 0 的字节均视为填充，与旧版行为一致
+func asciiLayout() *Layout {
+	var symbols, padding []byte
+	for i := 0; i < hintCount; i++ {
+		symbols = append(symbols, byte(0x40|i))
+	}
+	for i := 0; i < 32; i++ {
+		padding = append(padding, byte(0x20+i))
+	}
+	l, _ := NewLayout(LayoutASCII, symbols, padding)
+	for b := 0; b < 256; b++ {
+		if b&0x40 == 0 {
+			l.class[b] = classPadding
+		}
+	}
+	return l
+}
+
+// entropyLayout 原 prefer_entropy 格式: 提示 0vv0pppp，填充 10000xxx / 00010xxx
+// 解码时第 7 或第 4 位为 1 的字节均视为填充，与旧版行为一致
+func entropyLayout() *Layout {
+	var symbols, padding []byte
+	for i := 0; i < hintCount; i++ {
+		symbols = append(symbols, byte((i>>4)<<5|i&0x0F))
+	}
+	for i := 0; i < 8; i++ {
+		padding = append(padding, byte(0x80+i), byte(0x10+i))
+	}
+	l, _ := NewLayout(LayoutEntropy, symbols, padding)
+	for b := 0; b < 256; b++ {
+		if b&0x90 != 0 {
+			l.class[b] = classPadding
+		}
+	}
+	return l
+}
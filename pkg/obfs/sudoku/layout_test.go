@@ -0,0 +1,79 @@
+// pkg/obfs/sudoku/layout_test.go
+package sudoku
+
+import (
+	"bytes"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// TestLayoutAlphabet 线路上只出现布局字符集内的字节，包括填充与 constant 补齐
+func TestLayoutAlphabet(t *testing.T) {
+	for _, name := range []string{LayoutLowercase, LayoutHex, LayoutBase64} {
+		t.Run(name, func(t *testing.T) {
+			layout, err := LayoutByName(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			alphabet := append(append([]byte(nil), layout.symbols...), layout.padding...)
+
+			conn := &bufConn{}
+			enc, err := NewConnProfile(conn, withLayout(t, Grid4x4, layout), ProfileConstant, 10, 40, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, w := range testWrites() {
+				enc.Write(w)
+			}
+			for i, b := range conn.buf.Bytes() {
+				if bytes.IndexByte(alphabet, b) < 0 {
+					t.Fatalf("byte %d on the wire is %q, outside the %s alphabet", i, b, name)
+				}
+			}
+		})
+	}
+}
+
+func TestNewLayoutRejects(t *testing.T) {
+	tests := []struct {
+		name             string
+		symbols, padding string
+	}{
+		{"one symbol", "a", "b"},
+		{"no padding", "ab", ""},
+		{"duplicate symbol", "aab", "c"},
+		{"duplicate padding", "ab", "cc"},
+		{"overlap", "ab", "bc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewLayout(LayoutCustom, []byte(tt.symbols), []byte(tt.padding)); err == nil {
+				t.Fatal("NewLayout succeeded")
+			}
+		})
+	}
+	if _, err := LayoutByName("nope"); err == nil {
+		t.Fatal("LayoutByName accepted an unknown name")
+	}
+}
+
+// TestPermuteDeterministic 同一 key 的打乱结果相同，不同 key 不同，字符集保持不变
+func TestPermuteDeterministic(t *testing.T) {
+	base, _ := LayoutByName(LayoutHex)
+	a, b, c := base.Permute("k1"), base.Permute("k1"), base.Permute("k2")
+	if !reflect.DeepEqual(a.codes, b.codes) || !bytes.Equal(a.padding, b.padding) {
+		t.Fatal("same key produced different layouts")
+	}
+	if reflect.DeepEqual(a.codes, c.codes) {
+		t.Fatal("different keys produced the same layout")
+	}
+	sorted := func(l *Layout) string {
+		all := append(append([]byte(nil), l.symbols...), l.padding...)
+		slices.Sort(all)
+		return string(all)
+	}
+	if sorted(a) != sorted(base) {
+		t.Fatalf("permuted alphabet %q differs from %q", sorted(a), sorted(base))
+	}
+}
@@ -0,0 +1,118 @@
+// pkg/obfs/sudoku/padding.go
+package sudoku
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// 填充策略，决定填充密度如何随连接进程与写入大小变化
+// 填充字节与提示字节在编码上可区分，接收方与策略无关，两端可以各自选择
+const (
+	ProfileUniform  = "uniform"  // 每个连接在 [min, max] 中取固定概率 (旧行为)
+	ProfileBursty   = "bursty"   // 在稀疏与密集两种状态间随机切换，每段持续若干 KB
+	ProfileConstant = "constant" // 每次写入的输出补齐到连接固定帧长的整数倍
+	ProfileHTTP     = "http"     // 模仿 HTTP 文本: 首个写入补齐到头部大小，小写入密集、大写入稀疏
+)
+
+// ValidProfile 判断策略名是否受支持 (空字符串等同 uniform)
+func ValidProfile(name string) bool {
+	switch name {
+	case "", ProfileUniform, ProfileBursty, ProfileConstant, ProfileHTTP:
+		return true
+	}
+	return false
+}
+
+// padder 为每次写入给出逐位置的填充概率与输出的最小长度
+type padder struct {
+	profile  string
+	min, max float32
+
+	rate  float32 // uniform: 固定概率; bursty: 当前状态的概率
+	left  int     // bursty: 当前状态剩余的明文字节数
+	dense bool    // bursty: 当前是否为密集状态
+	frame int     // constant: 输出对齐的帧长
+	first bool    // http: 是否为首个写入
+}
+
+func newPadder(profile string, pMin, pMax int, rng *rand.Rand) (*padder, error) {
+	if !ValidProfile(profile) {
+		return nil, fmt.Errorf("unknown padding profile %q", profile)
+	}
+	if pMax < pMin {
+		pMax = pMin
+	}
+	p := &padder{
+		profile: profile,
+		min:     float32(pMin) / 100.0,
+		max:     float32(pMax) / 100.0,
+	}
+	switch profile {
+	case ProfileBursty:
+		p.dense = rng.Intn(2) == 0
+		p.next(rng)
+	case ProfileConstant:
+		p.rate = p.min
+		p.frame = 512 + rng.Intn(1024)
+	case ProfileHTTP:
+		p.first = true
+	default:
+		p.profile = ProfileUniform
+		p.rate = p.between(0, 1, rng)
+	}
+	return p, nil
+}
+
+// between 返回 [min, max] 区间内 lo..hi 比例段中的随机概率
+func (p *padder) between(lo, hi float32, rng *rand.Rand) float32 {
+	span := p.max - p.min
+	return p.min + span*(lo+(hi-lo)*rng.Float32())
+}
+
+// next 切换 bursty 的状态并决定其持续长度
+func (p *padder) next(rng *rand.Rand) {
+	p.dense = !p.dense
+	if p.dense {
+		p.rate = p.between(0.7, 1, rng)
+		p.left = 256 + rng.Intn(4096)
+	} else {
+		p.rate = p.between(0, 0.3, rng)
+		p.left = 1024 + rng.Intn(32*1024)
+	}
+}
+
+// plan 返回写入 n 字节明文时的逐位置填充概率
+func (p *padder) plan(n int, rng *rand.Rand) float32 {
+	switch p.profile {
+	case ProfileBursty:
+		if p.left <= 0 {
+			p.next(rng)
+		}
+		p.left -= n
+	case ProfileHTTP:
+		if p.first {
+			// 请求/响应头通常为数百字节，由 fill 补齐
+			return p.between(0.5, 1, rng)
+		}
+		if n < 512 {
+			return p.between(0.6, 1, rng)
+		}
+		return p.between(0, 0.4, rng)
+	}
+	return p.rate
+}
+
+// fill 返回长度为 size 的输出应补齐到的长度 (不小于 size)
+func (p *padder) fill(size int, rng *rand.Rand) int {
+	switch p.profile {
+	case ProfileConstant:
+		return (size + p.frame - 1) / p.frame * p.frame
+	case ProfileHTTP:
+		if p.first {
+			p.first = false
+			return max(size, 300+rng.Intn(900))
+		}
+	}
+	return size
+}
@@ -0,0 +1,160 @@
+// pkg/obfs/sudoku/shaping.go
+package sudoku
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// Shaping 写入整形参数
+// 开启后编码数据先进入缓冲，按大小或时间阈值合并发送，使底层写入的边界与时机不再与上层一一对应
+type Shaping struct {
+	FlushBytes   int           // 缓冲达到该长度 (编码后字节) 时立即发送
+	FlushDelay   time.Duration // 缓冲数据的最长等待时间，实际在 [1/2, 1] 倍之间随机
+	SegmentMin   int           // 发送时拆分为 [SegmentMin, SegmentMax] 字节的随机分段，0 为不拆分
+	SegmentMax   int
+	IdleInterval time.Duration // 空闲时发送纯填充块的平均间隔，0 为不发送
+}
+
+// 空闲填充块的长度范围
+const (
+	idleChunkMin = 16
+	idleChunkMax = 256
+)
+
+// closeFlushTimeout Close 时发送剩余缓冲的最长时间
+const closeFlushTimeout = 2 * time.Second
+
+type shaper struct {
+	opt Shaping
+
+	mu     sync.Mutex // 保护以下字段及 Conn 的 rng 与底层写入
+	buf    []byte
+	flush  *time.Timer
+	idle   *time.Timer
+	err    error // 异步发送失败后，之后的 Write 均返回该错误
+	closed bool
+}
+
+// EnableShaping 开启写入整形，须在该连接的首次 Write 之前或握手完成后、无并发写入时调用
+// 服务端应在认证成功后再开启，以免向探测者发送空闲填充
+func (sc *Conn) EnableShaping(opt Shaping) {
+	if opt.FlushBytes <= 0 {
+		opt.FlushBytes = IOBufferSize
+	}
+	if opt.SegmentMax < opt.SegmentMin {
+		opt.SegmentMax = opt.SegmentMin
+	}
+	sh := &shaper{opt: opt, buf: make([]byte, 0, opt.FlushBytes)}
+	sc.shaper = sh
+	if opt.IdleInterval > 0 {
+		// 持锁创建，定时器先于赋值触发时 idleTick 会等待 sh.idle 就绪
+		sh.mu.Lock()
+		sh.idle = time.AfterFunc(sc.jitter(opt.IdleInterval), sc.idleTick)
+		sh.mu.Unlock()
+	}
+}
+
+// jitter 返回 [d/2, d] 之间的随机时长
+func (sc *Conn) jitter(d time.Duration) time.Duration {
+	half := int64(d / 2)
+	if half <= 0 {
+		return d
+	}
+	return time.Duration(half + sc.rng.Int63n(half+1))
+}
+
+func (sc *Conn) shapedWrite(p []byte) (int, error) {
+	sh := sc.shaper
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if sh.closed {
+		return 0, net.ErrClosed
+	}
+	if sh.err != nil {
+		return 0, sh.err
+	}
+
+	sh.buf = sc.encode(sh.buf, p)
+	if sh.idle != nil {
+		sh.idle.Reset(sc.jitter(sh.opt.IdleInterval))
+	}
+	if len(sh.buf) >= sh.opt.FlushBytes || sh.opt.FlushDelay <= 0 {
+		return len(p), sc.flushLocked()
+	}
+	if sh.flush == nil {
+		sh.flush = time.AfterFunc(sc.jitter(sh.opt.FlushDelay), sc.flushTick)
+	}
+	return len(p), nil
+}
+
+// flushLocked 按随机分段写出缓冲，调用方持有 sh.mu
+func (sc *Conn) flushLocked() error {
+	sh := sc.shaper
+	if sh.flush != nil {
+		sh.flush.Stop()
+		sh.flush = nil
+	}
+
+	data := sh.buf
+	for len(data) > 0 && sh.err == nil {
+		n := len(data)
+		if sh.opt.SegmentMin > 0 {
+			n = min(n, sh.opt.SegmentMin+sc.rng.Intn(sh.opt.SegmentMax-sh.opt.SegmentMin+1))
+		}
+		_, sh.err = sc.Conn.Write(data[:n])
+		data = data[n:]
+	}
+	sh.buf = sh.buf[:0]
+	return sh.err
+}
+
+func (sc *Conn) flushTick() {
+	sh := sc.shaper
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	sh.flush = nil
+	if !sh.closed && sh.err == nil {
+		sc.flushLocked()
+	}
+}
+
+// idleTick 连接空闲时写出一个纯填充块 (接收方会直接丢弃)
+func (sc *Conn) idleTick() {
+	sh := sc.shaper
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if sh.closed || sh.err != nil {
+		return
+	}
+	if len(sh.buf) == 0 {
+		pads := sc.table.PaddingPool
+		n := idleChunkMin + sc.rng.Intn(idleChunkMax-idleChunkMin+1)
+		for i := 0; i < n; i++ {
+			sh.buf = append(sh.buf, pads[sc.rng.Intn(len(pads))])
+		}
+		sc.flushLocked()
+	}
+	sh.idle.Reset(sc.jitter(sh.opt.IdleInterval))
+}
+
+// Close 发送缓冲中剩余的数据后关闭连接
+// 另一个 Write 可能正阻塞在底层写入上，因此先设置写超时，保证 Close 不会无限等待
+func (sc *Conn) Close() error {
+	if sh := sc.shaper; sh != nil {
+		sc.Conn.SetWriteDeadline(time.Now().Add(closeFlushTimeout))
+		sh.mu.Lock()
+		if !sh.closed {
+			sh.closed = true
+			if sh.idle != nil {
+				sh.idle.Stop()
+			}
+			if sh.err == nil {
+				sc.flushLocked()
+			}
+		}
+		sh.mu.Unlock()
+	}
+	return sc.Conn.Close()
+}
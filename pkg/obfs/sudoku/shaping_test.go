@@ -0,0 +1,126 @@
+// pkg/obfs/sudoku/shaping_test.go
+package sudoku
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordConn 记录每次底层写入，可并发使用
+type recordConn struct {
+	net.Conn
+	mu     sync.Mutex
+	writes [][]byte
+}
+
+func (c *recordConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	c.writes = append(c.writes, append([]byte(nil), p...))
+	c.mu.Unlock()
+	return len(p), nil
+}
+
+func (c *recordConn) Close() error                       { return nil }
+func (c *recordConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// snapshot 返回写入次数与全部写入的拼接
+func (c *recordConn) snapshot() (int, []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.writes), bytes.Join(c.writes, nil)
+}
+
+// decodeAll 解码线路数据
+func decodeAll(t *testing.T, table *Table, wire []byte) []byte {
+	t.Helper()
+	conn := &bufConn{}
+	conn.buf.Write(wire)
+	got, err := io.ReadAll(NewConn(conn, table, 0, 0, false))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return got
+}
+
+func TestShapingCoalesces(t *testing.T) {
+	table := testTable(t, Grid4x4)
+	conn := &recordConn{}
+	enc := NewConn(conn, table, 0, 0, false)
+	enc.EnableShaping(Shaping{FlushBytes: 1 << 20, FlushDelay: 20 * time.Millisecond})
+
+	for _, w := range []string{"hello ", "sudoku ", "world"} {
+		enc.Write([]byte(w))
+	}
+	if n, _ := conn.snapshot(); n != 0 {
+		t.Fatalf("%d writes before the flush delay", n)
+	}
+	time.Sleep(100 * time.Millisecond)
+	n, wire := conn.snapshot()
+	if n != 1 {
+		t.Fatalf("%d writes after the flush delay, want 1", n)
+	}
+	if got := decodeAll(t, table, wire); string(got) != "hello sudoku world" {
+		t.Fatalf("decoded %q", got)
+	}
+}
+
+func TestShapingSegments(t *testing.T) {
+	table := testTable(t, Grid4x4)
+	conn := &recordConn{}
+	enc := NewConn(conn, table, 0, 0, false)
+	enc.EnableShaping(Shaping{FlushBytes: 1024, SegmentMin: 100, SegmentMax: 300})
+
+	plain := bytes.Repeat([]byte("0123456789"), 200)
+	enc.Write(plain)
+	enc.Close()
+
+	conn.mu.Lock()
+	for i, w := range conn.writes[:len(conn.writes)-1] {
+		if len(w) < 100 || len(w) > 300 {
+			t.Errorf("segment %d is %d bytes, want 100-300", i, len(w))
+		}
+	}
+	conn.mu.Unlock()
+	if _, wire := conn.snapshot(); !bytes.Equal(decodeAll(t, table, wire), plain) {
+		t.Fatal("segmented output does not decode to the input")
+	}
+}
+
+// TestShapingIdlePadding 空闲填充块在接收方解码为空
+func TestShapingIdlePadding(t *testing.T) {
+	table := testTable(t, Grid4x4)
+	conn := &recordConn{}
+	enc := NewConn(conn, table, 0, 0, false)
+	enc.EnableShaping(Shaping{IdleInterval: 10 * time.Millisecond})
+
+	time.Sleep(100 * time.Millisecond)
+	enc.Close()
+	n, wire := conn.snapshot()
+	if n == 0 {
+		t.Fatal("no idle padding written")
+	}
+	if got := decodeAll(t, table, wire); len(got) != 0 {
+		t.Fatalf("idle padding decoded to %d bytes", len(got))
+	}
+}
+
+func TestShapingCloseFlushes(t *testing.T) {
+	table := testTable(t, Grid4x4)
+	conn := &recordConn{}
+	enc := NewConn(conn, table, 0, 0, false)
+	enc.EnableShaping(Shaping{FlushBytes: 1 << 20, FlushDelay: time.Hour})
+
+	enc.Write([]byte("pending"))
+	enc.Close()
+	_, wire := conn.snapshot()
+	if got := decodeAll(t, table, wire); string(got) != "pending" {
+		t.Fatalf("decoded %q after Close", got)
+	}
+	if _, err := enc.Write([]byte("x")); err == nil {
+		t.Fatal("Write after Close succeeded")
+	}
+}
@@ -6,48 +6,86 @@ import (
 	"encoding/binary"
 	"log"
 	"math/rand"
-	"sort"
 	"time"
 )
 
 type Table struct {
-	EncodeTable [256][][4]byte
-	DecodeMap   map[uint32]byte
+	EncodeTable [256][][4]byte // 字节 -> 可选的 4 个提示编号 ((val-1)<<4 | pos)
 	PaddingPool []byte
 	IsASCII     bool // 标记当前模式
+	Layout      *Layout
+	Variant     *Variant // 网格规格，4x4 使用 EncodeTable，其余使用码本
+
+	decode  []byte    // 解码表，下标见 decode.go
+	valid   []uint64  // decode 中已登记下标的位图
+	book    *codebook // 6x6 / 9x9 的码本 (见 codebook.go)
+	keyHash [32]byte  // 缓存文件中用于识别 key 与网格 (见 cache.go)
 }
 
 // NewTable initializes the obfuscation tables
-// mode: "prefer_ascii" or "prefer_entropy"
+// mode: 内置布局名称 (见 layout.go)，无法识别时使用 "prefer_entropy"
 func NewTable(key string, mode string) *Table {
-	start := time.Now()
-	t := &Table{
-		DecodeMap: make(map[uint32]byte),
-		IsASCII:   mode == "prefer_ascii",
+	layout, err := LayoutByName(mode)
+	if err != nil {
+		layout = entropyLayout()
 	}
+	return NewTableWithLayout(key, layout)
+}
 
-	// 初始化填充池和编码逻辑
-	if t.IsASCII {
-		// === ASCII Mode (0x20 - 0x7F) ===
-		// Payload (Hint): 01vvpppp (Bit 6 is 1) -> 0x40 | ...
-		// Padding: 001xxxxx (Bit 6 is 0) -> 0x20 | rand(0-31)
-		// Range: Padding [32, 63], Payload [64, 127]
-
-		t.PaddingPool = make([]byte, 0, 32)
-		for i := 0; i < 32; i++ {
-			// 001xxxxx -> 0x20 + i
-			t.PaddingPool = append(t.PaddingPool, byte(0x20+i))
-		}
+// NewTableWithLayout 使用指定的线路布局生成 4x4 网格的混淆表
+// 网格分配只取决于 key，同一 key 下不同布局编码的是相同的提示
+func NewTableWithLayout(key string, layout *Layout) *Table {
+	return NewTableVariant(key, variants[0], layout)
+}
+
+// NewTableVariant 使用指定的网格规格与线路布局生成混淆表
+func NewTableVariant(key string, v *Variant, layout *Layout) *Table {
+	start := time.Now()
+	var t *Table
+	if v.Name == Grid4x4 {
+		t = newTable(key, layout, buildEncodeTable(key))
 	} else {
-		// === Entropy Mode (Legacy) ===
-		// Padding: 0x80 (10000xxx) & 0x10 (00010xxx)
-		// Payload: Avoids bits 7 and 4 being strictly defined like padding
-		t.PaddingPool = make([]byte, 0, 16)
-		for i := 0; i < 8; i++ {
-			t.PaddingPool = append(t.PaddingPool, byte(0x80+i))
-			t.PaddingPool = append(t.PaddingPool, byte(0x10+i))
+		t = newBookTable(key, layout, buildCodebook(key, v))
+	}
+	log.Printf("[Init] Sudoku Tables initialized (%s, %s) in %v", v.Name, layout.Name, time.Since(start))
+	return t
+}
+
+// newTable 由编码表生成解码表
+func newTable(key string, layout *Layout, enc *[256][][4]byte) *Table {
+	t := &Table{
+		EncodeTable: *enc,
+		PaddingPool: layout.padding,
+		IsASCII:     layout.Name == LayoutASCII,
+		Layout:      layout,
+		Variant:     variants[0],
+		decode:      make([]byte, decodeSize),
+		valid:       make([]uint64, decodeSize/64),
+		keyHash:     tableKeyHash(key, variants[0]),
+	}
+	for b, hints := range t.EncodeTable {
+		for _, h := range hints {
+			t.setDecode(h, byte(b))
 		}
 	}
+	return t
+}
+
+// newBookTable 使用码本的混淆表
+func newBookTable(key string, layout *Layout, book *codebook) *Table {
+	return &Table{
+		PaddingPool: layout.padding,
+		IsASCII:     layout.Name == LayoutASCII,
+		Layout:      layout,
+		Variant:     book.v,
+		book:        book,
+		keyHash:     tableKeyHash(key, book.v),
+	}
+}
+
+// buildEncodeTable 按 key 为每个字节分配网格，并枚举能唯一确定该网格的 4 个提示
+func buildEncodeTable(key string) *[256][][4]byte {
+	var enc [256][][4]byte
 
 	// 生成数独网格 (逻辑不变)
 	allGrids := GenerateAllGrids()
@@ -87,7 +125,7 @@ func NewTable(key string, mode string) *Table {
 			var currentHints [4]byte
 
 			// 1. 计算抽象提示 (Abstract Hints)
-			// 我们先计算出 val 和 pos，后面再根据模式编码成 byte
+			// 我们先计算出 val 和 pos，写出时再由 Layout 编码成 byte
 			var rawParts [4]struct{ val, pos byte }
 
 			for i, pos := range positions {
@@ -114,45 +152,14 @@ func NewTable(key string, mode string) *Table {
 			}
 
 			if matchCount == 1 {
-				// 唯一确定，生成最终编码字节
+				// 唯一确定，记录提示编号，线路字节由 Layout 决定
 				for i, p := range rawParts {
-					if t.IsASCII {
-						// ASCII Encoding: 01vvpppp
-						// vv = val-1 (0..3), pppp = pos (0..15)
-						// 0x40 | (vv << 4) | pppp
-						currentHints[i] = 0x40 | ((p.val - 1) << 4) | (p.pos & 0x0F)
-					} else {
-						// Entropy Encoding (Legacy)
-						// 0vv0pppp
-						// 格式: ((val-1) << 5) | pos
-						currentHints[i] = ((p.val - 1) << 5) | (p.pos & 0x0F)
-					}
+					currentHints[i] = ((p.val - 1) << 4) | (p.pos & 0x0F)
 				}
 
-				t.EncodeTable[byteVal] = append(t.EncodeTable[byteVal], currentHints)
-				// 生成解码键 (需要对 Hints 进行排序以忽略传输顺序)
-				key := packHintsToKey(currentHints)
-				t.DecodeMap[key] = byte(byteVal)
+				enc[byteVal] = append(enc[byteVal], currentHints)
 			}
 		}
 	}
-	log.Printf("[Init] Sudoku Tables initialized (%s) in %v", mode, time.Since(start))
-	return t
-}
-
-func packHintsToKey(hints [4]byte) uint32 {
-	// 注意：对于 DecodeMap，key 必须是排序后的 hint 组合
-	// 无论网络传输层怎么乱序，都能还原
-	s := make([]int, 4)
-	for i, h := range hints {
-		s[i] = int(h)
-	}
-	sort.Ints(s)
-
-	var key uint32
-	key |= uint32(s[0]) << 24
-	key |= uint32(s[1]) << 16
-	key |= uint32(s[2]) << 8
-	key |= uint32(s[3])
-	return key
+	return &enc
 }
@@ -0,0 +1,77 @@
+// pkg/sudoku/config.go
+package sudoku
+
+import (
+	"time"
+
+	"github.com/Futaiii/Sudoku_ASCII/internal/config"
+	"github.com/Futaiii/Sudoku_ASCII/internal/protocol"
+	obfs "github.com/Futaiii/Sudoku_ASCII/pkg/obfs/sudoku"
+)
+
+// 与命令行程序共用的配置类型，字段含义与 config.json 一致
+type (
+	Config      = config.Config
+	UserConfig  = config.UserConfig
+	MieruConfig = config.MieruConfig
+	MuxConfig   = config.MuxConfig
+
+	TimeoutConfig    = config.TimeoutConfig
+	ShapingConfig    = config.ShapingConfig
+	CustomLayout     = config.CustomLayout
+	AccountingConfig = config.AccountingConfig
+	RateLimitConfig  = config.RateLimitConfig
+	ACLConfig        = config.ACLConfig
+	ACLRule          = config.ACLRule
+	BanConfig        = config.BanConfig
+)
+
+// ReplyError 服务端报告的目标连接失败，Code 为 protocol 中的应答码
+type ReplyError = protocol.ReplyError
+
+// LoadConfig 读取 JSON 配置文件并填充默认值
+func LoadConfig(path string) (*Config, error) {
+	return config.Load(path)
+}
+
+// NewTable 按配置中的 key、grid、layout 与 permute_layout 生成数独混淆表，设置了 table_cache 时优先从缓存加载
+func NewTable(cfg *Config) (*obfs.Table, error) {
+	v, err := obfs.VariantByName(cfg.Grid)
+	if err != nil {
+		return nil, err
+	}
+	layout, err := NewLayout(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return obfs.NewTableCached(cfg.Key, v, layout, cfg.TableCache), nil
+}
+
+// NewLayout 按配置中的 layout、custom_layout 与 permute_layout 生成线路布局
+func NewLayout(cfg *Config) (*obfs.Layout, error) {
+	var layout *obfs.Layout
+	var err error
+	if cfg.Layout == obfs.LayoutCustom && cfg.CustomLayout != nil {
+		layout, err = obfs.NewLayout(obfs.LayoutCustom, []byte(cfg.CustomLayout.Hints), []byte(cfg.CustomLayout.Padding))
+	} else {
+		layout, err = obfs.LayoutByName(cfg.Layout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cfg.PermuteLayout {
+		layout = layout.Permute(cfg.Key)
+	}
+	return layout, nil
+}
+
+// shapingOptions 将配置转换为数独层的写入整形参数
+func shapingOptions(c *ShapingConfig) obfs.Shaping {
+	return obfs.Shaping{
+		FlushBytes:   c.FlushBytes,
+		FlushDelay:   time.Duration(c.FlushDelay) * time.Millisecond,
+		SegmentMin:   c.SegmentMin,
+		SegmentMax:   c.SegmentMax,
+		IdleInterval: time.Duration(c.IdleInterval) * time.Millisecond,
+	}
+}
@@ -0,0 +1,255 @@
+// pkg/sudoku/dialer.go
+package sudoku
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"time"
+
+	"github.com/Futaiii/Sudoku_ASCII/internal/auth"
+	"github.com/Futaiii/Sudoku_ASCII/internal/hybrid"
+	"github.com/Futaiii/Sudoku_ASCII/internal/metrics"
+	"github.com/Futaiii/Sudoku_ASCII/internal/protocol"
+	"github.com/Futaiii/Sudoku_ASCII/pkg/crypto"
+	obfs "github.com/Futaiii/Sudoku_ASCII/pkg/obfs/sudoku"
+)
+
+// Dialer 经由 Sudoku 服务端建立到目标的 TCP 连接
+// 满足 golang.org/x/net/proxy 的 Dialer 与 ContextDialer 接口，可直接用于 http.Transport:
+//
+//	cfg, _ := sudoku.LoadConfig("client.json")
+//	d, _ := sudoku.NewDialer(cfg, nil)
+//	client := &http.Client{Transport: &http.Transport{DialContext: d.DialContext}}
+type Dialer struct {
+	cfg   *Config
+	table *obfs.Table
+	mgr   *hybrid.Manager
+	pool  muxPool
+}
+
+// NewDialer 根据配置创建 Dialer，会使用 cfg 的 ServerAddress、Key、AEAD、ASCII、Padding、
+// HandshakeVersion、User、Timeouts、Mux 与 Mieru 相关字段
+// table 为 nil 时按 Key / ASCII 生成 (需要数百毫秒，多个 Dialer 可共享同一张表)
+// 开启分离模式时会启动 Mieru 客户端 (每个进程一个)，之后创建的 Dialer 若 Mieru 配置或服务端主机不同则返回错误
+func NewDialer(cfg *Config, table *obfs.Table) (*Dialer, error) {
+	if cfg.ServerAddress == "" {
+		return nil, errors.New("sudoku: server_address is required")
+	}
+	if err := cfg.Normalize(); err != nil {
+		return nil, err
+	}
+	if table == nil {
+		var err error
+		if table, err = NewTable(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	mgr, err := hybrid.Acquire(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := mgr.StartMieruClient(); err != nil {
+		return nil, err
+	}
+	return &Dialer{cfg: cfg, table: table, mgr: mgr}, nil
+}
+
+// Dial 等同于 DialContext(context.Background(), network, addr)
+func (d *Dialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+// DialContext 通过隧道连接 addr (host:port)，仅支持 TCP
+// v2 握手时等待服务端连接目标的应答，失败时返回 *ReplyError；v1 握手或 optimistic 模式下不等待
+// ctx 在连接建立 (含握手与配对) 完成前取消时中止，之后不再影响返回的连接
+func (d *Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("sudoku: unsupported network %s", network)
+	}
+
+	conn, err := d.DialTunnel(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// 发送目标地址 (Split 模式下通过 Sudoku 上行发送)
+	// 应答需要服务端支持: 支持 v2 握手的服务端均会应答，v1 握手可能连接的是不发送应答的旧版服务端
+	if d.cfg.Optimistic || d.cfg.HandshakeVersion < 2 {
+		if err := protocol.WriteAddress(conn, addr); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+
+	// 请求应答并等待服务端连接目标的结果
+	req := bytes.NewBuffer([]byte{protocol.ConnectAckMagic})
+	if err := protocol.WriteAddress(req, addr); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if _, err := conn.Write(req.Bytes()); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	timeout := time.Duration(d.cfg.Timeouts.Connect+d.cfg.Timeouts.Handshake) * time.Second
+	done := withDeadline(ctx, conn, timeout)
+	reply := make([]byte, 1)
+	_, err = io.ReadFull(conn, reply)
+	if derr := done(); err == nil {
+		err = derr
+	}
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	if reply[0] != protocol.ReplySucceeded {
+		conn.Close()
+		return nil, &ReplyError{Code: reply[0]}
+	}
+	return conn, nil
+}
+
+// DialTunnel 返回一条已完成握手、尚未写入目标的隧道
+// 启用多路复用时从会话池中打开新流，否则新建 Sudoku 连接
+// 调用方需自行写入首个命令 (目标地址或 UDP 关联标志)，一般应使用 DialContext
+func (d *Dialer) DialTunnel(ctx context.Context) (net.Conn, error) {
+	if d.cfg.Mux.Enable {
+		return d.pool.openStream(ctx, d)
+	}
+	return d.dialSudoku(ctx)
+}
+
+// Close 关闭多路复用会话，其上的流随之关闭，之后不能再打开多路复用流；不影响非多路复用的连接
+func (d *Dialer) Close() error {
+	d.pool.close()
+	return nil
+}
+
+// CloseWhenIdle 多路复用会话不再承载新流，已打开的流不受影响，会话在其上的流全部结束后立即关闭
+// 用于替换 Dialer (如热更新) 时释放旧会话；之后仍可拨号，但每个新流使用单独的会话
+func (d *Dialer) CloseWhenIdle() {
+	d.pool.closeWhenIdle()
+}
+
+// dialSudoku 建立到服务端的 Sudoku 隧道并完成握手
+func (d *Dialer) dialSudoku(ctx context.Context) (net.Conn, error) {
+	cfg := d.cfg
+
+	// 1. Sudoku Dial (Uplink)
+	nd := net.Dialer{Timeout: time.Duration(cfg.Timeouts.Connect) * time.Second}
+	rawRemote, err := nd.DialContext(ctx, "tcp", cfg.ServerAddress)
+	if err != nil {
+		log.Printf("[Proxy] Dial Server Failed: %v", err)
+		return nil, err
+	}
+
+	// 握手 (含用户标识与 Split 头) 受 handshake 超时与 ctx 约束
+	done := withDeadline(ctx, rawRemote, time.Duration(cfg.Timeouts.Handshake)*time.Second)
+	// 出错返回时同样要注销 ctx 回调，否则长期存活的 ctx 会一直持有已关闭的连接；重复调用无副作用
+	defer done()
+
+	sConn, err := obfs.NewConnProfile(metrics.CountConn(rawRemote, metrics.LayerRaw), d.table, cfg.PaddingProfile, cfg.PaddingMin, cfg.PaddingMax, false)
+	if err != nil {
+		rawRemote.Close()
+		return nil, err
+	}
+	dConn := metrics.CountConn(sConn, metrics.LayerDecoded)
+
+	// 多用户模式: 先在 AEAD 层之外发送用户标识，之后使用用户密钥
+	key := cfg.Key
+	if cfg.User != nil {
+		hint := auth.CurrentHint(cfg.User.Key)
+		if _, err := dConn.Write(hint[:]); err != nil {
+			rawRemote.Close()
+			return nil, err
+		}
+		key = cfg.User.Key
+	}
+
+	cConn, err := crypto.NewAEADConn(dConn, key, cfg.AEAD)
+	if err != nil {
+		rawRemote.Close()
+		return nil, err
+	}
+
+	// 2. 握手逻辑
+	if err := clientHandshake(cConn, key, cfg.HandshakeVersion); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		log.Printf("[Proxy] Handshake Failed: %v", err)
+		metrics.HandshakeFailures.With(metrics.FailureReason(err)).Inc()
+		cConn.Close()
+		return nil, err
+	}
+	metrics.HandshakeSuccess.Inc()
+	if cfg.Shaping.Enable {
+		sConn.EnableShaping(shapingOptions(cfg.Shaping))
+	}
+
+	if !cfg.EnableMieru {
+		// 标准模式
+		if err := done(); err != nil {
+			cConn.Close()
+			return nil, err
+		}
+		return cConn, nil
+	}
+
+	// *** Split Mode Logic ***
+	splitUUID := hybrid.GenerateUUID()
+	// 发送 Split 标志 (0xFF) + UUID
+	// 发送 [Magic][Len][UUID]
+	uuidBytes := []byte(splitUUID) // hex string usually 32 bytes
+	splitHeader := make([]byte, 0, 2+len(uuidBytes))
+	splitHeader = append(splitHeader, protocol.SplitMagic, byte(len(uuidBytes)))
+	splitHeader = append(splitHeader, uuidBytes...)
+	if _, err := cConn.Write(splitHeader); err != nil {
+		cConn.Close()
+		return nil, err
+	}
+	if err := done(); err != nil {
+		cConn.Close()
+		return nil, err
+	}
+
+	// 3. 建立 Mieru Downlink
+	pairCtx, cancel := context.WithTimeout(ctx, time.Duration(cfg.Timeouts.Pairing)*time.Second)
+	mConn, err := d.mgr.DialMieruForDownlink(pairCtx, splitUUID)
+	cancel()
+	if err != nil {
+		log.Printf("[Split] Failed to dial Mieru: %v", err)
+		cConn.Close()
+		return nil, err
+	}
+
+	// 4. 组合连接
+	// Sudoku (cConn) 用于写 (上行)
+	// Mieru (mConn) 用于读 (下行)
+	return &hybrid.SplitConn{
+		Conn:   cConn, // 基础接口用 Sudoku
+		Writer: cConn,
+		Reader: mConn,
+		CloseFn: func() error {
+			e1 := cConn.Close()
+			e2 := mConn.Close()
+			if e1 != nil {
+				return e1
+			}
+			return e2
+		},
+	}, nil
+}
@@ -0,0 +1,280 @@
+// pkg/sudoku/dialer_test.go
+package sudoku
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Futaiii/Sudoku_ASCII/internal/protocol"
+	obfs "github.com/Futaiii/Sudoku_ASCII/pkg/obfs/sudoku"
+)
+
+var (
+	testTableOnce sync.Once
+	testTable     *obfs.Table
+)
+
+// sharedTable 各测试共用一张表，避免重复生成
+func sharedTable(t *testing.T) *obfs.Table {
+	t.Helper()
+	testTableOnce.Do(func() {
+		var err error
+		if testTable, err = NewTable(&Config{Key: "test-key", Grid: "4x4", Layout: "prefer_entropy"}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	return testTable
+}
+
+// startListener 在回环地址上启动 Listener，返回客户端配置
+func startListener(t *testing.T) (*Listener, *Config) {
+	t.Helper()
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := NewListener(inner, &Config{Mode: "server", Key: "test-key", AEAD: "chacha20-poly1305"}, sharedTable(t))
+	if err != nil {
+		inner.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l, &Config{Mode: "client", Key: "test-key", AEAD: "chacha20-poly1305", ServerAddress: inner.Addr().String(), HandshakeVersion: 2}
+}
+
+// echoStreams 回显每个流的目标地址与收到的数据，直到 Listener 关闭
+func echoStreams(l *Listener) {
+	for {
+		s, err := l.AcceptStream()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer s.Close()
+			s.Write([]byte(s.Destination + "|"))
+			io.Copy(s, s)
+		}()
+	}
+}
+
+// ping 经 echoStreams 回显验证连接可用
+func ping(t *testing.T, conn net.Conn, dest string) {
+	t.Helper()
+	conn.Write([]byte("ping"))
+	want := dest + "|ping"
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(conn, got); err != nil || string(got) != want {
+		t.Fatalf("read %q, %v, want %q", got, err, want)
+	}
+}
+
+func TestDialContext(t *testing.T) {
+	l, cfg := startListener(t)
+	d, err := NewDialer(cfg, sharedTable(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	go echoStreams(l)
+
+	conn, err := d.DialContext(context.Background(), "tcp", "example.com:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ping(t, conn, "example.com:443")
+
+	if _, err := d.DialContext(context.Background(), "udp", "example.com:53"); err == nil {
+		t.Fatal("DialContext(udp) succeeded")
+	}
+}
+
+func TestDialContextReplyError(t *testing.T) {
+	l, cfg := startListener(t)
+	d, err := NewDialer(cfg, sharedTable(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	go func() {
+		s, err := l.AcceptStream()
+		if err != nil {
+			return
+		}
+		defer s.Close()
+		s.Reply(errors.New("no route"))
+	}()
+
+	_, err = d.DialContext(context.Background(), "tcp", "unreachable.test:80")
+	var re *ReplyError
+	if !errors.As(err, &re) || re.Code == protocol.ReplySucceeded {
+		t.Fatalf("DialContext = %v, want *ReplyError", err)
+	}
+}
+
+// TestDialContextV1NoReply v1 握手的客户端不请求应答，旧版服务端不会因此误读目标地址
+func TestDialContextV1NoReply(t *testing.T) {
+	l, cfg := startListener(t)
+	cfg.HandshakeVersion = 1
+	d, err := NewDialer(cfg, sharedTable(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	streams := make(chan *Stream, 1)
+	go func() {
+		if s, err := l.AcceptStream(); err == nil {
+			streams <- s
+		}
+	}()
+
+	conn, err := d.DialContext(context.Background(), "tcp", "example.com:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	s := <-streams
+	defer s.Close()
+	if s.ack || s.Destination != "example.com:443" {
+		t.Fatalf("stream ack = %v, destination %q", s.ack, s.Destination)
+	}
+}
+
+// TestDialContextCancel 服务端不应答时，取消 ctx 会中止握手
+func TestDialContextCancel(t *testing.T) {
+	silent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	go func() {
+		for {
+			c, err := silent.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+
+	d, err := NewDialer(&Config{Mode: "client", Key: "test-key", AEAD: "chacha20-poly1305", ServerAddress: silent.Addr().String(), HandshakeVersion: 2}, sharedTable(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	if _, err := d.DialContext(ctx, "tcp", "example.com:443"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("DialContext = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("DialContext returned after %v", elapsed)
+	}
+}
+
+// TestDialerCloseWhenIdle 旧会话上的流不受影响，结束后会话关闭；之后的拨号仍可用且不留下会话
+func TestDialerCloseWhenIdle(t *testing.T) {
+	l, cfg := startListener(t)
+	cfg.Mux = &MuxConfig{Enable: true, IdleTimeout: 3600}
+	d, err := NewDialer(cfg, sharedTable(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	go echoStreams(l)
+
+	old, err := d.DialContext(context.Background(), "tcp", "a.example:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess := d.pool.sessions[0]
+	d.CloseWhenIdle()
+	ping(t, old, "a.example:443")
+
+	late, err := d.DialContext(context.Background(), "tcp", "b.example:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ping(t, late, "b.example:443")
+	if n := len(d.pool.sessions); n != 0 {
+		t.Fatalf("%d sessions pooled after CloseWhenIdle", n)
+	}
+
+	old.Close()
+	late.Close()
+	select {
+	case <-sess.CloseChan():
+	case <-time.After(2 * time.Second):
+		t.Fatal("old session not closed after its last stream")
+	}
+}
+
+// countListener 统计接受的连接数
+type countListener struct {
+	net.Listener
+	n atomic.Int32
+}
+
+func (l *countListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err == nil {
+		l.n.Add(1)
+	}
+	return c, err
+}
+
+// TestMuxPoolSingleDial 没有可用会话时，并发的请求共用同一次拨号
+func TestMuxPoolSingleDial(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counted := &countListener{Listener: inner}
+	l, err := NewListener(counted, &Config{Mode: "server", Key: "test-key", AEAD: "chacha20-poly1305"}, sharedTable(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go echoStreams(l)
+
+	d, err := NewDialer(&Config{
+		Mode: "client", Key: "test-key", AEAD: "chacha20-poly1305", ServerAddress: inner.Addr().String(), HandshakeVersion: 2,
+		Mux: &MuxConfig{Enable: true, MaxStreams: 32},
+	}, sharedTable(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := d.DialContext(context.Background(), "tcp", "example.com:443")
+			if err != nil {
+				errs <- err
+				return
+			}
+			conn.Close()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	if n := counted.n.Load(); n != 1 {
+		t.Fatalf("%d connections for 16 concurrent streams, want 1", n)
+	}
+}
@@ -0,0 +1,122 @@
+// pkg/sudoku/handshake.go
+package sudoku
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/Futaiii/Sudoku_ASCII/internal/protocol"
+	"github.com/Futaiii/Sudoku_ASCII/pkg/crypto"
+)
+
+// ErrKexAuth 对端的密钥交换认证码不正确 (密钥不一致或遭到篡改)
+var ErrKexAuth = errors.New("key exchange authentication failed")
+
+// ErrKexClosed 服务端在密钥交换应答前关闭了连接，通常是不支持 v2 握手的旧版服务端
+var ErrKexClosed = errors.New(`server closed the connection during key exchange; if it predates handshake_version 2, set "handshake_version": 1`)
+
+// withDeadline 为握手阶段的读写设置截止时间 (timeout 与 ctx 截止时间中较早者)，
+// ctx 取消时立即中断阻塞中的读写
+// 返回的 done 清除截止时间，ctx 已取消时返回 ctx.Err()
+func withDeadline(ctx context.Context, conn net.Conn, timeout time.Duration) (done func() error) {
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Unix(1, 0))
+	})
+	return func() error {
+		if !stop() {
+			return ctx.Err()
+		}
+		return conn.SetDeadline(time.Time{})
+	}
+}
+
+// clientHandshake 发送握手并在 v2 下完成密钥交换
+// v1 上行: [Timestamp(8)][Nonce(8)]
+// v2 上行: [Timestamp(8)][Nonce(8)][Version(1)][ClientPub(32)][MAC(32)]
+// v2 下行: [ServerPub(32)][MAC(32)]
+// 密钥交换完成后 cConn 切换为会话密钥
+func clientHandshake(cConn *crypto.AEADConn, psk string, version int) error {
+	handshake := make([]byte, 16)
+	binary.BigEndian.PutUint64(handshake[:8], uint64(time.Now().Unix()))
+	rand.Read(handshake[8:16])
+
+	if version < 2 {
+		_, err := cConn.Write(handshake)
+		return err
+	}
+
+	kex, err := crypto.NewKeyExchange()
+	if err != nil {
+		return err
+	}
+	clientPub := kex.PublicKey()
+
+	msg := make([]byte, 0, 16+1+crypto.KexPublicKeySize+crypto.KexMACSize)
+	msg = append(msg, handshake...)
+	msg = append(msg, protocol.HandshakeVersionX25519)
+	msg = append(msg, clientPub...)
+	msg = append(msg, crypto.KexMAC(psk, crypto.KexLabelClient, handshake, clientPub)...)
+	if _, err := cConn.Write(msg); err != nil {
+		return err
+	}
+
+	resp := make([]byte, crypto.KexPublicKeySize+crypto.KexMACSize)
+	if _, err := io.ReadFull(cConn, resp); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return ErrKexClosed
+		}
+		return err
+	}
+	serverPub := resp[:crypto.KexPublicKeySize]
+	if !crypto.VerifyKexMAC(psk, crypto.KexLabelServer, resp[crypto.KexPublicKeySize:], handshake, clientPub, serverPub) {
+		return ErrKexAuth
+	}
+
+	readKey, writeKey, err := kex.SessionKeys(serverPub, handshake, true)
+	if err != nil {
+		return err
+	}
+	return cConn.Rekey(readKey, writeKey)
+}
+
+// serverKeyExchange 处理 v2 握手中版本字节之后的部分
+// handshake 为已读取并校验过时间戳的 16 字节
+func serverKeyExchange(cConn *crypto.AEADConn, psk string, handshake []byte) error {
+	req := make([]byte, crypto.KexPublicKeySize+crypto.KexMACSize)
+	if _, err := io.ReadFull(cConn, req); err != nil {
+		return err
+	}
+	clientPub := req[:crypto.KexPublicKeySize]
+	if !crypto.VerifyKexMAC(psk, crypto.KexLabelClient, req[crypto.KexPublicKeySize:], handshake, clientPub) {
+		return ErrKexAuth
+	}
+
+	kex, err := crypto.NewKeyExchange()
+	if err != nil {
+		return err
+	}
+	serverPub := kex.PublicKey()
+
+	resp := make([]byte, 0, crypto.KexPublicKeySize+crypto.KexMACSize)
+	resp = append(resp, serverPub...)
+	resp = append(resp, crypto.KexMAC(psk, crypto.KexLabelServer, handshake, clientPub, serverPub)...)
+
+	readKey, writeKey, err := kex.SessionKeys(clientPub, handshake, false)
+	if err != nil {
+		return err
+	}
+	if _, err := cConn.Write(resp); err != nil {
+		return err
+	}
+	return cConn.Rekey(readKey, writeKey)
+}
@@ -0,0 +1,163 @@
+// pkg/sudoku/handshake_test.go
+package sudoku
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Futaiii/Sudoku_ASCII/internal/protocol"
+	"github.com/Futaiii/Sudoku_ASCII/pkg/crypto"
+)
+
+// pipeConns 返回一对 AEAD 连接，两端分别使用 clientKey 与 serverKey
+func pipeConns(t *testing.T, clientKey, serverKey string) (client, server *crypto.AEADConn) {
+	t.Helper()
+	a, b := net.Pipe()
+	t.Cleanup(func() { a.Close(); b.Close() })
+	client, err := crypto.NewAEADConn(a, clientKey, "aes-128-gcm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err = crypto.NewAEADConn(b, serverKey, "aes-128-gcm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, server
+}
+
+// acceptKex 模拟服务端: 读取时间戳与版本字节，再完成密钥交换
+func acceptKex(server *crypto.AEADConn, psk string) error {
+	buf := make([]byte, 17)
+	if _, err := io.ReadFull(server, buf); err != nil {
+		return err
+	}
+	if buf[16] != protocol.HandshakeVersionX25519 {
+		return errors.New("missing version byte")
+	}
+	return serverKeyExchange(server, psk, buf[:16])
+}
+
+func TestHandshakeV2(t *testing.T) {
+	client, server := pipeConns(t, "psk", "psk")
+	errc := make(chan error, 1)
+	go func() { errc <- acceptKex(server, "psk") }()
+
+	if err := clientHandshake(client, "psk", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	// 双方已切换为会话密钥，数据仍可双向传输
+	go client.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(server, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("server read %q, %v", buf, err)
+	}
+	go server.Write([]byte("pong"))
+	if _, err := io.ReadFull(client, buf); err != nil || string(buf) != "pong" {
+		t.Fatalf("client read %q, %v", buf, err)
+	}
+}
+
+// TestHandshakeV2WrongPSK AEAD 层相同但认证密钥不同时，服务端拒绝客户端公钥
+func TestHandshakeV2WrongPSK(t *testing.T) {
+	client, server := pipeConns(t, "aead", "aead")
+	errc := make(chan error, 1)
+	go func() {
+		err := acceptKex(server, "server")
+		server.Close()
+		errc <- err
+	}()
+
+	if err := clientHandshake(client, "client", 2); err == nil {
+		t.Fatal("client handshake succeeded with wrong PSK")
+	}
+	if err := <-errc; !errors.Is(err, ErrKexAuth) {
+		t.Fatalf("server error = %v, want ErrKexAuth", err)
+	}
+}
+
+// TestHandshakeV2TamperedReply 服务端应答被篡改时客户端拒绝
+func TestHandshakeV2TamperedReply(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		pos  int
+	}{
+		{"pubkey", 0},
+		{"mac", crypto.KexPublicKeySize},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := pipeConns(t, "psk", "psk")
+			go func() {
+				req := make([]byte, 17+crypto.KexPublicKeySize+crypto.KexMACSize)
+				if _, err := io.ReadFull(server, req); err != nil {
+					return
+				}
+				kex, _ := crypto.NewKeyExchange()
+				pub := kex.PublicKey()
+				resp := append(pub, crypto.KexMAC("psk", crypto.KexLabelServer, req[:16], req[17:17+crypto.KexPublicKeySize], pub)...)
+				resp[tt.pos] ^= 1
+				server.Write(resp)
+			}()
+			if err := clientHandshake(client, "psk", 2); !errors.Is(err, ErrKexAuth) {
+				t.Fatalf("clientHandshake = %v, want ErrKexAuth", err)
+			}
+		})
+	}
+}
+
+// TestHandshakeV2OldServer 不支持 v2 的服务端断开连接时，客户端返回明确的错误
+func TestHandshakeV2OldServer(t *testing.T) {
+	client, server := pipeConns(t, "psk", "psk")
+	go func() {
+		buf := make([]byte, 17)
+		io.ReadFull(server, buf)
+		server.Close()
+	}()
+	if err := clientHandshake(client, "psk", 2); !errors.Is(err, ErrKexClosed) {
+		t.Fatalf("clientHandshake = %v, want ErrKexClosed", err)
+	}
+}
+
+// TestHandshakeV1 v1 只发送时间戳与随机数
+func TestHandshakeV1(t *testing.T) {
+	client, server := pipeConns(t, "psk", "psk")
+	go clientHandshake(client, "psk", 1)
+	buf := make([]byte, 16)
+	if _, err := io.ReadFull(server, buf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestWithDeadline ctx 取消会中断阻塞的读取，done 报告 ctx 的错误；未取消时 done 清除截止时间
+func TestWithDeadline(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := withDeadline(ctx, a, time.Minute)
+	time.AfterFunc(20*time.Millisecond, cancel)
+	var ne net.Error
+	if _, err := a.Read(make([]byte, 1)); !errors.As(err, &ne) || !ne.Timeout() {
+		t.Fatalf("Read = %v, want timeout", err)
+	}
+	if err := done(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("done = %v, want context.Canceled", err)
+	}
+
+	done = withDeadline(context.Background(), a, time.Minute)
+	if err := done(); err != nil {
+		t.Fatalf("done = %v", err)
+	}
+	go b.Write([]byte{1})
+	if _, err := a.Read(make([]byte, 1)); err != nil {
+		t.Fatalf("Read after done = %v", err)
+	}
+}
@@ -0,0 +1,561 @@
+// pkg/sudoku/listener.go
+package sudoku
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Futaiii/Sudoku_ASCII/internal/auth"
+	"github.com/Futaiii/Sudoku_ASCII/internal/ban"
+	"github.com/Futaiii/Sudoku_ASCII/internal/handler"
+	"github.com/Futaiii/Sudoku_ASCII/internal/hybrid"
+	"github.com/Futaiii/Sudoku_ASCII/internal/metrics"
+	"github.com/Futaiii/Sudoku_ASCII/internal/mux"
+	"github.com/Futaiii/Sudoku_ASCII/internal/netutil"
+	"github.com/Futaiii/Sudoku_ASCII/internal/protocol"
+	"github.com/Futaiii/Sudoku_ASCII/internal/proxyproto"
+	"github.com/Futaiii/Sudoku_ASCII/internal/replay"
+	"github.com/Futaiii/Sudoku_ASCII/pkg/crypto"
+	obfs "github.com/Futaiii/Sudoku_ASCII/pkg/obfs/sudoku"
+)
+
+// Listener 在 net.Listener 之上完成 Sudoku 握手，握手失败时按 suspicious_action 回落
+// Accept 返回已认证并读出目标地址的逻辑流，多路复用会话中的每个流单独返回，
+// 由调用方决定如何连接目标:
+//
+//	l, _ := sudoku.NewListener(inner, cfg, nil)
+//	for {
+//		s, err := l.AcceptStream()
+//		if err != nil {
+//			break
+//		}
+//		go route(s) // s.Destination, s.User
+//	}
+type Listener struct {
+	inner  net.Listener
+	mgr    *hybrid.Manager
+	replay *replay.Cache
+	bans   *ban.Tracker
+	state  atomic.Pointer[listenerState]
+
+	// Quota 可选，多用户模式下认证成功后以及多路复用会话每打开一个流时调用，
+	// 返回错误时关闭该连接或流；需在首次 Accept 之前设置
+	Quota func(user string) error
+
+	start     sync.Once
+	closeOnce sync.Once
+	streams   chan *Stream
+	closed    chan struct{}
+}
+
+// listenerState 用于新连接的配置，Update 时整体替换
+type listenerState struct {
+	cfg       *Config
+	table     *obfs.Table
+	users     *auth.Users
+	proxyFrom proxyproto.Trusted
+}
+
+// Stream 一条已认证的逻辑流
+// Read 读取客户端上行数据，Write 发往客户端 (分离模式下经由 Mieru 下行)
+type Stream struct {
+	net.Conn
+	// Network 为 "tcp" 或 "udp"，"udp" 表示 UDP 关联，流上为 ReadDatagram / WriteDatagram 帧
+	Network string
+	// Destination TCP 目标地址 (host:port)，UDP 关联为空
+	Destination string
+	// User 用户名，单用户模式为 "default"
+	User string
+	// Split 下行是否经由 Mieru
+	Split bool
+
+	ack       bool // 客户端等待应答
+	replyOnce sync.Once
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Reply 报告连接目标的结果，err 为 nil 表示成功
+// 仅在客户端请求应答时发送且只发送一次；未调用时首次 Write 视为成功
+func (s *Stream) Reply(err error) error {
+	var werr error
+	s.replyOnce.Do(func() {
+		if s.ack {
+			_, werr = s.Conn.Write([]byte{protocol.ReplyFor(err)})
+		}
+	})
+	return werr
+}
+
+func (s *Stream) Write(p []byte) (int, error) {
+	if err := s.Reply(nil); err != nil {
+		return 0, err
+	}
+	return s.Conn.Write(p)
+}
+
+func (s *Stream) Close() error {
+	s.closeOnce.Do(func() { close(s.done) })
+	return s.Conn.Close()
+}
+
+// NewListener 以 inner 为底层监听创建 Listener，使用 cfg 的 Key、AEAD、ASCII、Padding、Users、
+// 回落、重放窗口、Timeouts、Mux 与 Mieru 相关字段
+// table 为 nil 时按 Key / ASCII 生成；开启分离模式时会启动 Mieru 服务端 (每个进程一个，Mieru 配置须一致)
+func NewListener(inner net.Listener, cfg *Config, table *obfs.Table) (*Listener, error) {
+	if err := cfg.Normalize(); err != nil {
+		return nil, err
+	}
+
+	mgr, err := hybrid.Acquire(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := mgr.StartMieruServer(); err != nil {
+		return nil, err
+	}
+
+	l := &Listener{
+		inner:   inner,
+		mgr:     mgr,
+		replay:  replay.New(time.Duration(cfg.ReplayWindow)*time.Second, cfg.ReplayCacheSize),
+		bans:    ban.New(cfg.Ban),
+		streams: make(chan *Stream),
+		closed:  make(chan struct{}),
+	}
+	if err := l.Update(cfg, table); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Update 替换用于新连接的配置与映射表，已建立的连接不受影响
+// 重放缓存沿用创建时的 replay_window / replay_cache_size，封禁列表沿用创建时的 ban.file
+func (l *Listener) Update(cfg *Config, table *obfs.Table) error {
+	if err := cfg.Normalize(); err != nil {
+		return err
+	}
+	proxyFrom, err := proxyproto.ParseTrusted(cfg.ProxyFrom)
+	if err != nil {
+		return err
+	}
+	l.bans.Update(cfg.Ban)
+	if table == nil {
+		if table, err = NewTable(cfg); err != nil {
+			return err
+		}
+	}
+	l.state.Store(&listenerState{
+		cfg:       cfg,
+		table:     table,
+		users:     auth.NewUsers(cfg.Users, time.Duration(cfg.ReplayWindow)*time.Second),
+		proxyFrom: proxyFrom,
+	})
+	return nil
+}
+
+// Accept 实现 net.Listener，返回的连接均为 *Stream
+func (l *Listener) Accept() (net.Conn, error) {
+	s, err := l.AcceptStream()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// AcceptStream 等待下一条已认证的流，Listener 关闭后返回 net.ErrClosed
+func (l *Listener) AcceptStream() (*Stream, error) {
+	l.start.Do(func() { go l.serve() })
+	select {
+	case s := <-l.streams:
+		return s, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close 停止接受新连接与新流，已交出的流不受影响，尚未写入的封禁会写入 ban.file
+func (l *Listener) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.closed)
+		err = l.inner.Close()
+		if ferr := l.bans.Flush(); ferr != nil {
+			log.Printf("[Ban] Save failed: %v", ferr)
+		}
+	})
+	return err
+}
+
+func (l *Listener) Addr() net.Addr {
+	return l.inner.Addr()
+}
+
+func (l *Listener) serve() {
+	var delay time.Duration
+	for {
+		c, err := l.inner.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				l.Close()
+				return
+			}
+			delay = netutil.AcceptBackoff(delay)
+			log.Printf("[Server] Accept error: %v; retrying in %v", err, delay)
+			select {
+			case <-time.After(delay):
+			case <-l.closed:
+				return
+			}
+			continue
+		}
+		delay = 0
+		go l.handleConn(c, l.state.Load())
+	}
+}
+
+// deliver 将流交给 Accept 并等待其关闭，Listener 已关闭时直接关闭流
+func (l *Listener) deliver(s *Stream) {
+	select {
+	case l.streams <- s:
+		<-s.done
+	case <-l.closed:
+		s.Close()
+	}
+}
+
+// handleConn 完成握手，随后交出单个流或进入多路复用，返回时连接已结束
+func (l *Listener) handleConn(rawConn net.Conn, st *listenerState) {
+	cfg := st.cfg
+	metrics.ActiveConns.Inc()
+	defer metrics.ActiveConns.Dec()
+
+	// 位于负载均衡之后: 先读取 PROXY 头，之后的封禁、日志与回落均使用其中的真实来源
+	// 只接受来自负载均衡的头部，直连端口的对端可以伪造任意来源，按可疑连接处理并计入封禁
+	if cfg.ProxyProtocol && !st.proxyFrom.Contains(rawConn.RemoteAddr()) {
+		metrics.HandshakeFailures.With(metrics.ReasonProxyProto).Inc()
+		log.Printf("[Security] Connection from %s, not a trusted PROXY source", rawConn.RemoteAddr())
+		handler.HandleSuspicious(nil, rawConn, cfg, l.bans)
+		return
+	}
+	if cfg.ProxyProtocol {
+		rawConn.SetReadDeadline(time.Now().Add(time.Duration(cfg.Timeouts.Handshake) * time.Second))
+		pConn, err := proxyproto.Accept(rawConn)
+		if err != nil {
+			metrics.HandshakeFailures.With(metrics.ReasonProxyProto).Inc()
+			log.Printf("[Security] Bad PROXY header from %s: %v", rawConn.RemoteAddr(), err)
+			rawConn.Close()
+			return
+		}
+		rawConn = pConn
+	}
+
+	// 已封禁的 IP 不进入数独解码，直接回落或静默
+	host, _, _ := net.SplitHostPort(rawConn.RemoteAddr().String())
+	if l.bans.Banned(host) {
+		metrics.BannedConns.Inc()
+		handler.HandleSuspicious(nil, rawConn, cfg, nil)
+		return
+	}
+
+	// 1. Sudoku 层 (开启记录以支持回落)
+	sConn, err := obfs.NewConnProfile(metrics.CountConn(rawConn, metrics.LayerRaw), st.table, cfg.PaddingProfile, cfg.PaddingMin, cfg.PaddingMax, true)
+	if err != nil {
+		log.Printf("[Server] %v", err)
+		rawConn.Close()
+		return
+	}
+	dConn := metrics.CountConn(sConn, metrics.LayerDecoded)
+	rawConn.SetDeadline(time.Now().Add(time.Duration(cfg.Timeouts.Handshake) * time.Second))
+
+	// reject 记录失败原因并按 suspicious_action 处理 (回落不受握手超时限制)
+	// 只有探测特征明显的失败计入封禁，重放、时间偏差等可能来自正常客户端
+	reject := func(reason string) {
+		metrics.HandshakeFailures.With(reason).Inc()
+		rawConn.SetDeadline(time.Time{})
+		var bans *ban.Tracker
+		if probeFailure(reason) {
+			bans = l.bans
+		}
+		handler.HandleSuspicious(sConn, rawConn, cfg, bans)
+	}
+
+	// 多用户模式: AEAD 层之前是用户标识，据此选择用户密钥
+	user := &auth.User{Name: auth.DefaultUserName, Key: cfg.Key}
+	if st.users != nil {
+		var hint auth.Hint
+		if _, err := io.ReadFull(dConn, hint[:]); err != nil {
+			log.Printf("[Security] Handshake fail: %v", err)
+			reject(metrics.FailureReason(err))
+			return
+		}
+		u, ok := st.users.Lookup(hint)
+		if !ok {
+			log.Printf("[Security] Unknown user from %s", rawConn.RemoteAddr())
+			reject(metrics.ReasonUnknownUser)
+			return
+		}
+		user = u
+	}
+
+	// 2. 加密层
+	cConn, err := crypto.NewAEADConn(dConn, user.Key, cfg.AEAD)
+	if err != nil {
+		rawConn.Close()
+		return
+	}
+
+	defer cConn.Close()
+
+	// 3. 验证握手
+	handshakeBuf := make([]byte, 16)
+	_, err = io.ReadFull(cConn, handshakeBuf)
+
+	if err != nil {
+		log.Printf("[Security] Handshake fail: %v", err)
+		reject(metrics.FailureReason(err))
+		return
+	}
+
+	ts := int64(binary.BigEndian.Uint64(handshakeBuf[:8]))
+	if abs(time.Now().Unix()-ts) > int64(cfg.ReplayWindow) {
+		log.Printf("[Security] Time skew")
+		reject(metrics.ReasonTimeSkew)
+		return
+	}
+
+	if !l.replay.Check(handshakeBuf, ts) {
+		log.Printf("[Security] Replayed handshake from %s", rawConn.RemoteAddr())
+		reject(metrics.ReasonReplay)
+		return
+	}
+
+	// 预读一个字节: v2 客户端为版本字节，v1 客户端直接是命令字节
+	magicBuf := make([]byte, 1)
+	if _, err := io.ReadFull(cConn, magicBuf); err != nil {
+		log.Printf("[Security] Handshake fail: %v", err)
+		reject(metrics.FailureReason(err))
+		return
+	}
+
+	if magicBuf[0] == protocol.HandshakeVersionX25519 {
+		if err := serverKeyExchange(cConn, user.Key, handshakeBuf); err != nil {
+			log.Printf("[Security] Key exchange fail: %v", err)
+			reason := metrics.FailureReason(err)
+			if reason == metrics.ReasonOther {
+				reason = metrics.ReasonKeyExchange
+			}
+			reject(reason)
+			return
+		}
+		if _, err := io.ReadFull(cConn, magicBuf); err != nil {
+			return
+		}
+	} else if cfg.MinHandshake >= 2 {
+		log.Printf("[Security] Refused v1 handshake from %s (User: %s)", rawConn.RemoteAddr(), user.Name)
+		reject(metrics.ReasonVersion)
+		return
+	}
+	rawConn.SetDeadline(time.Time{})
+
+	// 超出配额的用户拒绝新的握手: 放在认证之后，用户标识无法被他人用来试探配额，直接关闭而不回落
+	if st.users != nil && l.quotaExceeded(user.Name, rawConn.RemoteAddr()) {
+		metrics.HandshakeFailures.With(metrics.ReasonQuota).Inc()
+		return
+	}
+
+	// 握手成功，停止记录
+	sConn.StopRecording()
+	metrics.HandshakeSuccess.Inc()
+	// 认证成功后才开启整形，避免向探测者发送空闲填充
+	if cfg.Shaping.Enable {
+		sConn.EnableShaping(shapingOptions(cfg.Shaping))
+	}
+
+	// *** Detect Split Tunneling ***
+	// magicBuf 为 Split Magic 时进入上下行分离
+	var conn net.Conn = cConn // 默认为全双工 Sudoku
+	split := false
+
+	if magicBuf[0] == protocol.SplitMagic && cfg.EnableMieru {
+		// Split Mode!
+		// 读取 UUID
+		lenBuf := make([]byte, 1)
+		if _, err := io.ReadFull(cConn, lenBuf); err != nil {
+			log.Printf("[Server] Failed to read split header: %v", err)
+			return
+		}
+		uuidBuf := make([]byte, int(lenBuf[0]))
+		if _, err := io.ReadFull(cConn, uuidBuf); err != nil {
+			log.Printf("[Server] Failed to read split header: %v", err)
+			return
+		}
+		uuid := string(uuidBuf)
+
+		log.Printf("[Server] Split request UUID: %s, waiting for Mieru...", uuid)
+
+		// 等待 Mieru 连接
+		pairing := time.Duration(cfg.Timeouts.Pairing) * time.Second
+		ctx, cancel := context.WithTimeout(context.Background(), pairing)
+		mConn, err := l.mgr.RegisterSudokuConn(ctx, uuid)
+		cancel()
+		if err != nil {
+			log.Printf("[Server] Pairing failed: %v", err)
+			return
+		}
+
+		// 成功配对
+		defer mConn.Close()
+
+		// 完整读取 "BIND" 这
+		discardBuf := make([]byte, 4)
+		mConn.SetReadDeadline(time.Now().Add(pairing))
+		if _, err := io.ReadFull(mConn, discardBuf); err != nil {
+			log.Printf("[Server] Failed to read BIND magic from Mieru: %v", err)
+			return
+		}
+		mConn.SetReadDeadline(time.Time{})
+
+		// Split 头之后继续预读一个字节，判断连接用途
+		if _, err := io.ReadFull(cConn, magicBuf); err != nil {
+			return
+		}
+
+		// 上行读 Sudoku，下行写 Mieru
+		split = true
+		conn = &hybrid.SplitConn{
+			Conn:   cConn,
+			Reader: cConn,
+			Writer: mConn,
+			CloseFn: func() error {
+				e1 := cConn.Close()
+				e2 := mConn.Close()
+				if e1 != nil {
+					return e1
+				}
+				return e2
+			},
+		}
+	}
+
+	// *** Detect Mux ***
+	if magicBuf[0] == protocol.MuxMagic {
+		l.serveMux(conn, cfg, user.Name, split)
+		return
+	}
+
+	s, err := readStream(conn, magicBuf[0], user.Name, split)
+	if err != nil {
+		log.Printf("[Server] Failed to read target address: %v", err)
+		return
+	}
+	l.deliver(s)
+}
+
+// serveMux 在一条连接上接受多路复用的流，每个流按握手后的首字节规则独立处理
+func (l *Listener) serveMux(conn net.Conn, cfg *Config, user string, split bool) {
+	sess := mux.Server(conn, mux.Config{
+		MaxStreams: cfg.Mux.MaxStreams,
+		// 比客户端多保留一段时间，避免客户端在会话将被关闭时打开新流
+		IdleTimeout: 2 * time.Duration(cfg.Mux.IdleTimeout) * time.Second,
+	})
+	defer sess.Close()
+
+	log.Printf("[Server] Mux session from %s (User: %s, Split: %v)", conn.RemoteAddr(), user, split)
+
+	for {
+		stream, err := sess.AcceptStream()
+		if err != nil {
+			return
+		}
+		// 会话建立后用尽配额的用户不能再打开新流
+		if l.quotaExceeded(user, conn.RemoteAddr()) {
+			stream.Close()
+			continue
+		}
+		go func() {
+			cmdBuf := make([]byte, 1)
+			if _, err := io.ReadFull(stream, cmdBuf); err != nil {
+				stream.Close()
+				return
+			}
+			s, err := readStream(stream, cmdBuf[0], user, split)
+			if err != nil {
+				log.Printf("[Server] Failed to read target address: %v", err)
+				stream.Close()
+				return
+			}
+			l.deliver(s)
+		}()
+	}
+}
+
+// quotaExceeded 调用 Quota 检查用户配额，超出时记录日志
+func (l *Listener) quotaExceeded(user string, remote net.Addr) bool {
+	if l.Quota == nil {
+		return false
+	}
+	if err := l.Quota(user); err != nil {
+		log.Printf("[Quota] User %s refused from %s: %v", user, remote, err)
+		return true
+	}
+	return false
+}
+
+// readStream 根据已预读的首字节解析流的用途: UDP 关联或 TCP 目标地址 (可带应答)
+func readStream(conn net.Conn, cmd byte, user string, split bool) (*Stream, error) {
+	s := &Stream{Conn: conn, User: user, Split: split, done: make(chan struct{})}
+	if cmd == protocol.UDPAssociateMagic {
+		s.Network = "udp"
+		return s, nil
+	}
+
+	var r io.Reader = conn
+	if cmd == protocol.ConnectAckMagic {
+		s.ack = true
+	} else {
+		// 旧版客户端: 首字节即地址类型
+		r = io.MultiReader(bytes.NewReader([]byte{cmd}), conn)
+	}
+	addr, _, _, err := protocol.ReadAddress(r)
+	if err != nil {
+		return nil, err
+	}
+	s.Network = "tcp"
+	s.Destination = addr
+	return s, nil
+}
+
+// ReadDatagram 从 UDP 关联流中读取一个数据报，返回目标地址 (host:port) 与负载
+func ReadDatagram(r io.Reader) (string, []byte, error) {
+	return protocol.ReadDatagram(r)
+}
+
+// WriteDatagram 向 UDP 关联流写入一个数据报，addr 为数据报的来源地址
+func WriteDatagram(w io.Writer, addr string, payload []byte) error {
+	return protocol.WriteDatagram(w, addr, payload)
+}
+
+// probeFailure 判断握手失败是否像主动探测: 非法的数独数据、未知用户、解密失败或超时
+func probeFailure(reason string) bool {
+	switch reason {
+	case metrics.ReasonMapMiss, metrics.ReasonUnknownUser, metrics.ReasonDecrypt, metrics.ReasonTimeout:
+		return true
+	}
+	return false
+}
+
+func abs(x int64) int64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
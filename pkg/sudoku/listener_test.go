@@ -0,0 +1,169 @@
+// pkg/sudoku/listener_test.go
+package sudoku
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestListenerFallback 握手失败的连接原样转发到回落地址，包括已读取的探测数据
+func TestListenerFallback(t *testing.T) {
+	decoy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer decoy.Close()
+	received := make(chan []byte, 1)
+	go func() {
+		c, err := decoy.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		buf := make([]byte, 64)
+		n, _ := io.ReadAtLeast(c, buf, len("GET / HTTP/1.1\r\n"))
+		received <- buf[:n]
+		c.Write([]byte("HTTP/1.1 200 OK\r\n\r\n"))
+	}()
+
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := NewListener(inner, &Config{Mode: "server", Key: "test-key", AEAD: "chacha20-poly1305", FallbackAddr: decoy.Addr().String()}, sharedTable(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go l.AcceptStream()
+
+	probe, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer probe.Close()
+	probe.Write([]byte("GET / HTTP/1.1\r\n"))
+
+	select {
+	case got := <-received:
+		if !bytes.HasPrefix(got, []byte("GET / HTTP/1.1\r\n")) {
+			t.Fatalf("fallback received %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("probe was not forwarded to the fallback")
+	}
+	probe.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reply := make([]byte, len("HTTP/1.1 200 OK"))
+	if _, err := io.ReadFull(probe, reply); err != nil || string(reply) != "HTTP/1.1 200 OK" {
+		t.Fatalf("probe read %q, %v", reply, err)
+	}
+}
+
+func TestListenerWrongKey(t *testing.T) {
+	l, cfg := startListener(t)
+	cfg.Key = "other-key"
+	d, err := NewDialer(cfg, sharedTable(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go l.AcceptStream()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if _, err := d.DialContext(ctx, "tcp", "example.com:443"); err == nil {
+		t.Fatal("DialContext with the wrong key succeeded")
+	}
+}
+
+func TestListenerClose(t *testing.T) {
+	l, _ := startListener(t)
+	errc := make(chan error, 1)
+	go func() {
+		_, err := l.AcceptStream()
+		errc <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	l.Close()
+
+	select {
+	case err := <-errc:
+		if !errors.Is(err, net.ErrClosed) {
+			t.Fatalf("AcceptStream = %v, want net.ErrClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("AcceptStream did not return after Close")
+	}
+}
+
+// TestListenerUntrustedProxy 不在 proxy_protocol_from 内的对端发送的 PROXY 头不被解析，连接按可疑处理并计入封禁
+func TestListenerUntrustedProxy(t *testing.T) {
+	decoy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer decoy.Close()
+	received := make(chan []byte, 1)
+	go func() {
+		c, err := decoy.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		buf := make([]byte, 64)
+		n, _ := io.ReadAtLeast(c, buf, len("PROXY TCP4 "))
+		received <- buf[:n]
+	}()
+
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := NewListener(inner, &Config{
+		Mode: "server", Key: "test-key", AEAD: "chacha20-poly1305", FallbackAddr: decoy.Addr().String(),
+		ProxyProtocol: true, ProxyFrom: []string{"192.0.2.0/24"},
+		Ban: &BanConfig{Threshold: 1},
+	}, sharedTable(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go l.AcceptStream()
+
+	c, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.Write([]byte("PROXY TCP4 203.0.113.9 127.0.0.1 5000 443\r\n"))
+
+	select {
+	case got := <-received:
+		if !bytes.HasPrefix(got, []byte("PROXY TCP4 203.0.113.9")) {
+			t.Fatalf("fallback received %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection was not forwarded to the fallback")
+	}
+	if !l.bans.Banned("127.0.0.1") {
+		t.Fatal("untrusted PROXY source not counted toward a ban")
+	}
+	if l.bans.Banned("203.0.113.9") {
+		t.Fatal("address claimed by an untrusted header was banned")
+	}
+}
+
+func TestListenerProxyFromRequired(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inner.Close()
+	if _, err := NewListener(inner, &Config{Mode: "server", Key: "test-key", ProxyProtocol: true}, sharedTable(t)); err == nil {
+		t.Fatal("NewListener accepted proxy_protocol without proxy_protocol_from")
+	}
+}
@@ -0,0 +1,154 @@
+// pkg/sudoku/mux.go
+package sudoku
+
+import (
+	"context"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Futaiii/Sudoku_ASCII/internal/mux"
+	"github.com/Futaiii/Sudoku_ASCII/internal/protocol"
+)
+
+// muxPool 客户端多路复用会话池
+// 优先复用未满的会话，全部占满时才新建 Sudoku 连接
+type muxPool struct {
+	mu       sync.Mutex
+	sessions []*mux.Session
+	pending  *pendingDial // 进行中的会话拨号
+	closed   bool
+	draining bool // closeWhenIdle 之后: 新流各自使用一个用完即关的会话
+}
+
+// pendingDial 一次进行中的会话拨号，done 关闭后 err 为拨号失败的原因
+type pendingDial struct {
+	done chan struct{}
+	err  error
+}
+
+// close 关闭池中全部会话，之后新建的会话也会被直接关闭
+func (p *muxPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, sess := range p.sessions {
+		sess.Close()
+	}
+	p.sessions = nil
+	p.closed = true
+}
+
+// closeWhenIdle 池中会话不再承载新流，各自在其上的流全部结束后关闭
+func (p *muxPool) closeWhenIdle() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, sess := range p.sessions {
+		sess.CloseWhenIdle()
+	}
+	p.sessions = nil
+	p.draining = true
+}
+
+// tryOpen 清理已关闭的会话，并在未满的会话上打开流，调用方须持有锁
+func (p *muxPool) tryOpen() net.Conn {
+	alive := p.sessions[:0]
+	for _, sess := range p.sessions {
+		if !sess.IsClosed() {
+			alive = append(alive, sess)
+		}
+	}
+	clear(p.sessions[len(alive):])
+	p.sessions = alive
+
+	for _, sess := range p.sessions {
+		if !sess.CanOpen() {
+			continue
+		}
+		if stream, err := sess.OpenStream(); err == nil {
+			return stream
+		}
+	}
+	return nil
+}
+
+func (p *muxPool) openStream(ctx context.Context, d *Dialer) (net.Conn, error) {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, net.ErrClosed
+		}
+		if stream := p.tryOpen(); stream != nil {
+			p.mu.Unlock()
+			return stream, nil
+		}
+		// 已有请求在新建会话时等待其结果，突发的请求不会各自建立一条连接
+		if pd := p.pending; pd != nil && !p.draining {
+			p.mu.Unlock()
+			select {
+			case <-pd.done:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			if pd.err != nil {
+				return nil, pd.err
+			}
+			continue
+		}
+		pd := &pendingDial{done: make(chan struct{})}
+		if !p.draining {
+			p.pending = pd
+		}
+		p.mu.Unlock()
+
+		// 拨号与握手在锁外进行，不阻塞可以复用已有会话的请求
+		sess, err := d.dialSession(ctx)
+
+		p.mu.Lock()
+		if p.pending == pd {
+			p.pending = nil
+		}
+		// 因本请求的 ctx 取消而失败时，等待者重新尝试，而不是随之失败
+		if err != nil && ctx.Err() == nil {
+			pd.err = err
+		}
+		close(pd.done)
+		if err != nil {
+			p.mu.Unlock()
+			return nil, err
+		}
+		if p.closed {
+			p.mu.Unlock()
+			sess.Close()
+			return nil, net.ErrClosed
+		}
+		if p.draining {
+			p.mu.Unlock()
+			stream, err := sess.OpenStream()
+			sess.CloseWhenIdle()
+			return stream, err
+		}
+		p.sessions = append(p.sessions, sess)
+		log.Printf("[Mux] New session to %s (%d active)", d.cfg.ServerAddress, len(p.sessions))
+		stream, err := sess.OpenStream()
+		p.mu.Unlock()
+		return stream, err
+	}
+}
+
+// dialSession 建立新的 Sudoku 连接并在其上创建多路复用会话
+func (d *Dialer) dialSession(ctx context.Context) (*mux.Session, error) {
+	conn, err := d.dialSudoku(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write([]byte{protocol.MuxMagic}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return mux.Client(conn, mux.Config{
+		MaxStreams:  d.cfg.Mux.MaxStreams,
+		IdleTimeout: time.Duration(d.cfg.Mux.IdleTimeout) * time.Second,
+	}), nil
+}